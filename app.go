@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -38,6 +40,19 @@ func ReadUserInput(prompt string) (string, error) {
 
 }
 
+// Чтение необязательного значения: в отличие от ReadUserInput пустая строка допустима
+func readOptionalInput(prompt string) (string, error) {
+	fmt.Print(prompt)
+
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+
+	return strings.TrimSpace(input), nil
+}
+
 // Алгоритм работы
 //
 // 1. Отключить эхо-вывод в терминале
@@ -79,7 +94,7 @@ func readPassword() (string, error) {
 // 3. Вывести список всех доступных команд
 // 4. Добавить разделители для лучшей читаемости
 
-func ShowMainMenu() {
+func ShowMainMenu(vaultName string) {
 	clearScreen()
 
 	// Повторяем символ равенства n кол-во раз
@@ -91,18 +106,24 @@ func ShowMainMenu() {
 	padding := (42 - len(title)) / 2
 	fmt.Printf("%s%s%s\n", strings.Repeat(" ", padding), title, strings.Repeat(" ", padding))
 
+	fmt.Println(sepLine)
+	fmt.Printf("Vault: %s\n", vaultName)
 	fmt.Println(sepLine)
 
 	commands := []string{
 		"1. Generate new password",
-		"2. Add new password",
-		"3. Get password",
+		"2. Add new entry",
+		"3. Search password",
 		"4. List all passwords",
-		"5. Update password",
+		"5. Edit entry",
 		"6. Delete password",
-		"7. List categories",
+		"7. Folders",
 		"8. Show password statistics",
 		"9. Find duplicate passwords",
+		"i. Import passwords",
+		"e. Export passwords",
+		"t. Interactive mode (TUI)",
+		"v. Switch vault",
 		"0. Exit",
 	}
 
@@ -134,14 +155,62 @@ func PrintPasswordList(passwords []Password) {
 
 // Алгоритм работы
 //
-// 1. Показать все поля пароля
-// 2. Отформатировать даты в читаемом формате
-// 3. Структурировать вывод для лучшей читаемости
+// 1. Показать имя, ID, тип, категорию и теги записи
+// 2. Показать заполненные поля по схеме типа (для ключа SSH - ещё открытый ключ)
+// 3. Показать поля, которых нет в схеме, заметки и вложения
+// 4. Отформатировать даты в читаемом формате
 
 func ShowPasswordDetails(password Password) {
+	// 1
+	schema, err := FindKind(password.Kind)
+	if err != nil {
+		// Тип из более новой версии программы: поля покажет шаг 3
+		schema = KindSchema{Kind: password.Kind, Title: password.Kind}
+	}
 	fmt.Printf("Service: %s\n", password.Name)
+	fmt.Printf("ID: %s\n", password.ID)
+	fmt.Printf("Type: %s\n", schema.Title)
 	fmt.Printf("Category: %s\n", password.Category)
-	fmt.Printf("Password: %s\n", password.Value)
+	if len(password.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(password.Tags, ", "))
+	}
+
+	// 2
+	if schema.Kind == KindSSHKey {
+		if public, err := sshPublicKey(password); err == nil {
+			fmt.Printf("Public key: %s\n", public)
+		}
+	}
+	known := make(map[string]bool)
+	for _, f := range schema.Fields {
+		known[f.Key] = true
+		value := password.Field(f.Key)
+		switch {
+		case value == "":
+		case f.Multiline:
+			fmt.Printf("%s:\n%s", f.Label, value)
+			if !strings.HasSuffix(value, "\n") {
+				fmt.Println()
+			}
+		default:
+			fmt.Printf("%s: %s\n", f.Label, value)
+		}
+	}
+
+	// 3
+	for _, key := range slices.Sorted(maps.Keys(password.Fields)) {
+		if !known[key] {
+			fmt.Printf("%s: %s\n", key, password.Fields[key])
+		}
+	}
+	if password.Notes != "" {
+		fmt.Printf("Notes: %s\n", password.Notes)
+	}
+	for _, a := range password.Attachments {
+		fmt.Printf("Attachment: %s (%s)\n", a.Name, formatSize(int64(len(a.Data))))
+	}
+
+	// 4
 	fmt.Printf("Created: %s\n", password.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Last Modified: %s\n", password.LastModified.Format("2006-01-02 15:04:05"))
 }
@@ -156,14 +225,10 @@ func passInput(pm *PasswordManager) (string, error) {
 
 	if passIn == "" {
 		clearScreen()
-		input, err := ReadUserInput("Enter password length (min 8): ")
+		length, err := readPasswordLength()
 		if err != nil {
 			return "", err
 		}
-		length, err := strconv.Atoi(input)
-		if err != nil {
-			return "", fmt.Errorf("invalid number: %w", err)
-		}
 
 		pass, err := pm.GeneratePassword(length)
 		if err != nil {
@@ -184,3 +249,436 @@ func passInput(pm *PasswordManager) (string, error) {
 
 	return passIn, nil
 }
+
+// Выбор типа новой записи по номеру или имени; Enter - login
+func readEntryKind() (KindSchema, error) {
+	fmt.Println("Entry types:")
+	for i, s := range entryKinds {
+		fmt.Printf("  %d. %s (%s)\n", i+1, s.Title, s.Kind)
+	}
+
+	input, err := readOptionalInput("Select type (Enter = login): ")
+	if err != nil {
+		return KindSchema{}, err
+	}
+	if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(entryKinds) {
+		return entryKinds[n-1], nil
+	}
+	return FindKind(strings.ToLower(input))
+}
+
+// Алгоритм работы функции:
+//
+// 1. Пароль записи login вводится через passInput: его можно сгенерировать,
+//    а при изменении записи он меняется только после подтверждения
+// 2. Остальные поля запросить по схеме типа. При изменении записи Enter оставляет
+//    текущее значение, "-" очищает необязательное поле
+// 3. Для нового ключа SSH пустой ввод - сгенерировать ключ ed25519
+// 4. Проверить значение сразу и при ошибке запросить его ещё раз
+
+func readKindFields(pm *PasswordManager, schema KindSchema, p *Password, editing bool) error {
+	p.Fields = maps.Clone(p.Fields)
+
+	for _, f := range schema.Fields {
+		// 1
+		if f.Key == fieldValue && schema.Generated {
+			if editing {
+				change, err := confirmAction("Change password?")
+				if err != nil {
+					return err
+				}
+				if !change {
+					continue
+				}
+			}
+			value, err := passInput(pm)
+			if err != nil {
+				return err
+			}
+			p.SetField(f.Key, value)
+			continue
+		}
+
+		for {
+			// 2
+			value, err := readKindField(f, p.Field(f.Key), editing)
+			if err != nil {
+				return err
+			}
+			if editing && value == "-" && !f.Required {
+				p.SetField(f.Key, "")
+				break
+			}
+			if value == "" {
+				// 3
+				if schema.Kind == KindSSHKey && !editing {
+					private, authorized, err := GenerateSSHKey("ed25519", p.Name)
+					if err != nil {
+						return err
+					}
+					showInfo("Generated public key: " + authorized)
+					p.SetField(f.Key, private)
+					break
+				}
+				if f.Required && !editing {
+					showError(f.Label + " is required")
+					continue
+				}
+				break
+			}
+
+			// 4
+			if f.Normalize != nil {
+				if value, err = f.Normalize(value); err != nil {
+					showError(fmt.Sprintf("%v: %s: %v", ErrFieldInvalid, f.Label, err))
+					continue
+				}
+			}
+			p.SetField(f.Key, value)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Ввод нового значения поля при изменении записи: текущее значение показывается в скобках
+func readEditInput(label, current string) (string, error) {
+	if current == "" {
+		return readOptionalInput(label + " (optional): ")
+	}
+	return readOptionalInput(label + " [" + current + "]: ")
+}
+
+// Ввод одного поля. Секретные значения вводятся без эха и при изменении не показываются
+func readKindField(f KindField, current string, editing bool) (string, error) {
+	prompt := f.Label
+	switch {
+	case editing && current != "" && (f.Secret || f.Multiline):
+		prompt += " [unchanged]"
+	case editing && current != "":
+		prompt += " [" + current + "]"
+	case !f.Required:
+		prompt += " (optional)"
+	}
+
+	if f.Multiline {
+		fmt.Println(prompt + ", finish with an empty line:")
+		return readMultilineInput()
+	}
+	if f.Secret {
+		fmt.Print(prompt + ": ")
+		return readPassword()
+	}
+	return readOptionalInput(prompt + ": ")
+}
+
+// Чтение нескольких строк до первой пустой строки
+func readMultilineInput() (string, error) {
+	reader := bufio.NewReader(os.Stdin)
+
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// Алгоритм работы
+//
+// 1. Вывести пронумерованный список найденных записей в порядке оценки
+// 2. Показать поле, по которому найдено совпадение
+
+func PrintSearchResults(results []SearchResult) {
+	fmt.Printf("%-4s %-20s %-15s %-10s\n", "#", "Name", "Category", "Matched")
+	fmt.Println(strings.Repeat("-", 52))
+
+	for i, r := range results {
+		fmt.Printf("%-4d %-20s %-15s %-10s\n", i+1, r.Password.Name, r.Password.Category, r.Field)
+	}
+}
+
+// Алгоритм работы
+//
+// 1. Если найдена одна запись - сразу вернуть её
+// 2. Иначе показать пронумерованный список
+// 3. Запросить номер записи и проверить диапазон
+// 4. Вернуть выбранную запись
+
+func SelectSearchResult(results []SearchResult) (Password, error) {
+	// 1
+	if len(results) == 1 {
+		return results[0].Password, nil
+	}
+
+	// 2
+	fmt.Printf("Found %d matches:\n\n", len(results))
+	PrintSearchResults(results)
+	fmt.Println()
+
+	// 3
+	input, err := ReadUserInput(fmt.Sprintf("Select entry (1-%d): ", len(results)))
+	if err != nil {
+		return Password{}, err
+	}
+	choice, err := strconv.Atoi(input)
+	if err != nil {
+		return Password{}, fmt.Errorf("invalid number: %w", err)
+	}
+	if choice < 1 || choice > len(results) {
+		return Password{}, fmt.Errorf("choice out of range: %d", choice)
+	}
+
+	// 4
+	return results[choice-1].Password, nil
+}
+
+// Алгоритм работы
+//
+// 1. Найти записи по ID, имени или началу ID
+// 2. Если запись одна - вернуть её
+// 3. Несколько аккаунтов с одним именем - показать их с логином, папкой и ID и запросить номер
+
+func SelectEntry(pm *PasswordManager, ref string) (Password, error) {
+	// 1
+	matches := pm.FindEntries(ref)
+
+	// 2
+	switch len(matches) {
+	case 0:
+		return Password{}, ErrPassNotFound
+	case 1:
+		return matches[0], nil
+	}
+
+	// 3
+	fmt.Printf("%d entries are named %q:\n\n", len(matches), ref)
+	for i, p := range matches {
+		fmt.Printf("%-4d %s\n", i+1, entryLabel(p))
+	}
+	fmt.Println()
+
+	input, err := ReadUserInput(fmt.Sprintf("Select entry (1-%d): ", len(matches)))
+	if err != nil {
+		return Password{}, err
+	}
+	choice, err := strconv.Atoi(input)
+	if err != nil {
+		return Password{}, fmt.Errorf("invalid number: %w", err)
+	}
+	if choice < 1 || choice > len(matches) {
+		return Password{}, fmt.Errorf("choice out of range: %d", choice)
+	}
+	return matches[choice-1], nil
+}
+
+// Алгоритм работы
+//
+// 1. Показать, пробный ли это запуск
+// 2. Вывести количество записей по каждому действию
+// 3. Перечислить переименованные записи
+
+func PrintImportReport(report ImportReport) {
+	// 1
+	if report.DryRun {
+		fmt.Println("Import summary (dry run, nothing saved):")
+	} else {
+		fmt.Println("Import summary:")
+	}
+
+	// 2
+	fmt.Printf("  Added:       %d\n", len(report.Added))
+	fmt.Printf("  Overwritten: %d\n", len(report.Overwritten))
+	fmt.Printf("  Renamed:     %d\n", len(report.Renamed))
+	fmt.Printf("  Skipped:     %d\n", len(report.Skipped))
+	fmt.Printf("  Invalid:     %d\n", report.Invalid)
+	if len(report.DroppedAttachments) > 0 {
+		fmt.Printf("  Attachments dropped (too large or invalid name): %s\n", strings.Join(report.DroppedAttachments, ", "))
+	}
+
+	// 3
+	for _, r := range report.Renamed {
+		fmt.Printf("  • %s → %s\n", r.From, r.To)
+	}
+}
+
+// Запрос подтверждения вида (y/n)
+func confirmAction(prompt string) (bool, error) {
+	input, err := ReadUserInput(prompt + " (y/n): ")
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(input, "y") || strings.EqualFold(input, "yes"), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Показать, какое хранилище открывается
+// 2. Запросить мастер-пароль этого хранилища (для командного - пароль своей личности)
+// 3. Загрузить данные
+
+func unlockVaultSession(sess *vaultSession) error {
+	// 1
+	info, err := sess.Store.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Exists {
+		fmt.Printf("Vault %q: %s (%d bytes, modified %s)\n", sess.Name, info.URI, info.Size, info.ModTime.Format("2006-01-02 15:04"))
+	} else {
+		fmt.Printf("Vault %q: %s (new)\n", sess.Name, info.URI)
+	}
+
+	// 2
+	if _, ok := sess.Store.(*teamStore); ok {
+		fmt.Print("Enter identity passphrase: ")
+	} else {
+		fmt.Print("Enter master password: ")
+	}
+	masterPassword, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	// 3
+	return sess.Open(masterPassword)
+}
+
+// Запрос длины генерируемого пароля. Пустой ввод - длина из настроек генератора
+func readPasswordLength() (int, error) {
+	input, err := readOptionalInput(fmt.Sprintf("Enter password length (min %d, Enter = %d): ", appConfig.MinPasswordLength, appConfig.Generator.Length))
+	if err != nil {
+		return 0, err
+	}
+	if input == "" {
+		return appConfig.Generator.Length, nil
+	}
+
+	length, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %w", err)
+	}
+	return length, nil
+}
+
+// Алгоритм работы
+//
+// 1. Изменения, пришедшие из другой версии
+// 2. Записи, где наша версия новее
+// 3. Число конфликтов
+
+func PrintMergeReport(res MergeResult) {
+	fmt.Println("Merge summary:")
+
+	// 1
+	for _, c := range res.Changes {
+		fmt.Printf("  %-7s %s\n", c.Op, c.Name)
+	}
+
+	// 2
+	for _, name := range res.KeptOurs {
+		fmt.Printf("  %-7s %s (local version is newer)\n", "keep", name)
+	}
+	if len(res.Changes) == 0 && len(res.KeptOurs) == 0 {
+		fmt.Println("  No changes")
+	}
+
+	// 3
+	if len(res.Conflicts) > 0 {
+		fmt.Printf("  Conflicts: %d\n", len(res.Conflicts))
+	}
+}
+
+// Две версии конфликтующей записи одна под другой
+func PrintMergeConflict(c MergeConflict, otherLabel string) {
+	fmt.Printf("=== Conflict: %s ===\n\n", c.Name)
+	for _, side := range []struct {
+		label string
+		p     *Password
+	}{{"Local", c.Ours}, {otherLabel, c.Theirs}} {
+		fmt.Printf("--- %s ---\n", side.label)
+		if side.p == nil {
+			fmt.Println("(deleted)")
+		} else {
+			ShowPasswordDetails(*side.p)
+		}
+		fmt.Println()
+	}
+}
+
+// Выбор способа разрешения конфликта
+func SelectMergeResolution() (MergeResolution, error) {
+	for {
+		input, err := ReadUserInput("Keep [l]ocal, [o]ther, [b]oth or [n]ewest: ")
+		if err != nil {
+			return ResolveOurs, err
+		}
+
+		switch strings.ToLower(input) {
+		case "l", "local":
+			return ResolveOurs, nil
+		case "o", "other":
+			return ResolveTheirs, nil
+		case "b", "both":
+			return ResolveBoth, nil
+		case "n", "newest":
+			return ResolveNewest, nil
+		}
+		showError("Invalid choice. Please try again")
+	}
+}
+
+// Мастер-пароль для неинтерактивных режимов (git-credential, docker-credential, run, inject)
+const masterPasswordEnv = "PM_MASTER_PASSWORD"
+
+// Алгоритм работы функции:
+//
+// 1. Хранилище должно существовать: неинтерактивные режимы не создают новых
+// 2. Взять мастер-пароль из PM_MASTER_PASSWORD, иначе запросить через /dev/tty -
+//    stdin и stdout заняты протоколом вызывающей программы
+// 3. Загрузить данные
+
+func unlockVaultSessionTTY(sess *vaultSession) error {
+	// 1
+	info, err := sess.Store.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Exists {
+		return fmt.Errorf("%w: %s", ErrVaultNotFound, info.URI)
+	}
+
+	// 2
+	masterPassword, ok := os.LookupEnv(masterPasswordEnv)
+	if !ok {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return fmt.Errorf("no terminal to ask the master password, set %s", masterPasswordEnv)
+		}
+		defer tty.Close()
+
+		fmt.Fprintf(tty, "PasswordManager: master password for vault %q: ", sess.Name)
+		pass, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(tty)
+		if err != nil {
+			return err
+		}
+		masterPassword = string(pass)
+	}
+
+	// 3
+	return sess.Open(masterPassword)
+}
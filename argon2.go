@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2 (RFC 9106) во всех трёх вариантах.
+//
+// golang.org/x/crypto/argon2 экспортирует только Argon2i и Argon2id, а KeePass и
+// KeePassXC по умолчанию создают базы KDBX 4 с Argon2d. Argon2id для новых файлов
+// по-прежнему считается через argon2.IDKey, эта реализация нужна для чтения чужих баз
+
+type argon2Mode uint32
+
+const (
+	argon2d  argon2Mode = 0
+	argon2i  argon2Mode = 1
+	argon2id argon2Mode = 2
+)
+
+const (
+	argon2Version    = 0x13
+	argon2BlockWords = 128
+	argon2SyncPoints = 4
+)
+
+type argon2Block [argon2BlockWords]uint64
+
+// Алгоритм работы функции:
+//
+// 1. Посчитать H0 от параметров, пароля, соли, секрета и дополнительных данных
+// 2. Округлить память до кратного 4*threads и заполнить первые два блока каждой полосы
+// 3. Выполнить time проходов по памяти
+// 4. Свернуть последние блоки полос в ключ нужной длины
+
+func argon2Key(mode argon2Mode, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if time < 1 {
+		time = 1
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	lanes := uint32(threads)
+
+	// 1
+	h0 := argon2InitHash(mode, password, salt, secret, data, time, memory, lanes, keyLen)
+
+	// 2
+	memory = memory / (argon2SyncPoints * lanes) * (argon2SyncPoints * lanes)
+	if memory < 2*argon2SyncPoints*lanes {
+		memory = 2 * argon2SyncPoints * lanes
+	}
+	B := argon2InitBlocks(&h0, memory, lanes)
+
+	// 3
+	argon2Fill(B, mode, time, memory, lanes)
+
+	// 4
+	return argon2Extract(B, memory, lanes, keyLen)
+}
+
+func argon2InitHash(mode argon2Mode, password, salt, secret, data []byte, time, memory, lanes, keyLen uint32) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+	var params [24]byte
+	var tmp [4]byte
+
+	b2, _ := blake2b.New512(nil)
+	binary.LittleEndian.PutUint32(params[0:4], lanes)
+	binary.LittleEndian.PutUint32(params[4:8], keyLen)
+	binary.LittleEndian.PutUint32(params[8:12], memory)
+	binary.LittleEndian.PutUint32(params[12:16], time)
+	binary.LittleEndian.PutUint32(params[16:20], argon2Version)
+	binary.LittleEndian.PutUint32(params[20:24], uint32(mode))
+	b2.Write(params[:])
+
+	for _, part := range [][]byte{password, salt, secret, data} {
+		binary.LittleEndian.PutUint32(tmp[:], uint32(len(part)))
+		b2.Write(tmp[:])
+		b2.Write(part)
+	}
+	b2.Sum(h0[:0])
+
+	return h0
+}
+
+func argon2InitBlocks(h0 *[blake2b.Size + 8]byte, memory, lanes uint32) []argon2Block {
+	var buf [1024]byte
+	B := make([]argon2Block, memory)
+	laneLen := memory / lanes
+
+	for lane := uint32(0); lane < lanes; lane++ {
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			argon2Hash(buf[:], h0[:])
+			blk := &B[lane*laneLen+i]
+			for w := range blk {
+				blk[w] = binary.LittleEndian.Uint64(buf[w*8:])
+			}
+		}
+	}
+
+	return B
+}
+
+// Алгоритм работы функции:
+//
+// 1. Память разбита на полосы (lanes), полоса - на 4 сегмента
+// 2. Для каждого блока выбрать опорный блок: в Argon2d по содержимому предыдущего блока,
+//    в Argon2i (и первой половине первого прохода Argon2id) - по независимому от данных генератору адресов
+// 3. Новый блок = G(предыдущий, опорный) XOR текущее содержимое
+
+func argon2Fill(B []argon2Block, mode argon2Mode, time, memory, lanes uint32) {
+	laneLen := memory / lanes
+	segLen := laneLen / argon2SyncPoints
+
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			for lane := uint32(0); lane < lanes; lane++ {
+				// 1
+				dataIndependent := mode == argon2i || (mode == argon2id && n == 0 && slice < argon2SyncPoints/2)
+
+				var addresses, in, zero argon2Block
+				if dataIndependent {
+					in[0] = uint64(n)
+					in[1] = uint64(lane)
+					in[2] = uint64(slice)
+					in[3] = uint64(memory)
+					in[4] = uint64(time)
+					in[5] = uint64(mode)
+				}
+
+				index := uint32(0)
+				if n == 0 && slice == 0 {
+					// Первые два блока уже заполнены
+					index = 2
+					if dataIndependent {
+						in[6]++
+						argon2Compress(&addresses, &in, &zero, false)
+						argon2Compress(&addresses, &addresses, &zero, false)
+					}
+				}
+
+				offset := lane*laneLen + slice*segLen + index
+				for ; index < segLen; index, offset = index+1, offset+1 {
+					prev := offset - 1
+					if index == 0 && slice == 0 {
+						prev += laneLen
+					}
+
+					// 2
+					var random uint64
+					if dataIndependent {
+						if index%argon2BlockWords == 0 {
+							in[6]++
+							argon2Compress(&addresses, &in, &zero, false)
+							argon2Compress(&addresses, &addresses, &zero, false)
+						}
+						random = addresses[index%argon2BlockWords]
+					} else {
+						random = B[prev][0]
+					}
+					ref := argon2RefIndex(random, laneLen, segLen, lanes, n, slice, lane, index)
+
+					// 3
+					argon2Compress(&B[offset], &B[prev], &B[ref], true)
+				}
+			}
+		}
+	}
+}
+
+// Номер опорного блока по разделу 3.4 RFC 9106
+func argon2RefIndex(random uint64, laneLen, segLen, lanes, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(random>>32) % lanes
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+
+	area, start := 3*segLen, ((slice+1)%argon2SyncPoints)*segLen
+	if lane == refLane {
+		area += index
+	}
+	if n == 0 {
+		area, start = slice*segLen, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+
+	x := random & 0xFFFFFFFF
+	x = (x * x) >> 32
+	x = (uint64(area) * x) >> 32
+
+	return refLane*laneLen + uint32((uint64(start)+uint64(area)-(x+1))%uint64(laneLen))
+}
+
+func argon2Extract(B []argon2Block, memory, lanes, keyLen uint32) []byte {
+	laneLen := memory / lanes
+	last := &B[memory-1]
+	for lane := uint32(0); lane < lanes-1; lane++ {
+		for i, v := range B[lane*laneLen+laneLen-1] {
+			last[i] ^= v
+		}
+	}
+
+	var buf [1024]byte
+	for i, v := range last {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+
+	key := make([]byte, keyLen)
+	argon2Hash(key, buf[:])
+
+	return key
+}
+
+// Функция сжатия G: R = X xor Y, затем перестановка BlaMka по строкам и столбцам
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r, q argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	q = r
+
+	for i := 0; i < argon2BlockWords; i += 16 {
+		blamkaRound(&q[i+0], &q[i+1], &q[i+2], &q[i+3], &q[i+4], &q[i+5], &q[i+6], &q[i+7],
+			&q[i+8], &q[i+9], &q[i+10], &q[i+11], &q[i+12], &q[i+13], &q[i+14], &q[i+15])
+	}
+	for i := 0; i < argon2BlockWords/8; i += 2 {
+		blamkaRound(&q[i], &q[i+1], &q[16+i], &q[16+i+1], &q[32+i], &q[32+i+1], &q[48+i], &q[48+i+1],
+			&q[64+i], &q[64+i+1], &q[80+i], &q[80+i+1], &q[96+i], &q[96+i+1], &q[112+i], &q[112+i+1])
+	}
+
+	for i := range out {
+		if xor {
+			out[i] ^= r[i] ^ q[i]
+		} else {
+			out[i] = r[i] ^ q[i]
+		}
+	}
+}
+
+// Раунд BLAKE2b, в котором сложение заменено на a + b + 2*lo(a)*lo(b)
+func blamkaRound(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	blamkaG(v0, v4, v8, v12)
+	blamkaG(v1, v5, v9, v13)
+	blamkaG(v2, v6, v10, v14)
+	blamkaG(v3, v7, v11, v15)
+
+	blamkaG(v0, v5, v10, v15)
+	blamkaG(v1, v6, v11, v12)
+	blamkaG(v2, v7, v8, v13)
+	blamkaG(v3, v4, v9, v14)
+}
+
+func blamkaG(a, b, c, d *uint64) {
+	fBlaMka := func(x, y uint64) uint64 {
+		return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+	}
+	rotr := func(x uint64, n uint) uint64 {
+		return x>>n | x<<(64-n)
+	}
+
+	*a = fBlaMka(*a, *b)
+	*d = rotr(*d^*a, 32)
+	*c = fBlaMka(*c, *d)
+	*b = rotr(*b^*c, 24)
+	*a = fBlaMka(*a, *b)
+	*d = rotr(*d^*a, 16)
+	*c = fBlaMka(*c, *d)
+	*b = rotr(*b^*c, 63)
+}
+
+// Хеш-функция переменной длины H' из раздела 3.3 RFC 9106
+func argon2Hash(out, in []byte) {
+	var b2 hash.Hash
+	if n := len(out); n < blake2b.Size {
+		b2, _ = blake2b.New(n, nil)
+	} else {
+		b2, _ = blake2b.New512(nil)
+	}
+
+	var buf [blake2b.Size]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(out)))
+	b2.Write(buf[:4])
+	b2.Write(in)
+
+	if len(out) <= blake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	b2.Sum(buf[:0])
+	b2.Reset()
+	copy(out, buf[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		b2.Write(buf[:])
+		b2.Sum(buf[:0])
+		copy(out, buf[:32])
+		out = out[32:]
+		b2.Reset()
+	}
+
+	if outLen%blake2b.Size > 0 {
+		r := ((outLen + 31) / 32) - 2
+		b2, _ = blake2b.New(outLen-32*r, nil)
+	}
+	b2.Write(buf[:])
+	b2.Sum(out[:0])
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Вложение записи: файл, который хранится внутри записи и шифруется вместе с хранилищем.
+// Поэтому вложения без отдельного хранилища файлов попадают в историю git, слияние,
+// командные хранилища, передачу записи, архив и экспорт в JSON и KDBX
+type Attachment struct {
+	// Имя файла без каталога, уникальное в пределах записи
+	Name string `json:"name"`
+	// Содержимое; в JSON - base64
+	Data []byte `json:"data"`
+	// SHA-256 содержимого в hex, проверяется при извлечении
+	SHA256  string    `json:"sha256"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+func newAttachment(name string, data []byte) Attachment {
+	sum := sha256.Sum256(data)
+	return Attachment{Name: name, Data: data, SHA256: hex.EncodeToString(sum[:]), AddedAt: time.Now()}
+}
+
+func (a Attachment) verify() error {
+	sum := sha256.Sum256(a.Data)
+	if hex.EncodeToString(sum[:]) != a.SHA256 {
+		return fmt.Errorf("%w: %s", ErrAttachmentCorrupted, a.Name)
+	}
+	return nil
+}
+
+// Имя вложения - только имя файла: при извлечении оно не должно указывать в другой каталог
+func attachmentName(name string) (string, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "." || name == ".." || name == string(filepath.Separator) || strings.ContainsAny(name, "/\\\x00") {
+		return "", fmt.Errorf("invalid attachment name %q", name)
+	}
+	return name, nil
+}
+
+func (p Password) attachment(name string) (int, bool) {
+	i := slices.IndexFunc(p.Attachments, func(a Attachment) bool { return a.Name == name })
+	return i, i >= 0
+}
+
+func attachmentNames(p Password) string {
+	names := make([]string, len(p.Attachments))
+	for i, a := range p.Attachments {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p Password) attachmentsSize() int64 {
+	var size int64
+	for _, a := range p.Attachments {
+		size += int64(len(a.Data))
+	}
+	return size
+}
+
+// Размер в удобном для чтения виде: 512 B, 1.5 KiB, 3.2 MiB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMG"[exp])
+}
+
+// Проверка размера одного файла по настройке attachments.max_file_size
+func checkAttachmentSize(name string, size int64) error {
+	if limit := appConfig.Attachments.MaxFileSize; size > int64(limit) {
+		return fmt.Errorf("%w: %s is %s, limit is %s (attachments.max_file_size)", ErrAttachmentTooLarge, name, formatSize(size), limit)
+	}
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить имя и размер файла
+// 2. Найти запись; вложение с таким именем не должно существовать
+// 3. Проверить, что общий размер вложений хранилища не превысит предел
+// 4. Добавить вложение к копии списка и обновить время изменения записи
+
+func (pm *PasswordManager) AddAttachment(entry, name string, data []byte) error {
+	// 1
+	name, err := attachmentName(name)
+	if err != nil {
+		return err
+	}
+	if err := checkAttachmentSize(name, int64(len(data))); err != nil {
+		return err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// 2
+	if err := pm.passInit(); err != nil {
+		return err
+	}
+	id, err := pm.lookupLocked(entry)
+	if err != nil {
+		return err
+	}
+	p := pm.passwords[id]
+	if _, ok := p.attachment(name); ok {
+		return fmt.Errorf("%w: %s", ErrAttachmentExists, name)
+	}
+
+	// 3
+	var total int64
+	for _, v := range pm.passwords {
+		total += v.attachmentsSize()
+	}
+	if limit := appConfig.Attachments.MaxTotalSize; total+int64(len(data)) > int64(limit) {
+		return fmt.Errorf("%w: vault attachments would take %s, limit is %s (attachments.max_total_size)", ErrAttachmentTooLarge, formatSize(total+int64(len(data))), limit)
+	}
+
+	// 4
+	// Запись в map - копия, но срез общий с ней: меняем только новый срез
+	p.Attachments = append(slices.Clip(p.Attachments), newAttachment(name, data))
+	if err := pm.auditLocked(auditEntry(AuditUpdate, p, "attachment "+name+" added")); err != nil {
+		return err
+	}
+	p.LastModified = time.Now()
+	pm.passwords[id] = p
+
+	return nil
+}
+
+// Вложение записи с проверкой контрольной суммы
+func (pm *PasswordManager) GetAttachment(entry, name string) (Attachment, error) {
+	p, err := pm.GetPassword(entry)
+	if err != nil {
+		return Attachment{}, err
+	}
+	i, ok := p.attachment(name)
+	if !ok {
+		return Attachment{}, fmt.Errorf("%w: %s", ErrAttachmentNotFound, name)
+	}
+	a := p.Attachments[i]
+	return a, a.verify()
+}
+
+func (pm *PasswordManager) RemoveAttachment(entry, name string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := pm.passInit(); err != nil {
+		return err
+	}
+	id, err := pm.lookupLocked(entry)
+	if err != nil {
+		return err
+	}
+	p := pm.passwords[id]
+	i, ok := p.attachment(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAttachmentNotFound, name)
+	}
+
+	p.Attachments = slices.Delete(slices.Clone(p.Attachments), i, i+1)
+	if err := pm.auditLocked(auditEntry(AuditUpdate, p, "attachment "+name+" removed")); err != nil {
+		return err
+	}
+	p.LastModified = time.Now()
+	pm.passwords[id] = p
+
+	return nil
+}
+
+// Записи с вложениями в порядке имён
+func (pm *PasswordManager) EntriesWithAttachments() []Password {
+	var res []Password
+	for _, p := range pm.ListPasswords() {
+		if len(p.Attachments) > 0 {
+			res = append(res, p)
+		}
+	}
+	sortEntries(res)
+	return res
+}
@@ -0,0 +1,889 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Журнал аудита хранилища: кто и когда читал, добавлял, менял, удалял и экспортировал
+// записи, неудачные попытки разблокировки. Журнал лежит в каталоге данных
+// ($XDG_DATA_HOME/passwordmanager/audit/<хранилище>.log) и только дополняется.
+//
+// Первая строка файла - заголовок с солью и открытым ключом X25519, остальные - записи.
+// Событие шифруется на открытый ключ, поэтому неудачную разблокировку можно записать
+// без мастер-пароля, а прочитать журнал - только с ним (закрытый ключ выводится из
+// мастер-ключа и соли). Записи связаны цепочкой хешей: hash(N) = SHA-256(hash(N-1) || строка N),
+// hash(N-1) лежит и внутри зашифрованного события N, поэтому удалить или изменить запись
+// в середине, не расшифровав все следующие, нельзя. Записи, сделанные после разблокировки,
+// подписаны HMAC; последняя из них запоминается в файле .head, что выдаёт обрезанный хвост.
+//
+// Файл .head можно подменить старой копией вместе с обрезанным журналом, поэтому при каждом
+// сохранении хранилища номер и хеш последней записи попадают и в его зашифрованные данные
+// (якорь). Переписать якорь без мастер-пароля нельзя: журнал, который короче якоря или
+// расходится с ним, выдаёт удаление или подмену.
+//
+// До первой разблокировки ключа журнала ещё нет, и неудачные разблокировки пишутся открытым
+// текстом (в них нет секретов); при разблокировке такой файл уходит в ротацию
+const (
+	auditDirName = "audit"
+	auditLogExt  = ".log"
+	auditHeadExt = ".head"
+	auditVersion = 1
+)
+
+// Операции журнала аудита
+const (
+	AuditGet          = "get"
+	AuditAdd          = "add"
+	AuditUpdate       = "update"
+	AuditDelete       = "delete"
+	AuditExport       = "export"
+	AuditUnlockFailed = "unlock-failed"
+	// Журнал короче якоря в хранилище или расходится с ним: его удалили или обрезали
+	AuditLogReset = "log-reset"
+)
+
+// Служебная запись хранилища с якорем журнала. У каждой машины свой журнал, поэтому
+// и якорь свой: ID включает хеш пользователя и пути к журналу
+const (
+	auditAnchorPrefix = "audit-anchor:"
+	auditAnchorKind   = "audit-anchor"
+)
+
+var (
+	auditKeyInfo    = []byte("passwordmanager audit key")
+	auditRecordInfo = []byte("passwordmanager audit record")
+)
+
+// Источник операций по умолчанию: меню или имя команды (serve, git-credential, ...)
+var auditSource = "menu"
+
+type AuditEvent struct {
+	Seq  uint64    `json:"seq"`
+	Prev string    `json:"prev"`
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Запись, к которой относится операция; у экспорта и разблокировки пусто
+	EntryID string `json:"entry_id,omitempty"`
+	Entry   string `json:"entry,omitempty"`
+	// Подробности без секретов: изменённые поля, файл экспорта
+	Detail string `json:"detail,omitempty"`
+	// Откуда выполнена операция (menu, tui, api:<токен>, git-credential) и пользователь ОС
+	Source string `json:"source"`
+	User   string `json:"user"`
+}
+
+func auditEntry(op string, p Password, detail string) AuditEvent {
+	return AuditEvent{Op: op, EntryID: p.ID, Entry: p.Name, Detail: detail}
+}
+
+type auditHeader struct {
+	Version   int    `json:"version"`
+	Salt      []byte `json:"salt"`
+	PublicKey []byte `json:"public_key"`
+	// Последняя запись предыдущего файла: цепочка продолжается через ротацию
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+type auditLine struct {
+	Seq uint64 `json:"seq"`
+	// Эфемерный открытый ключ X25519 и AES-256-GCM(событие)
+	Sealed []byte `json:"sealed,omitempty"`
+	// Событие открытым текстом - в файле без ключа, до первой разблокировки
+	Event json.RawMessage `json:"event,omitempty"`
+	MAC   string          `json:"mac,omitempty"`
+}
+
+// Номер и хеш последней записи журнала, сохранённые в данных хранилища (якорь)
+type AuditAnchor struct {
+	Seq  uint64
+	Hash string
+}
+
+// Последняя подписанная запись
+type auditHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac"`
+}
+
+// Ключи журнала, выведенные из мастер-ключа и соли заголовка
+type auditKeys struct {
+	private *ecdh.PrivateKey
+	mac     []byte
+}
+
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	// Заголовок текущего файла; Version 0 - файла ещё нет, без открытого ключа -
+	// файл создан до первой разблокировки
+	header   auditHeader
+	lastSeq  uint64
+	lastHash []byte
+	size     int64
+	// Ключи появляются после разблокировки хранилища; secret - мастер-ключ,
+	// из которого выводятся ключи файлов ротации с другой солью
+	keys   *auditKeys
+	secret []byte
+	user   string
+}
+
+// Имя файла журнала: имя хранилища из реестра, для путей и URI - их хеш
+func auditLogPath(vault string) (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	name := vault
+	if !vaultNameRe.MatchString(name) {
+		sum := sha256.Sum256([]byte(vault))
+		name = "vault-" + hex.EncodeToString(sum[:8])
+	}
+	return filepath.Join(dir, auditDirName, name+auditLogExt), nil
+}
+
+// Пользователь ОС и имя машины
+func auditUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти файл журнала хранилища; если его нет - журнал создастся при разблокировке
+// 2. Прочитать заголовок
+// 3. Пройти по записям, вычисляя цепочку хешей, чтобы продолжить её новыми записями
+
+func OpenAuditLog(vault string) (*AuditLog, error) {
+	// 1
+	path, err := auditLogPath(vault)
+	if err != nil {
+		return nil, err
+	}
+	l := &AuditLog{path: path, user: auditUser()}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 2
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	if err := json.Unmarshal(lines[0], &l.header); err != nil {
+		return nil, fmt.Errorf("%w: %s: header: %v (move the file away to start a new log)", ErrAuditLog, path, err)
+	}
+	if l.lastHash, err = hex.DecodeString(l.header.Hash); err != nil {
+		return nil, fmt.Errorf("%w: %s: header: %v (move the file away to start a new log)", ErrAuditLog, path, err)
+	}
+	l.lastSeq = l.header.Seq
+	l.size = int64(len(data))
+
+	// 3
+	for i, raw := range lines[1:] {
+		var line auditLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return nil, fmt.Errorf("%w: %s: line %d: %v (move the file away to start a new log)", ErrAuditLog, path, i+2, err)
+		}
+		l.lastSeq, l.lastHash = line.Seq, chainHash(l.lastHash, raw)
+	}
+
+	return l, nil
+}
+
+func chainHash(prev, line []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(line)
+	return h.Sum(nil)
+}
+
+func deriveAuditKeys(masterKey, salt []byte) (*auditKeys, error) {
+	seed, err := hkdf.Key(sha256.New, masterKey, salt, string(auditKeyInfo), 64)
+	if err != nil {
+		return nil, err
+	}
+	private, err := ecdh.X25519().NewPrivateKey(seed[:32])
+	if err != nil {
+		return nil, err
+	}
+	return &auditKeys{private: private, mac: seed[32:]}, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Вывести ключи из мастер-ключа и соли заголовка
+// 2. Журнала ещё нет, он создан до первой разблокировки или зашифрован другим
+//    мастер-паролем - начать новый файл с новой солью; старый файл уходит в ротацию,
+//    цепочка продолжается, а .head подписывается новым ключом
+
+func (l *AuditLog) unlock(masterKey []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 1
+	if l.header.Salt != nil {
+		keys, err := deriveAuditKeys(masterKey, l.header.Salt)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(keys.private.PublicKey().Bytes(), l.header.PublicKey) {
+			l.keys, l.secret = keys, slices.Clone(masterKey)
+			return nil
+		}
+	}
+
+	// 2
+	salt := randomBytes(16)
+	keys, err := deriveAuditKeys(masterKey, salt)
+	if err != nil {
+		return err
+	}
+	if err := l.startFileLocked(salt, keys.private.PublicKey().Bytes()); err != nil {
+		return err
+	}
+	l.keys, l.secret = keys, slices.Clone(masterKey)
+	if l.lastSeq == 0 {
+		return nil
+	}
+	return l.writeHeadLocked()
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сдвинуть старые файлы: .log.N-1 -> .log.N, лишние удалить, текущий -> .log.1
+// 2. Записать новый файл с заголовком, продолжающим цепочку
+
+func (l *AuditLog) startFileLocked(salt, publicKey []byte) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+
+	// 1
+	if l.header.Version != 0 {
+		keep := appConfig.Audit.Keep
+		os.Remove(rotatedAuditPath(l.path, keep))
+		for i := keep - 1; i >= 1; i-- {
+			if err := os.Rename(rotatedAuditPath(l.path, i), rotatedAuditPath(l.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(l.path, rotatedAuditPath(l.path, 1)); err != nil {
+			return err
+		}
+	}
+
+	// 2
+	header := auditHeader{Version: auditVersion, Salt: salt, PublicKey: publicKey, Seq: l.lastSeq, Hash: hex.EncodeToString(l.lastHash)}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := writeFileAtomic(l.path, data, 0600); err != nil {
+		return err
+	}
+	l.header, l.size = header, int64(len(data))
+	return nil
+}
+
+func rotatedAuditPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// Принудительная ротация: текущий файл уходит в .log.1, новый продолжает цепочку
+func (l *AuditLog) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.keys == nil {
+		return ErrVaultClosed
+	}
+	return l.startFileLocked(l.header.Salt, l.header.PublicKey)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Журнала ещё нет (неудачная разблокировка до первой удачной) - начать файл без ключа
+// 2. Дополнить событие номером, хешем предыдущей записи, временем и пользователем
+// 3. Зашифровать событие на открытый ключ журнала (в файле без ключа - записать как есть);
+//    после разблокировки - подписать HMAC
+// 4. Если файл вырос больше audit.max_size - начать новый
+// 5. Дописать строку и сбросить её на диск
+// 6. Продолжить цепочку; подписанную запись запомнить в .head
+
+func (l *AuditLog) Append(ev AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 1
+	if l.header.Version == 0 {
+		if err := l.startFileLocked(nil, nil); err != nil {
+			return err
+		}
+	}
+
+	// 2
+	ev.Seq, ev.Prev = l.lastSeq+1, hex.EncodeToString(l.lastHash)
+	ev.Time = time.Now()
+	ev.User = l.user
+	if ev.Source == "" {
+		ev.Source = auditSource
+	}
+
+	// 3
+	plain, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	line := auditLine{Seq: ev.Seq, Event: plain}
+	if l.header.PublicKey != nil {
+		if line.Sealed, err = sealAuditEvent(l.header.PublicKey, ev.Seq, plain); err != nil {
+			return err
+		}
+		line.Event = nil
+	}
+	if l.keys != nil {
+		line.MAC = auditMAC(l.keys.mac, ev.Seq, line.Sealed)
+	}
+	raw, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	// 4
+	if l.size+int64(len(raw)) > int64(appConfig.Audit.MaxSize) && l.lastSeq > l.header.Seq {
+		if err := l.startFileLocked(l.header.Salt, l.header.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	// 5
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// 6
+	l.lastSeq, l.lastHash = ev.Seq, chainHash(l.lastHash, raw)
+	l.size += int64(len(raw)) + 1
+	if l.keys == nil {
+		return nil
+	}
+	return l.writeHeadLocked()
+}
+
+func (l *AuditLog) headPath() string {
+	return strings.TrimSuffix(l.path, auditLogExt) + auditHeadExt
+}
+
+func (l *AuditLog) writeHeadLocked() error {
+	head := auditHead{Seq: l.lastSeq, Hash: hex.EncodeToString(l.lastHash)}
+	head.MAC = auditMAC(l.keys.mac, head.Seq, []byte(head.Hash))
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.headPath(), data, 0600)
+}
+
+func auditMAC(key []byte, seq uint64, data []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(strconv.FormatUint(seq, 10)))
+	m.Write([]byte{0})
+	m.Write(data)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// [эфемерный ключ X25519] [nonce] [AES-256-GCM(событие)], номер записи - дополнительные данные
+func sealAuditEvent(publicKey []byte, seq uint64, plain []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	key, err := auditRecordKey(shared, eph.PublicKey().Bytes(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(key, plain, []byte(strconv.FormatUint(seq, 10)))
+	if err != nil {
+		return nil, err
+	}
+	return append(eph.PublicKey().Bytes(), sealed...), nil
+}
+
+func openAuditEvent(keys *auditKeys, seq uint64, sealed []byte) (AuditEvent, error) {
+	var ev AuditEvent
+	if len(sealed) < 32 {
+		return ev, errors.New("record is too short")
+	}
+	eph, err := ecdh.X25519().NewPublicKey(sealed[:32])
+	if err != nil {
+		return ev, err
+	}
+	shared, err := keys.private.ECDH(eph)
+	if err != nil {
+		return ev, err
+	}
+	key, err := auditRecordKey(shared, sealed[:32], keys.private.PublicKey().Bytes())
+	if err != nil {
+		return ev, err
+	}
+	plain, err := openSealed(key, sealed[32:], []byte(strconv.FormatUint(seq, 10)))
+	if err != nil {
+		return ev, errors.New("record cannot be decrypted")
+	}
+	err = json.Unmarshal(plain, &ev)
+	return ev, err
+}
+
+func auditRecordKey(shared, ephPub, pub []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, shared, append(append([]byte{}, ephPub...), pub...), string(auditRecordInfo), MasterKeySize)
+}
+
+// Результат проверки журнала
+type AuditReport struct {
+	Files   int
+	Records int
+	// Номера первой и последней записи; первые записи могли уйти с удалёнными файлами ротации
+	First, Last uint64
+	// Записи без подписи: неудачные разблокировки, сделанные без мастер-пароля
+	Unsigned int
+	Problems []string
+	Events   []AuditEvent
+}
+
+func (r *AuditReport) problem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Файлы журнала от старых к новым: .log.N, ..., .log.1, .log
+func (l *AuditLog) files() []string {
+	var files []string
+	for i := appConfig.Audit.Keep; i >= 1; i-- {
+		if _, err := os.Stat(rotatedAuditPath(l.path, i)); err == nil {
+			files = append(files, rotatedAuditPath(l.path, i))
+		}
+	}
+	if _, err := os.Stat(l.path); err == nil {
+		files = append(files, l.path)
+	}
+	return files
+}
+
+// Алгоритм работы функции:
+//
+// 1. Пройти по файлам от старых к новым; заголовок каждого следующего файла должен
+//    продолжать цепочку предыдущего
+// 2. Вывести ключи из соли заголовка; файл другого мастер-пароля прочитать нельзя
+// 3. Для каждой записи проверить номер, расшифровать её и сравнить хеш предыдущей записи
+//    внутри события с цепочкой; проверить подпись. Без подписи допустима только
+//    неудачная разблокировка - остальное мог дописать кто угодно
+// 4. Последняя подписанная запись из .head должна быть в цепочке: иначе хвост обрезан
+// 5. Так же проверить якорь из данных хранилища: его не подменить старой копией
+
+func (l *AuditLog) Verify(anchor *AuditAnchor) (*AuditReport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.keys == nil {
+		return nil, ErrVaultClosed
+	}
+	hashes := make(map[uint64]string)
+	report := &AuditReport{}
+	var prevSeq uint64
+	var prevHash []byte
+
+	// 1
+	for i, path := range l.files() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		report.Files++
+		lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+		var header auditHeader
+		if err := json.Unmarshal(lines[0], &header); err != nil {
+			report.problem("%s: damaged header: %v", filepath.Base(path), err)
+			continue
+		}
+		hash, err := hex.DecodeString(header.Hash)
+		if err != nil {
+			report.problem("%s: damaged header: %v", filepath.Base(path), err)
+			continue
+		}
+		switch {
+		case i == 0:
+			report.First = header.Seq + 1
+		case header.Seq != prevSeq || !bytes.Equal(hash, prevHash):
+			report.problem("%s: chain breaks after record %d (file starts after %d)", filepath.Base(path), prevSeq, header.Seq)
+		}
+		seq := header.Seq
+
+		// 2
+		keys, err := deriveAuditKeys(l.secret, header.Salt)
+		if err != nil {
+			return nil, err
+		}
+		readable := header.PublicKey == nil || bytes.Equal(keys.private.PublicKey().Bytes(), header.PublicKey)
+		if !readable {
+			report.problem("%s: encrypted with another master password, records are not checked", filepath.Base(path))
+		}
+
+		// 3
+		for n, raw := range lines[1:] {
+			where := fmt.Sprintf("%s line %d", filepath.Base(path), n+2)
+			var line auditLine
+			if err := json.Unmarshal(raw, &line); err != nil {
+				report.problem("%s: damaged record: %v", where, err)
+				hash = chainHash(hash, raw)
+				continue
+			}
+			if line.Seq != seq+1 {
+				report.problem("%s: record %d follows %d", where, line.Seq, seq)
+			}
+			if readable {
+				hash = l.checkRecord(report, keys, header.PublicKey != nil, where, line, hash)
+			}
+			seq, hash = line.Seq, chainHash(hash, raw)
+			hashes[seq] = hex.EncodeToString(hash)
+			report.Records++
+		}
+		prevSeq, prevHash = seq, hash
+	}
+	report.Last = prevSeq
+
+	// 4
+	data, err := os.ReadFile(l.headPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if report.Records > report.Unsigned {
+			report.problem("head file is missing")
+		}
+	case err != nil:
+		return nil, err
+	default:
+		var head auditHead
+		if err := json.Unmarshal(data, &head); err != nil {
+			report.problem("head file is damaged: %v", err)
+			break
+		}
+		if !hmac.Equal([]byte(head.MAC), []byte(auditMAC(l.keys.mac, head.Seq, []byte(head.Hash)))) {
+			report.problem("head file signature is invalid")
+		} else if head.Seq > report.Last {
+			report.problem("log is truncated: last signed record is %d, log ends at %d", head.Seq, report.Last)
+		} else if h, ok := hashes[head.Seq]; ok && h != head.Hash {
+			report.problem("record %d does not match the head file", head.Seq)
+		}
+	}
+
+	// 5
+	if anchor != nil {
+		if anchor.Seq > report.Last {
+			report.problem("log is truncated: the vault was saved at record %d, log ends at %d", anchor.Seq, report.Last)
+		} else if h, ok := hashes[anchor.Seq]; ok && h != anchor.Hash {
+			report.problem("record %d does not match the vault", anchor.Seq)
+		}
+	}
+
+	return report, nil
+}
+
+// Расшифровать запись и сверить её с цепочкой и подписью. Возвращает хеш, от которого
+// продолжается цепочка: после разрыва - хеш из самой записи, чтобы один удалённый
+// или вставленный блок не помечал все следующие записи
+func (l *AuditLog) checkRecord(report *AuditReport, keys *auditKeys, encrypted bool, where string, line auditLine, prev []byte) []byte {
+	var ev AuditEvent
+	var err error
+	switch {
+	case line.Event == nil:
+		ev, err = openAuditEvent(keys, line.Seq, line.Sealed)
+	case encrypted:
+		err = errors.New("unencrypted record in an encrypted file")
+	default:
+		err = json.Unmarshal(line.Event, &ev)
+	}
+	if err != nil {
+		report.problem("%s: %v", where, err)
+		return prev
+	}
+	if ev.Seq != line.Seq || ev.Prev != hex.EncodeToString(prev) {
+		report.problem("%s: record %d is not chained to the previous record", where, line.Seq)
+		if h, err := hex.DecodeString(ev.Prev); err == nil {
+			prev = h
+		}
+	}
+	switch {
+	case line.MAC == "":
+		report.Unsigned++
+		if ev.Op != AuditUnlockFailed {
+			report.problem("%s: unsigned %s record %d", where, ev.Op, line.Seq)
+		}
+	case !hmac.Equal([]byte(line.MAC), []byte(auditMAC(keys.mac, line.Seq, line.Sealed))):
+		report.problem("%s: record %d signature is invalid", where, line.Seq)
+	}
+	if ev.Op == AuditLogReset {
+		report.problem("%s: record %d: log was reset: %s", where, line.Seq, ev.Detail)
+	}
+	report.Events = append(report.Events, ev)
+	return prev
+}
+
+// Алгоритм работы функции:
+//
+// 1. Вывести ключи журнала: дальше записи подписываются
+// 2. Сверить журнал с якорем в хранилище; журнал короче якоря или с другой последней
+//    записью удалили или обрезали - записать это в журнал, проверка его покажет
+// 3. Подключить журнал к менеджеру
+
+func (pm *PasswordManager) attachAudit(l *AuditLog) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := pm.passInit(); err != nil {
+		return err
+	}
+
+	// 1
+	if err := l.unlock(pm.masterKey); err != nil {
+		return err
+	}
+
+	// 2
+	if anchor, ok := parseAuditAnchor(pm.meta[l.anchorID()]); ok {
+		head := l.head()
+		var detail string
+		switch {
+		case anchor.Seq > head.Seq:
+			detail = fmt.Sprintf("log ends at record %d, the vault was saved at record %d", head.Seq, anchor.Seq)
+		case anchor.Seq == head.Seq && anchor.Hash != head.Hash:
+			detail = fmt.Sprintf("record %d does not match the vault", head.Seq)
+		}
+		if detail != "" {
+			if err := l.Append(AuditEvent{Op: AuditLogReset, Detail: detail, Source: pm.auditSource}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 3
+	pm.audit = l
+	return nil
+}
+
+// ID служебной записи с якорем этого журнала
+func (l *AuditLog) anchorID() string {
+	sum := sha256.Sum256([]byte(l.user + "\n" + l.path))
+	return auditAnchorPrefix + hex.EncodeToString(sum[:16])
+}
+
+// Номер и хеш последней записи
+func (l *AuditLog) head() AuditAnchor {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return AuditAnchor{Seq: l.lastSeq, Hash: hex.EncodeToString(l.lastHash)}
+}
+
+// Служебные записи хранилища не показываются как записи и не участвуют в сравнении версий
+func isVaultMeta(id string) bool {
+	return strings.HasPrefix(id, auditAnchorPrefix)
+}
+
+func parseAuditAnchor(p Password) (AuditAnchor, bool) {
+	if p.Kind != auditAnchorKind {
+		return AuditAnchor{}, false
+	}
+	seq, err := strconv.ParseUint(p.Fields["seq"], 10, 64)
+	return AuditAnchor{Seq: seq, Hash: p.Fields["hash"]}, err == nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Без подключённого журнала служебные записи сохраняются как были
+// 2. Якорь не изменился - оставить запись как есть, иначе время изменения
+//    сдвигало бы её при каждом сохранении
+// 3. Записать в данные номер и хеш последней записи журнала
+//
+// Вызывается под pm.mu
+
+func (pm *PasswordManager) vaultDataLocked() map[string]Password {
+	data := make(map[string]Password, len(pm.passwords)+len(pm.meta)+1)
+	for id, p := range pm.passwords {
+		data[id] = p
+	}
+	for id, p := range pm.meta {
+		data[id] = p
+	}
+
+	// 1
+	if pm.audit == nil {
+		return data
+	}
+
+	// 2
+	id := pm.audit.anchorID()
+	head := pm.audit.head()
+	if old, ok := parseAuditAnchor(pm.meta[id]); ok && old == head {
+		return data
+	}
+
+	// 3
+	data[id] = Password{
+		ID:           id,
+		Name:         "audit log " + pm.audit.user,
+		Kind:         auditAnchorKind,
+		Fields:       map[string]string{"seq": strconv.FormatUint(head.Seq, 10), "hash": head.Hash},
+		LastModified: time.Now(),
+	}
+	return data
+}
+
+// Разделить данные хранилища на записи и служебные записи
+func splitVaultMeta(data map[string]Password) (entries, meta map[string]Password) {
+	entries = make(map[string]Password, len(data))
+	meta = make(map[string]Password)
+	for id, p := range data {
+		if isVaultMeta(id) {
+			meta[id] = p
+		} else {
+			entries[id] = p
+		}
+	}
+	return entries, meta
+}
+
+// Якорь журнала в данных хранилища; nil - хранилище ещё не сохранялось с журналом
+func (pm *PasswordManager) AuditAnchor() *AuditAnchor {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.audit == nil {
+		return nil
+	}
+	if anchor, ok := parseAuditAnchor(pm.meta[pm.audit.anchorID()]); ok {
+		return &anchor
+	}
+	return nil
+}
+
+func (pm *PasswordManager) Audit() *AuditLog {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.audit
+}
+
+// Источник следующих операций, например api:<токен> на время запроса
+func (pm *PasswordManager) SetAuditSource(source string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.auditSource = source
+}
+
+// Записать событие; вызывается под pm.mu. Операция выполняется, только если запись удалась
+func (pm *PasswordManager) auditLocked(ev AuditEvent) error {
+	if pm.audit == nil {
+		return nil
+	}
+	if ev.Source == "" {
+		ev.Source = pm.auditSource
+	}
+	return pm.audit.Append(ev)
+}
+
+// Событие, которое менеджер не видит сам: показ записи на экране, копирование, экспорт
+func (pm *PasswordManager) RecordAudit(ev AuditEvent) error {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.auditLocked(ev)
+}
+
+// Записать изменения между двумя версиями записей (слияние, импорт)
+func (pm *PasswordManager) auditChangesLocked(before, after map[string]Password, detail string) error {
+	ops := map[string]string{"add": AuditAdd, "update": AuditUpdate, "remove": AuditDelete}
+	for _, c := range diffEntries(before, after) {
+		if err := pm.auditLocked(AuditEvent{Op: ops[c.Op], EntryID: c.ID, Entry: c.Name, Detail: detail}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Названия изменённых полей записи; значения в журнал не попадают
+func changedFields(old, p Password) string {
+	var fields []string
+	for _, f := range []struct {
+		name    string
+		changed bool
+	}{
+		{"name", old.Name != p.Name},
+		{"category", old.Category != p.Category},
+		{"kind", old.Kind != p.Kind},
+		{"value", old.Value != p.Value},
+		{"username", old.Username != p.Username},
+		{"url", old.URL != p.URL},
+		{"notes", old.Notes != p.Notes},
+		{"tags", !slices.Equal(old.Tags, p.Tags)},
+	} {
+		if f.changed {
+			fields = append(fields, f.name)
+		}
+	}
+	var extra []string
+	for key := range p.Fields {
+		if old.Fields[key] != p.Fields[key] {
+			extra = append(extra, key)
+		}
+	}
+	for key := range old.Fields {
+		if _, ok := p.Fields[key]; !ok {
+			extra = append(extra, key)
+		}
+	}
+	slices.Sort(extra)
+	fields = append(fields, extra...)
+	return strings.Join(fields, ", ")
+}
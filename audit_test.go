@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Разблокированный менеджер в памяти с журналом аудита хранилища "main"
+func openAuditedVault(t *testing.T, store VaultStore) *PasswordManager {
+	t.Helper()
+	l, err := OpenAuditLog("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := NewPasswordManagerWithStore(store)
+	if err := pm.SetMasterPassword("masterpass1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.LoadFromFile(); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if err := pm.attachAudit(l); err != nil {
+		t.Fatal(err)
+	}
+	return pm
+}
+
+func verifyAudit(t *testing.T, pm *PasswordManager) *AuditReport {
+	t.Helper()
+	report, err := pm.Audit().Verify(pm.AuditAnchor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// Журнал с тремя записями, сохранённый вместе с хранилищем
+func auditedVault(t *testing.T) (VaultStore, string) {
+	t.Helper()
+	testHome(t)
+	store := newMemoryStore()
+	pm := openAuditedVault(t, store)
+	for _, name := range []string{"github", "gitlab"} {
+		if err := pm.SavePassword(name, "Secret#Pass1", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pm.GetPassword("github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+	path, err := auditLogPath("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, path
+}
+
+func TestAuditVerifyIntact(t *testing.T) {
+	store, _ := auditedVault(t)
+	report := verifyAudit(t, openAuditedVault(t, store))
+	if len(report.Problems) > 0 || report.Records != 3 {
+		t.Fatalf("records %d, problems %v", report.Records, report.Problems)
+	}
+	ops := make([]string, len(report.Events))
+	for i, ev := range report.Events {
+		ops[i] = ev.Op
+	}
+	if want := []string{AuditAdd, AuditAdd, AuditGet}; !slices.Equal(ops, want) {
+		t.Fatalf("ops %v, want %v", ops, want)
+	}
+}
+
+func TestAuditVerifyTampered(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(data []byte) []byte
+		want   string
+	}{
+		{"deleted record", func(data []byte) []byte {
+			lines := bytes.SplitAfter(data, []byte("\n"))
+			return bytes.Join(append(lines[:2:2], lines[3:]...), nil)
+		}, "follows"},
+		{"edited record", func(data []byte) []byte {
+			// Заменить символ base64 другим допустимым символом
+			i := bytes.LastIndex(data, []byte(`"sealed":"`)) + 20
+			if data[i] == 'A' {
+				data[i] = 'B'
+			} else {
+				data[i] = 'A'
+			}
+			return data
+		}, "record 3"},
+		{"truncated", func(data []byte) []byte {
+			lines := bytes.SplitAfter(data, []byte("\n"))
+			return bytes.Join(lines[:len(lines)-2], nil)
+		}, "log was reset"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store, path := auditedVault(t)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.tamper(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			report := verifyAudit(t, openAuditedVault(t, store))
+			if !strings.Contains(strings.Join(report.Problems, "\n"), tc.want) {
+				t.Fatalf("problems %q, want %q", report.Problems, tc.want)
+			}
+		})
+	}
+}
+
+// Старый .head с верной подписью вместе с обрезанным журналом выдаёт якорь в хранилище
+func TestAuditVerifyReplayedHead(t *testing.T) {
+	testHome(t)
+	store := newMemoryStore()
+	pm := openAuditedVault(t, store)
+	if err := pm.SavePassword("github", "Secret#Pass1", ""); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := auditLogPath("main")
+	oldLog, _ := os.ReadFile(path)
+	oldHead, _ := os.ReadFile(pm.Audit().headPath())
+
+	if err := pm.SavePassword("gitlab", "Secret#Pass1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, oldLog, 0600)
+	os.WriteFile(pm.Audit().headPath(), oldHead, 0600)
+
+	report := verifyAudit(t, openAuditedVault(t, store))
+	problems := strings.Join(report.Problems, "\n")
+	if !strings.Contains(problems, "log was reset") || !strings.Contains(problems, "record 2 does not match the vault") {
+		t.Fatalf("problems %q", report.Problems)
+	}
+}
+
+// Удалённые журнал и .head: при разблокировке записывается log-reset
+func TestAuditVerifyDeletedLog(t *testing.T) {
+	store, path := auditedVault(t)
+	os.Remove(path)
+	os.Remove(strings.TrimSuffix(path, auditLogExt) + auditHeadExt)
+
+	report := verifyAudit(t, openAuditedVault(t, store))
+	if len(report.Events) != 1 || report.Events[0].Op != AuditLogReset {
+		t.Fatalf("events %+v", report.Events)
+	}
+	if !strings.Contains(strings.Join(report.Problems, "\n"), "truncated") {
+		t.Fatalf("problems %q", report.Problems)
+	}
+}
+
+// Неудачная разблокировка до первой удачной записывается и потом проверяется
+func TestAuditUnlockFailedBeforeFirstUnlock(t *testing.T) {
+	testHome(t)
+	l, err := OpenAuditLog("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(AuditEvent{Op: AuditUnlockFailed, Detail: ErrMasterPassword.Error()}); err != nil {
+		t.Fatal(err)
+	}
+
+	report := verifyAudit(t, openAuditedVault(t, newMemoryStore()))
+	if len(report.Problems) > 0 || report.Unsigned != 1 || report.Events[0].Op != AuditUnlockFailed {
+		t.Fatalf("report %+v", report)
+	}
+}
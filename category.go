@@ -1,10 +1,114 @@
 package main
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Категория записи - путь папки с уровнями через "/": work/aws/prod.
+// Пути сравниваются без учёта регистра и лишних пробелов, поэтому Work, work и " work "
+// - одна папка; отображается написание самой старой записи
+const folderSeparator = "/"
+
+// Путь без пробелов по краям уровней, повторных пробелов внутри и пустых уровней:
+// " Work / AWS//prod " -> "Work/AWS/prod"
+func NormalizeFolder(path string) string {
+	segs := make([]string, 0, strings.Count(path, folderSeparator)+1)
+	for _, s := range strings.Split(path, folderSeparator) {
+		if s = strings.Join(strings.Fields(s), " "); s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return strings.Join(segs, folderSeparator)
+}
+
+// Ключ для сравнения папок
+func folderKey(path string) string {
+	return strings.ToLower(NormalizeFolder(path))
+}
+
+// Лежит ли запись из папки path в папке folder или во вложенной в неё; корень ("") содержит всё
+func inFolder(path, folder string) bool {
+	f := folderKey(folder)
+	if f == "" {
+		return true
+	}
+	k := folderKey(path)
+	return k == f || strings.HasPrefix(k, f+folderSeparator)
+}
+
+// Написание уровней папок, как они уже есть в хранилище: ключ пути до уровня -> написание уровня
+type folderSpellings map[string]string
+
+func (s folderSpellings) add(path string) {
+	segs := strings.Split(NormalizeFolder(path), folderSeparator)
+	for i, seg := range segs {
+		if seg == "" {
+			continue
+		}
+		key := strings.ToLower(strings.Join(segs[:i+1], folderSeparator))
+		if _, ok := s[key]; !ok {
+			s[key] = seg
+		}
+	}
+}
+
+// Путь с уровнями в уже принятом написании; новые уровни остаются как есть
+func (s folderSpellings) canonical(path string) string {
+	path = NormalizeFolder(path)
+	if path == "" {
+		return ""
+	}
+	segs := strings.Split(path, folderSeparator)
+	for i := range segs {
+		if seg, ok := s[strings.ToLower(strings.Join(segs[:i+1], folderSeparator))]; ok {
+			segs[i] = seg
+		}
+	}
+	return strings.Join(segs, folderSeparator)
+}
+
+// Написания папок хранилища; побеждает самая старая запись. Вызывается под pm.mu.
+// skip - папка, записи которой не учитываются (переименовываемая)
+func (pm *PasswordManager) folderSpellingsLocked(skip string) folderSpellings {
+	entries := make([]Password, 0, len(pm.passwords))
+	for _, p := range pm.passwords {
+		if skip == "" || !inFolder(p.Category, skip) {
+			entries = append(entries, p)
+		}
+	}
+	slices.SortFunc(entries, func(a, b Password) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	s := make(folderSpellings)
+	for _, p := range entries {
+		s.add(p.Category)
+	}
+	return s
+}
+
+// Папка для новой записи: нормализованный путь в написании, которое уже есть в хранилище
+func (pm *PasswordManager) canonicalFolderLocked(path string) string {
+	return pm.folderSpellingsLocked("").canonical(path)
+}
+
+func (pm *PasswordManager) CanonicalFolder(path string) string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.canonicalFolderLocked(path)
+}
+
 // Алгоритм работы функции:
 //
 // 1. Создать пустой слайс для хранения результатов
 // 2. Пройти по всем паролям в хранилище
-// 3. Сравнить категории и если совпадает добавить в результат
+// 3. Сравнить папки без учёта регистра и пробелов, и если совпадает добавить в результат
 // 4. Вернуть список найденных паролей
 
 func (pm *PasswordManager) GetPasswordsByCategory(category string) []Password {
@@ -13,11 +117,12 @@ func (pm *PasswordManager) GetPasswordsByCategory(category string) []Password {
 
 	// 1
 	res := make([]Password, 0, len(pm.passwords))
+	key := folderKey(category)
 
 	// 2
 	for _, v := range pm.passwords {
 		// 3
-		if v.Category == category {
+		if folderKey(v.Category) == key {
 			res = append(res, v)
 		}
 
@@ -26,35 +131,256 @@ func (pm *PasswordManager) GetPasswordsByCategory(category string) []Password {
 	return res
 }
 
+// Записи папки вместе с вложенными папками в порядке имён
+func (pm *PasswordManager) GetPasswordsInFolder(folder string) []Password {
+	var res []Password
+	for _, p := range pm.ListPasswords() {
+		if inFolder(p.Category, folder) {
+			res = append(res, p)
+		}
+	}
+	sortEntries(res)
+	return res
+}
+
 //Алгоритм работы функции:
 //
-// 1. Создать карту для отслеживания уникальных категорий:
-// 2. Пройти по всем паролям и добавить их категории в карту
-// 3. Преобразовать ключи карты в слайс строк
-// 4. Вернуть список уникальных категорий
+// 1. Собрать написания папок хранилища
+// 2. Пройти по всем паролям и добавить их папки в карту по ключу сравнения
+// 3. Преобразовать значения карты в слайс строк
+// 4. Вернуть отсортированный список уникальных категорий
 
 func (pm *PasswordManager) ListCategories() []string {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 
 	// 1
-	// Создали мапу для отслеживания категорий, если true - значит категория найдена
-	categories := make(map[string]bool)
+	spell := pm.folderSpellingsLocked("")
+	// Ключ папки -> написание для вывода
+	categories := make(map[string]string)
 	// Создали результирующий слайс для возврата данных
 	res := make([]string, 0, len(pm.passwords))
 
 	// 2
 	for _, v := range pm.passwords {
-		// Получаем категорию и добавляем ее в map как ключ со значением true
-		categories[v.Category] = true
+		categories[folderKey(v.Category)] = spell.canonical(v.Category)
 	}
 
 	// 3
-	for k := range categories {
-		// ключ (категорию) добавляем в слайс
-		res = append(res, k)
+	for _, v := range categories {
+		res = append(res, v)
 	}
 
 	// 4
+	slices.SortFunc(res, func(a, b string) int { return strings.Compare(strings.ToLower(a), strings.ToLower(b)) })
 	return res
 }
+
+// Узел дерева папок
+type FolderNode struct {
+	// Имя уровня и полный путь; у корня оба пустые
+	Name string
+	Path string
+	// Записи прямо в папке и вместе с вложенными
+	Entries  int
+	Total    int
+	Children []*FolderNode
+}
+
+// Алгоритм работы функции:
+//
+// 1. Собрать написания папок хранилища
+// 2. Для каждой записи пройти по уровням её папки, создавая недостающие узлы и считая записи
+// 3. Отсортировать вложенные папки по имени
+
+func (pm *PasswordManager) FolderTree() *FolderNode {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	// 1
+	spell := pm.folderSpellingsLocked("")
+	root := &FolderNode{}
+
+	// 2
+	for _, p := range pm.passwords {
+		node := root
+		node.Total++
+		if path := spell.canonical(p.Category); path != "" {
+			for _, seg := range strings.Split(path, folderSeparator) {
+				node = node.child(seg)
+				node.Total++
+			}
+		}
+		node.Entries++
+	}
+
+	// 3
+	root.sort()
+	return root
+}
+
+func (n *FolderNode) child(name string) *FolderNode {
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	path := name
+	if n.Path != "" {
+		path = n.Path + folderSeparator + name
+	}
+	c := &FolderNode{Name: name, Path: path}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *FolderNode) sort() {
+	slices.SortFunc(n.Children, func(a, b *FolderNode) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// Строки дерева для вывода:
+//
+//	├── personal (1)
+//	└── work (3)
+//	    ├── aws (2)
+//	    │   └── prod (1)
+//	    └── gitlab (1)
+func (n *FolderNode) Lines() []string {
+	var lines []string
+	var walk func(node *FolderNode, prefix string)
+	walk = func(node *FolderNode, prefix string) {
+		for i, c := range node.Children {
+			branch, next := "├── ", "│   "
+			if i == len(node.Children)-1 {
+				branch, next = "└── ", "    "
+			}
+			lines = append(lines, fmt.Sprintf("%s%s%s (%d)", prefix, branch, c.Name, c.Total))
+			walk(c, prefix+next)
+		}
+	}
+	walk(n, "")
+	return lines
+}
+
+// Алгоритм работы функции:
+//
+// 1. Нормализовать пути; корень переименовать нельзя, как и перенести папку в саму себя
+// 2. Привести новый путь к написанию папок, которые остаются на месте
+// 3. У записей папки и вложенных папок заменить начало пути, остаток пути сохраняется
+// 4. Записать перенос всех записей в журнал аудита и только затем сохранить их с новым
+//    временем изменения, чтобы ошибка журнала не оставила папку перенесённой наполовину;
+//    вернуть количество перенесённых записей
+
+func (pm *PasswordManager) RenameFolder(from, to string) (int, error) {
+	// 1
+	from, to = NormalizeFolder(from), NormalizeFolder(to)
+	if from == "" || to == "" {
+		return 0, fmt.Errorf("%w: folder path is empty", ErrFolderNotFound)
+	}
+	if !strings.EqualFold(from, to) && inFolder(to, from) {
+		return 0, fmt.Errorf("cannot move folder %q into itself", from)
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := pm.passInit(); err != nil {
+		return 0, err
+	}
+
+	// 2
+	to = pm.folderSpellingsLocked(from).canonical(to)
+	depth := strings.Count(from, folderSeparator) + 1
+
+	// 3
+	now := time.Now()
+	moved := make(map[string]Password)
+	for id, p := range pm.passwords {
+		if !inFolder(p.Category, from) {
+			continue
+		}
+		segs := strings.Split(NormalizeFolder(p.Category), folderSeparator)
+		p.Category = strings.Join(append([]string{to}, segs[depth:]...), folderSeparator)
+		p.LastModified = now
+		moved[id] = p
+	}
+	if len(moved) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrFolderNotFound, from)
+	}
+
+	// 4
+	if err := pm.applyFolderChangesLocked(moved); err != nil {
+		return 0, err
+	}
+	return len(moved), nil
+}
+
+// Записать изменение папок в журнал аудита для всех записей, затем сохранить записи.
+// Вызывается под pm.mu
+func (pm *PasswordManager) applyFolderChangesLocked(changed map[string]Password) error {
+	for _, p := range changed {
+		if err := pm.auditLocked(auditEntry(AuditUpdate, p, "category")); err != nil {
+			return err
+		}
+	}
+	for id, p := range changed {
+		pm.passwords[id] = p
+	}
+	return nil
+}
+
+// Перенос папки со всем содержимым в другую папку; parent "" - в корень.
+// Имя папки сохраняет написание, которое уже есть в хранилище
+func (pm *PasswordManager) MoveFolder(from, parent string) (int, error) {
+	from = pm.CanonicalFolder(from)
+	name := from[strings.LastIndex(from, folderSeparator)+1:]
+	if parent = NormalizeFolder(parent); parent != "" {
+		name = parent + folderSeparator + name
+	}
+	return pm.RenameFolder(from, name)
+}
+
+// Перенос одной записи в папку; folder "" - в корень
+func (pm *PasswordManager) MoveEntry(entry, folder string) error {
+	_, _, err := pm.EditEntry(entry, EntryPatch{Category: &folder})
+	return err
+}
+
+// Алгоритм работы функции:
+//
+// 1. Собрать написания папок хранилища (побеждает самая старая запись)
+// 2. Найти записи, у которых папка отличается от принятого написания
+// 3. Записать изменения в журнал аудита, сохранить записи и вернуть их количество
+
+func (pm *PasswordManager) NormalizeFolders() (int, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := pm.passInit(); err != nil {
+		return 0, err
+	}
+
+	// 1
+	spell := pm.folderSpellingsLocked("")
+
+	// 2
+	now := time.Now()
+	changed := make(map[string]Password)
+	for id, p := range pm.passwords {
+		if folder := spell.canonical(p.Category); folder != p.Category {
+			p.Category, p.LastModified = folder, now
+			changed[id] = p
+		}
+	}
+
+	// 3
+	if err := pm.applyFolderChangesLocked(changed); err != nil {
+		return 0, err
+	}
+	return len(changed), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ошибка журнала аудита не оставляет папку перенесённой наполовину
+func TestRenameFolderAuditFailure(t *testing.T) {
+	testHome(t)
+	store, err := OpenVaultStore("mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := openAuditedVault(t, store)
+	for _, name := range []string{"aws", "gitlab", "jira"} {
+		if err := pm.SavePassword(name, "Secret#Pass1", "work"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pm.SavePassword("bank", "Secret#Pass1", "Personal"); err != nil {
+		t.Fatal(err)
+	}
+	pm.audit.path = filepath.Join(t.TempDir(), "missing", "main.log")
+
+	if _, err := pm.RenameFolder("work", "job"); err == nil {
+		t.Fatal("rename succeeded with a broken audit log")
+	}
+	if got := len(pm.GetPasswordsInFolder("work")); got != 3 {
+		t.Errorf("after failed rename: %d entries left in work, want 3", got)
+	}
+
+	p := pm.passwords[pm.GetPasswordsInFolder("work")[0].ID]
+	p.Category = "WORK"
+	pm.passwords[p.ID] = p
+	if _, err := pm.NormalizeFolders(); err == nil {
+		t.Fatal("normalize succeeded with a broken audit log")
+	}
+	if got := pm.passwords[p.ID].Category; got != "WORK" {
+		t.Errorf("after failed normalize: category %q, want WORK", got)
+	}
+}
+
+func TestNormalizeFolder(t *testing.T) {
+	for in, want := range map[string]string{
+		"work":                 "work",
+		" Work / AWS//prod ":   "Work/AWS/prod",
+		"work/  dev   tools /": "work/dev tools",
+		"/":                    "",
+		"":                     "",
+	} {
+		if got := NormalizeFolder(in); got != want {
+			t.Errorf("NormalizeFolder(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestInFolder(t *testing.T) {
+	tests := []struct {
+		path, folder string
+		want         bool
+	}{
+		{"work/aws", "work", true},
+		{"Work/AWS/prod", "work/aws", true},
+		{" work ", "WORK", true},
+		{"work", "work/aws", false},
+		{"workshop", "work", false},
+		{"personal", "work", false},
+		{"anything", "", true},
+	}
+	for _, tt := range tests {
+		if got := inFolder(tt.path, tt.folder); got != tt.want {
+			t.Errorf("inFolder(%q, %q) = %v, want %v", tt.path, tt.folder, got, tt.want)
+		}
+	}
+}
+
+// Менеджер с записями в папках; записи создаются по порядку, первая - самая старая
+func folderManager(t *testing.T, folders map[string]string, order ...string) *PasswordManager {
+	t.Helper()
+	pm := testManager(t)
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, name := range order {
+		if err := pm.SavePassword(name, "Secret#Pass1", folders[name]); err != nil {
+			t.Fatal(err)
+		}
+		p, err := pm.GetPassword(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// SavePassword приводит папку к уже принятому написанию - вернуть исходное
+		p.Category = folders[name]
+		p.CreatedAt = created.Add(time.Duration(i) * time.Hour)
+		pm.passwords[p.ID] = p
+	}
+	return pm
+}
+
+func folderOf(t *testing.T, pm *PasswordManager, name string) string {
+	t.Helper()
+	p, err := pm.GetPassword(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Category
+}
+
+// Переименование и перенос затрагивают вложенные папки и сохраняют остаток пути
+func TestRenameAndMoveFolder(t *testing.T) {
+	pm := folderManager(t, map[string]string{
+		"console": "work/aws/prod",
+		"s3":      "work/aws",
+		"gitlab":  "work",
+		"bank":    "personal",
+		"shop":    "workshop",
+	}, "console", "s3", "gitlab", "bank", "shop")
+
+	moved, err := pm.RenameFolder(" Work ", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 3 {
+		t.Errorf("rename moved %d entries, want 3", moved)
+	}
+	for name, want := range map[string]string{"console": "job/aws/prod", "s3": "job/aws", "gitlab": "job", "shop": "workshop"} {
+		if got := folderOf(t, pm, name); got != want {
+			t.Errorf("after rename: %s in %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := pm.RenameFolder("job", "job/aws/old"); err == nil {
+		t.Error("folder moved into itself")
+	}
+	if _, err := pm.RenameFolder("missing", "other"); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("missing folder: got %v, want ErrFolderNotFound", err)
+	}
+
+	if moved, err = pm.MoveFolder("job/aws", "personal"); err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Errorf("move moved %d entries, want 2", moved)
+	}
+	for name, want := range map[string]string{"console": "personal/aws/prod", "s3": "personal/aws", "gitlab": "job"} {
+		if got := folderOf(t, pm, name); got != want {
+			t.Errorf("after move: %s in %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := pm.MoveFolder("personal/aws", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := folderOf(t, pm, "console"); got != "aws/prod" {
+		t.Errorf("after move to root: console in %q, want aws/prod", got)
+	}
+}
+
+// Написание папки берётся у самой старой записи: в списке, для новых записей,
+// при переименовании в существующую папку и при нормализации
+func TestFolderSpelling(t *testing.T) {
+	pm := folderManager(t, map[string]string{
+		"gitlab":  "Work/Dev",
+		"jira":    "work/dev",
+		"console": "WORK/aws",
+		"tmp":     "scratch",
+	}, "gitlab", "jira", "console", "tmp")
+
+	if got := pm.ListCategories(); !slices.Equal(got, []string{"scratch", "Work/aws", "Work/Dev"}) {
+		t.Errorf("categories %q", got)
+	}
+	if got := pm.CanonicalFolder(" work / DEV / new "); got != "Work/Dev/new" {
+		t.Errorf("canonical folder %q, want Work/Dev/new", got)
+	}
+
+	if _, err := pm.RenameFolder("scratch", "WORK/dev"); err != nil {
+		t.Fatal(err)
+	}
+	if got := folderOf(t, pm, "tmp"); got != "Work/Dev" {
+		t.Errorf("renamed into existing folder: %q, want Work/Dev", got)
+	}
+
+	changed, err := pm.NormalizeFolders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("normalize changed %d entries, want 2", changed)
+	}
+	for _, name := range []string{"jira", "console"} {
+		if got := folderOf(t, pm, name); !strings.HasPrefix(got, "Work/") {
+			t.Errorf("after normalize: %s in %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,1791 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Подкоманды командной строки. Без подкоманды запускается интерактивное меню
+//
+//	PasswordManager vaults list
+//	PasswordManager vaults create NAME [URI]
+//	PasswordManager vaults remove NAME
+//	PasswordManager vaults default NAME
+//	PasswordManager config show
+//	PasswordManager config get KEY
+//	PasswordManager config set KEY VALUE
+//	PasswordManager [--vault NAME] sync
+//	PasswordManager [--vault NAME] log [N]
+//	PasswordManager [--vault NAME] merge OTHER [--base BASE]
+//	PasswordManager identity create [NAME]
+//	PasswordManager identity show
+//	PasswordManager [--vault NAME] member list
+//	PasswordManager [--vault NAME] member add NAME PUBLIC_KEY [rw|ro]
+//	PasswordManager [--vault NAME] member remove NAME
+//	PasswordManager [--vault NAME] share ENTRY --to PUBLIC_KEY [--expires 24h] [--out FILE]
+//	PasswordManager [--vault NAME] receive [FILE] [--on-conflict rename]
+//	PasswordManager tokens list
+//	PasswordManager tokens create NAME [--read-only] [--category CAT,...]
+//	PasswordManager tokens revoke NAME
+//	PasswordManager [--vault NAME] serve [--listen 127.0.0.1:7878 | --socket PATH] [--access-log PATH]
+//	PasswordManager native-host
+//	PasswordManager native-host manifest chrome|firefox EXTENSION_ID
+//	PasswordManager [--vault NAME] git-credential get|store|erase
+//	PasswordManager [--vault NAME] docker-credential get|store|erase|list
+//	docker-credential-passwordmanager get|store|erase|list
+//	PasswordManager [--vault NAME] run --env VAR=ENTRY[#field] ... -- COMMAND [ARGS]
+//	PasswordManager [--vault NAME] inject [TEMPLATE] [-o FILE] [--strict]
+//	PasswordManager [--vault NAME] ssh-key generate NAME [--type ed25519|ecdsa|rsa]
+//	PasswordManager [--vault NAME] ssh-key import NAME FILE
+//	PasswordManager [--vault NAME] ssh-key public NAME
+//	PasswordManager [--vault NAME] ssh-agent [--socket PATH] [--confirm]
+//	PasswordManager [--vault NAME] attach add ENTRY FILE [--name NAME]
+//	PasswordManager [--vault NAME] attach list [ENTRY]
+//	PasswordManager [--vault NAME] attach extract ENTRY NAME [-o FILE|-]
+//	PasswordManager [--vault NAME] attach remove ENTRY NAME
+//	PasswordManager [--vault NAME] folders [tree]
+//	PasswordManager [--vault NAME] folders list FOLDER
+//	PasswordManager [--vault NAME] folders rename FROM TO
+//	PasswordManager [--vault NAME] folders move FROM PARENT
+//	PasswordManager [--vault NAME] folders move-entry ENTRY FOLDER
+//	PasswordManager [--vault NAME] folders normalize
+//	PasswordManager [--vault NAME] audit-log show [N] [--op OP] [--entry ENTRY]
+//	PasswordManager [--vault NAME] audit-log verify
+//	PasswordManager [--vault NAME] audit-log rotate
+
+func runCommand(reg *VaultRegistry, configPath string, args []string) error {
+	if isNativeMessagingLaunch(args) {
+		messageOutput = os.Stderr
+		auditSource = "native-host"
+		return runNativeHost(reg, os.Stdin, os.Stdout)
+	}
+	if isDockerCredentialLaunch() {
+		auditSource = "docker-credential"
+		return runDockerCredentialCommand(reg, args)
+	}
+
+	auditSource = args[0]
+	switch args[0] {
+	case "vaults":
+		return runVaultsCommand(reg, args[1:])
+	case "config":
+		return runConfigCommand(configPath, args[1:])
+	case "sync":
+		return runSyncCommand(reg)
+	case "log":
+		return runLogCommand(reg, args[1:])
+	case "merge":
+		return runMergeCommand(reg, args[1:])
+	case "identity":
+		return runIdentityCommand(args[1:])
+	case "member":
+		return runMemberCommand(reg, args[1:])
+	case "share":
+		return runShareCommand(reg, args[1:])
+	case "receive":
+		return runReceiveCommand(reg, args[1:])
+	case "tokens":
+		return runTokensCommand(args[1:])
+	case "serve":
+		return runServeCommand(reg, args[1:])
+	case "native-host":
+		return runNativeHostCommand(reg, args[1:])
+	case "git-credential":
+		return runGitCredentialCommand(reg, args[1:])
+	case "docker-credential":
+		return runDockerCredentialCommand(reg, args[1:])
+	case "run":
+		return runRunCommand(reg, args[1:])
+	case "inject":
+		return runInjectCommand(reg, args[1:])
+	case "ssh-key":
+		return runSSHKeyCommand(reg, args[1:])
+	case "ssh-agent":
+		return runSSHAgentCommand(reg, args[1:])
+	case "attach":
+		return runAttachCommand(reg, args[1:])
+	case "folders":
+		return runFoldersCommand(reg, args[1:])
+	case "audit-log":
+		return runAuditLogCommand(reg, args[1:])
+	}
+
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func runVaultsCommand(reg *VaultRegistry, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		return vaultsList(reg)
+	case "create":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: vaults create NAME [URI]")
+		}
+		uri := ""
+		if len(args) == 3 {
+			uri = args[2]
+		}
+		return vaultsCreate(reg, args[1], uri)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: vaults remove NAME")
+		}
+		return vaultsRemove(reg, args[1])
+	case "default":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: vaults default NAME")
+		}
+		if err := reg.SetDefault(args[1]); err != nil {
+			return err
+		}
+		return reg.Save()
+	}
+
+	return fmt.Errorf("unknown vaults command %q (list, create, remove, default)", args[0])
+}
+
+func vaultsList(reg *VaultRegistry) error {
+	if len(reg.Vaults) == 0 {
+		fmt.Println("No vaults registered. Run 'vaults create NAME' to add one")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tLOCATION\tCREATED")
+	for _, v := range reg.Vaults {
+		mark := ""
+		if v.Name == reg.Default {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, v.Name, v.URI, v.CreatedAt.Format("2006-01-02"))
+	}
+	return w.Flush()
+}
+
+// Алгоритм работы функции:
+//
+// 1. Зарегистрировать хранилище
+// 2. Если данных по адресу ещё нет - запросить новый мастер-пароль дважды и записать пустое хранилище.
+//    Командное хранилище открывается личностью, поэтому нужен только пароль личности
+// 3. Сохранить реестр
+
+func vaultsCreate(reg *VaultRegistry, name, uri string) error {
+	// 1
+	entry, err := reg.Add(name, uri)
+	if err != nil {
+		return err
+	}
+
+	// 2
+	sess, err := openVaultSession(reg, entry.Name)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	info, err := sess.Store.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Exists {
+		fmt.Printf("Registered existing vault %q at %s\n", entry.Name, info.URI)
+	} else {
+		var masterPassword string
+		if _, ok := sess.Store.(*teamStore); ok {
+			fmt.Print("Enter identity passphrase: ")
+			masterPassword, err = readPassword()
+		} else {
+			masterPassword, err = readNewMasterPassword()
+		}
+		if err != nil {
+			return err
+		}
+		if err := sess.Open(masterPassword); err != nil {
+			return err
+		}
+		if err := sess.PM.SaveToFile(); err != nil {
+			return err
+		}
+		fmt.Printf("Created vault %q at %s\n", entry.Name, info.URI)
+	}
+
+	// 3
+	return reg.Save()
+}
+
+func vaultsRemove(reg *VaultRegistry, name string) error {
+	entry, err := reg.Remove(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, name)
+	}
+	if err := reg.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Vault %q removed from the registry. Its data was kept at %s\n", entry.Name, entry.URI)
+	return nil
+}
+
+func runConfigCommand(configPath string, args []string) error {
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+
+	switch args[0] {
+	case "show":
+		return configShow(configPath)
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: config get KEY")
+		}
+		value, err := appConfig.Get(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: config set KEY VALUE")
+		}
+		return configSet(configPath, args[1], args[2])
+	}
+
+	return fmt.Errorf("unknown config command %q (show, get, set)", args[0])
+}
+
+// Действующие настройки с учётом файла, переменных окружения и флагов
+func configShow(configPath string) error {
+	fmt.Printf("# %s\n", configPath)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, s := range configSettings {
+		fmt.Fprintf(w, "%s\t= %s\t# %s\n", s.key, s.get(&appConfig), s.envName())
+	}
+	return w.Flush()
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать только файл настроек, без переменных окружения и флагов,
+//    чтобы временные переопределения не попали в файл
+// 2. Изменить значение и проверить согласованность
+// 3. Записать файл
+
+func configSet(configPath, key, value string) error {
+	// 1
+	c, err := LoadConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	// 2
+	if err := c.Set(key, value); err != nil {
+		return err
+	}
+
+	// 3
+	return SaveConfigFile(configPath, c)
+}
+
+// Хранилище из --vault (или по умолчанию), лежащее в git-репозитории
+func openGitVault(reg *VaultRegistry) (*vaultSession, *gitStore, error) {
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return nil, nil, err
+	}
+	gs, ok := sess.Store.(*gitStore)
+	if !ok {
+		sess.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrVaultNotVersioned, sess.Name)
+	}
+	return sess, gs, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Открыть хранилище и запросить мастер-пароль (он нужен для слияния записей)
+// 2. Сохранить текущее состояние и синхронизировать с удалённым репозиторием
+// 3. Показать пришедшие изменения и конфликты
+
+func runSyncCommand(reg *VaultRegistry) error {
+	// 1
+	sess, gs, err := openGitVault(reg)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+
+	// 2
+	if err := sess.PM.SaveToFile(); err != nil {
+		return err
+	}
+	report, err := gs.Sync(sess.PM.masterKey)
+	if err != nil {
+		return err
+	}
+
+	// 3
+	switch {
+	case report.Merged:
+		showSuccess(fmt.Sprintf("Merged changes from %s", report.Remote))
+	case report.FastForward:
+		showSuccess(fmt.Sprintf("Updated from %s", report.Remote))
+	case report.Pushed:
+		showSuccess(fmt.Sprintf("Pushed to %s", report.Remote))
+	default:
+		showSuccess("Already up to date")
+	}
+	for _, c := range report.Incoming {
+		fmt.Printf("  %s %s\n", c.Op, c.Name)
+	}
+	for _, name := range report.Conflicts {
+		showInfo(fmt.Sprintf("Conflict in %s: kept the most recently modified version", name))
+	}
+
+	return nil
+}
+
+func runLogCommand(reg *VaultRegistry, args []string) error {
+	limit := 20
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("usage: log [N]")
+		}
+		limit = n
+	}
+
+	// История читается без блокировки: хранилище может быть открыто в другом окне
+	entry, err := reg.Resolve(appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	store, err := OpenVaultStore(entry.URI)
+	if err != nil {
+		return err
+	}
+	gs, ok := store.(*gitStore)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrVaultNotVersioned, entry.Name)
+	}
+
+	out, err := gs.Log(limit)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Открыть своё хранилище и запросить его мастер-пароль
+// 2. Загрузить другую версию (и общую, если указана); пустой пароль - тот же, что у своего хранилища
+// 3. Слить записи и показать отчёт
+// 4. Разрешить конфликты вручную
+// 5. Если результат отличается от текущих записей - после подтверждения сохранить его в своё хранилище
+
+func runMergeCommand(reg *VaultRegistry, args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	basePath := fs.String("base", "", "common ancestor of both vaults for a three-way merge")
+	// Путь к другой версии может стоять и до, и после флагов
+	otherPath, err := parseWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if otherPath == "" {
+		return fmt.Errorf("usage: merge OTHER [--base BASE]")
+	}
+
+	// 1
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+
+	// 2
+	fmt.Printf("Master password of %s (Enter = same): ", otherPath)
+	otherPassword, err := readPassword()
+	if err != nil {
+		return err
+	}
+	key := sess.PM.masterKey
+	if otherPassword != "" {
+		if key, err = masterKeyFromPassword(otherPassword); err != nil {
+			return err
+		}
+	}
+	theirs, err := loadVaultFile(otherPath, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", otherPath, err)
+	}
+
+	var base map[string]Password
+	if *basePath != "" {
+		if base, err = loadBaseVault(*basePath, sess.PM.masterKey, key); err != nil {
+			return fmt.Errorf("%s: %w", *basePath, err)
+		}
+	}
+
+	// 3
+	res, err := sess.PM.MergeWith(base, theirs)
+	if err != nil {
+		return err
+	}
+	conflicts := res.Conflicts
+	fmt.Println()
+	PrintMergeReport(res)
+
+	// 4
+	for i, c := range conflicts {
+		fmt.Printf("\n[%d/%d] ", i+1, len(conflicts))
+		PrintMergeConflict(c, otherPath)
+		how, err := SelectMergeResolution()
+		if err != nil {
+			return err
+		}
+		res.Resolve(c, how)
+	}
+
+	// 5
+	if len(conflicts) > 0 {
+		fmt.Println()
+		PrintMergeReport(MergeResult{Changes: res.Changes, KeptOurs: res.KeptOurs})
+	}
+	diff := sess.PM.MergeDiff(res)
+	if len(diff) == 0 {
+		showInfo("Nothing to merge")
+		return nil
+	}
+	ok, err := confirmAction(fmt.Sprintf("Apply merge to vault %s?", sess.Name))
+	if err != nil || !ok {
+		return err
+	}
+	if err := sess.PM.ApplyMerge(res); err != nil {
+		return err
+	}
+	if err := sess.PM.SaveToFile(); err != nil {
+		return err
+	}
+
+	showSuccess(fmt.Sprintf("Merge applied to %s: %d change(s)", sess.Name, len(diff)))
+	return nil
+}
+
+// Записи хранилища по пути или URI без блокировки (другая копия только читается).
+// Служебные записи другой копии не сливаются: якоря журнала относятся к её журналу
+func loadVaultFile(uri string, key []byte) (map[string]Password, error) {
+	store, err := OpenVaultStore(uri)
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := splitVaultMeta(data)
+	return entries, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Общая версия может быть копией любого из хранилищ: попробовать наш ключ,
+//    затем ключ другой версии
+// 2. Если ни один не подошёл - запросить мастер-пароль общей версии
+
+func loadBaseVault(path string, keys ...[]byte) (map[string]Password, error) {
+	// 1
+	var err error
+	for _, key := range keys {
+		var base map[string]Password
+		if base, err = loadVaultFile(path, key); err == nil {
+			return base, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	// 2
+	fmt.Printf("Master password of %s: ", path)
+	password, perr := readPassword()
+	if perr != nil {
+		return nil, perr
+	}
+	if password == "" {
+		return nil, err
+	}
+	key, err := masterKeyFromPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return loadVaultFile(path, key)
+}
+
+// Запрос нового мастер-пароля с подтверждением
+func readNewMasterPassword() (string, error) {
+	return readNewPassword("master password for the new vault", "master password")
+}
+
+func readNewPassword(what, repeat string) (string, error) {
+	fmt.Printf("Enter %s: ", what)
+	first, err := readPassword()
+	if err != nil {
+		return "", err
+	}
+	if len(first) < appConfig.MinPasswordLength {
+		return "", ErrPassWeak
+	}
+
+	fmt.Printf("Repeat %s: ", repeat)
+	second, err := readPassword()
+	if err != nil {
+		return "", err
+	}
+	if first != second {
+		return "", fmt.Errorf("passwords do not match")
+	}
+
+	return first, nil
+}
+
+func runIdentityCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: identity create [NAME]")
+		}
+		name := os.Getenv("USER")
+		if len(args) == 2 {
+			name = args[1]
+		}
+		return identityCreate(name)
+	case "show":
+		name, public, err := ReadPublicIdentity()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Name:       %s\n", name)
+		fmt.Printf("Public key: %s\n", public)
+		return nil
+	}
+
+	return fmt.Errorf("unknown identity command %q (create, show)", args[0])
+}
+
+// Запрос пароля личности и расшифровка её ключей
+func unlockIdentity() (*Identity, error) {
+	if _, _, err := ReadPublicIdentity(); err != nil {
+		return nil, err
+	}
+
+	fmt.Print("Enter identity passphrase: ")
+	passphrase, err := readPassword()
+	if err != nil {
+		return nil, err
+	}
+	key, err := masterKeyFromPassword(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return LoadIdentity(key)
+}
+
+func identityCreate(name string) error {
+	if name == "" {
+		return fmt.Errorf("usage: identity create NAME")
+	}
+
+	passphrase, err := readNewPassword("identity passphrase", "identity passphrase")
+	if err != nil {
+		return err
+	}
+	key, err := masterKeyFromPassword(passphrase)
+	if err != nil {
+		return err
+	}
+	id, err := CreateIdentity(name, key)
+	if err != nil {
+		return err
+	}
+
+	showSuccess(fmt.Sprintf("Identity %q created", id.Name))
+	fmt.Println("Share this public key with team vault owners:")
+	fmt.Println(id.Public())
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Открыть командное хранилище из --vault (или по умолчанию) своей личностью
+// 2. Изменить состав участников
+// 3. Записать хранилище: ключ данных заново шифруется для всех участников
+
+func runMemberCommand(reg *VaultRegistry, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+	case args[0] == "add" && (len(args) == 3 || len(args) == 4):
+	case args[0] == "remove" && len(args) == 2:
+	default:
+		return fmt.Errorf("usage: member list | member add NAME PUBLIC_KEY [rw|ro] | member remove NAME")
+	}
+
+	// 1
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	ts, ok := sess.Store.(*teamStore)
+	if !ok {
+		return fmt.Errorf("vault %s is not a team vault (use a team:// URI)", sess.Name)
+	}
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+
+	// 2
+	switch args[0] {
+	case "list":
+		return memberList(ts)
+	case "add":
+		role := RoleReadWrite
+		if len(args) == 4 {
+			if role, err = ParseTeamRole(args[3]); err != nil {
+				return err
+			}
+		}
+		if err := ts.AddMember(args[1], args[2], role); err != nil {
+			return err
+		}
+	case "remove":
+		if err := ts.RemoveMember(args[1]); err != nil {
+			return err
+		}
+	}
+
+	// 3
+	if err := sess.PM.SaveToFile(); err != nil {
+		return err
+	}
+	if args[0] == "add" {
+		showSuccess(fmt.Sprintf("Member %q added to %s", args[1], sess.Name))
+	} else {
+		showSuccess(fmt.Sprintf("Member %q removed from %s, data key rotated", args[1], sess.Name))
+	}
+	return nil
+}
+
+func memberList(ts *teamStore) error {
+	names := make(map[string]string)
+	for _, m := range ts.Members() {
+		names[m.PublicKey] = m.Name
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLE\tKEY\tADDED BY")
+	for _, m := range ts.Members() {
+		addedBy := names[m.AddedBy]
+		if m.PublicKey == ts.Creator() {
+			addedBy = "(creator)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, m.Role, fingerprint(m.PublicKey), addedBy)
+	}
+	return w.Flush()
+}
+
+// Разбор флагов, между которыми может стоять один позиционный аргумент
+func parseWithArg(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() == 0 {
+		return "", nil
+	}
+	arg := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return arg, nil
+}
+
+// Разбор флагов вперемешку с несколькими позиционными аргументами
+func parseWithArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Открыть хранилище и найти запись
+// 2. Открыть свою личность: ею подписывается переданная запись
+// 3. Зашифровать запись для получателя и вывести блок (или записать в файл)
+
+func runShareCommand(reg *VaultRegistry, args []string) error {
+	const usage = "usage: share ENTRY --to PUBLIC_KEY [--expires 24h] [--out FILE]"
+
+	fs := flag.NewFlagSet("share", flag.ContinueOnError)
+	to := fs.String("to", "", "public key of the recipient (pmid1:...)")
+	expires := fs.Duration("expires", 0, "how long the share stays valid, 0 = forever")
+	out := fs.String("out", "", "write the share to a file instead of stdout")
+	name, err := parseWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if name == "" || *to == "" || *expires < 0 {
+		return fmt.Errorf(usage)
+	}
+	if _, err := ParsePublicIdentity(*to); err != nil {
+		return err
+	}
+
+	// 1
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+	entry, err := sess.PM.GetPassword(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, name)
+	}
+
+	// 2
+	id, err := unlockIdentity()
+	if err != nil {
+		return err
+	}
+
+	// 3
+	text, err := SealShare(id, *to, entry, *expires)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Print("\n" + text)
+		return nil
+	}
+	if err := os.WriteFile(*out, []byte(text), 0600); err != nil {
+		return err
+	}
+	showSuccess(fmt.Sprintf("Entry %q shared in %s", name, *out))
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать блок из файла или вставленный в терминал текст
+// 2. Открыть свою личность, проверить подпись и срок действия, расшифровать запись
+// 3. Показать отправителя и добавить запись в хранилище с учётом конфликта имён
+
+func runReceiveCommand(reg *VaultRegistry, args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ContinueOnError)
+	onConflict := fs.String("on-conflict", "rename", "what to do if the entry exists: skip, overwrite, rename")
+	path, err := parseWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+	policy, err := ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	// 1
+	var text string
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	} else if text, err = readShareText(); err != nil {
+		return err
+	}
+
+	// 2
+	id, err := unlockIdentity()
+	if err != nil {
+		return err
+	}
+	share, err := OpenShare(id, text)
+	if err != nil {
+		return err
+	}
+
+	// 3
+	fmt.Printf("Entry %q from %s (%s), sent %s\n", share.Entry.Name, share.SenderName, fingerprint(share.Sender),
+		share.CreatedAt.Local().Format("2006-01-02 15:04"))
+
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+	report, err := sess.PM.ImportPasswords([]Password{share.Entry}, policy, false)
+	if err != nil {
+		return err
+	}
+	if len(report.Skipped) > 0 {
+		showInfo(fmt.Sprintf("Entry %q already exists, skipped", share.Entry.Name))
+		return nil
+	}
+	if err := sess.PM.SaveToFile(); err != nil {
+		return err
+	}
+
+	name := share.Entry.Name
+	if len(report.Renamed) > 0 {
+		name = report.Renamed[0].To
+	}
+	showSuccess(fmt.Sprintf("Entry saved as %q in %s", name, sess.Name))
+	return nil
+}
+
+// Построчное чтение вставленного блока до строки END
+func readShareText() (string, error) {
+	fmt.Println("Paste the share, it ends with " + shareArmorEnd + ":")
+
+	var b strings.Builder
+	for {
+		line, err := readOptionalInput("")
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(line + "\n")
+		if line == shareArmorEnd {
+			return b.String(), nil
+		}
+	}
+}
+
+func runTokensCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	tokens, err := LoadTokenStore()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if len(tokens.Tokens) == 0 {
+			fmt.Println("No API tokens. Run 'tokens create NAME' to add one")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPE\tCREATED")
+		for _, t := range tokens.Tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, t.scope(), t.CreatedAt.Format("2006-01-02"))
+		}
+		return w.Flush()
+	case "create":
+		fs := flag.NewFlagSet("tokens create", flag.ContinueOnError)
+		readOnly := fs.Bool("read-only", false, "allow only reading entries")
+		categories := fs.String("category", "", "comma separated categories the token can access")
+		name, err := parseWithArg(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return fmt.Errorf("usage: tokens create NAME [--read-only] [--category CAT,...]")
+		}
+		secret, err := tokens.Create(name, *readOnly, splitTags(*categories))
+		if err != nil {
+			return err
+		}
+		if err := tokens.Save(); err != nil {
+			return err
+		}
+		showSuccess(fmt.Sprintf("Token %q created. It is shown only once:", name))
+		fmt.Println(secret)
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: tokens revoke NAME")
+		}
+		if err := tokens.Revoke(args[1]); err != nil {
+			return err
+		}
+		return tokens.Save()
+	}
+
+	return fmt.Errorf("unknown tokens command %q (list, create, revoke)", args[0])
+}
+
+// Алгоритм работы функции:
+//
+// 1. Загрузить токены: без них к API никто не сможет обратиться
+// 2. Начать слушать localhost или Unix-сокет (до запроса пароля, чтобы сразу
+//    отказать в недопустимом адресе) и открыть журнал доступа
+// 3. Открыть хранилище и запросить мастер-пароль
+// 4. Обслуживать запросы до SIGINT/SIGTERM, затем дождаться завершения запросов
+
+func runServeCommand(reg *VaultRegistry, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:7878", "loopback address to listen on")
+	socket := fs.String("socket", "", "listen on a Unix socket instead of TCP")
+	logPath := fs.String("access-log", "", "access log file, - for stderr (default: data directory)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: serve [--listen ADDR | --socket PATH] [--access-log PATH]")
+	}
+
+	// 1
+	tokens, err := LoadTokenStore()
+	if err != nil {
+		return err
+	}
+	if len(tokens.Tokens) == 0 {
+		return fmt.Errorf("no API tokens, create one with 'tokens create NAME'")
+	}
+
+	// 2
+	ln, err := listenAPI(*listen, *socket)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	if *socket != "" {
+		defer os.Remove(*socket)
+	}
+
+	accessLog, err := openAccessLog(*logPath)
+	if err != nil {
+		return err
+	}
+	defer accessLog.Close()
+
+	// 3
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+
+	// 4
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Handler:           newAPIServer(sess.PM, tokens, accessLog).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	showSuccess(fmt.Sprintf("Serving vault %s on %s (Ctrl+C to stop)", sess.Name, ln.Addr()))
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	showInfo("Server stopped")
+	return nil
+}
+
+func openAccessLog(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stderr}, nil
+	}
+	if path == "" {
+		dir, err := appDataDir()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "access.log")
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func runNativeHostCommand(reg *VaultRegistry, args []string) error {
+	if len(args) == 0 {
+		messageOutput = os.Stderr
+		return runNativeHost(reg, os.Stdin, os.Stdout)
+	}
+	if args[0] != "manifest" || len(args) != 3 {
+		return fmt.Errorf("usage: native-host [manifest chrome|firefox EXTENSION_ID]")
+	}
+
+	manifest, err := nativeHostManifest(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(manifest))
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. stdout занят ответом для git, поэтому сообщения об ошибках выводятся в stderr
+// 2. Прочитать запрос git; если он не требует хранилища - выйти без запроса пароля
+// 3. Открыть хранилище и запросить мастер-пароль через терминал
+// 4. Выполнить действие git
+
+func runGitCredentialCommand(reg *VaultRegistry, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: git-credential get|store|erase")
+	}
+
+	// 1
+	messageOutput = os.Stderr
+
+	// 2
+	req, err := readGitCredential(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if !gitCredentialWanted(args[0], req) {
+		return nil
+	}
+
+	// 3
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := unlockVaultSessionTTY(sess); err != nil {
+		return err
+	}
+
+	// 4
+	return runGitCredential(sess.PM, args[0], req, os.Stdout)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Docker показывает пользователю stdout помощника как текст ошибки, поэтому
+//    ошибка выводится туда без оформления, а обычный вывод ошибок отключается
+// 2. Проверить действие до запроса мастер-пароля
+// 3. Открыть хранилище и запросить мастер-пароль через терминал
+// 4. Выполнить действие Docker
+
+func runDockerCredentialCommand(reg *VaultRegistry, args []string) (err error) {
+	// 1
+	messageOutput = io.Discard
+	defer func() {
+		if err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	// 2
+	if len(args) != 1 {
+		return fmt.Errorf("usage: docker-credential get|store|erase|list")
+	}
+	if err := dockerCredentialAction(args[0]); err != nil {
+		return err
+	}
+
+	// 3
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := unlockVaultSessionTTY(sess); err != nil {
+		return err
+	}
+
+	// 4
+	return runDockerCredential(sess.PM, args[0], os.Stdin, os.Stdout)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать --env VAR=ENTRY и команду после "--"
+// 2. Открыть хранилище (пароль - через терминал или PM_MASTER_PASSWORD, stdout
+//    принадлежит программе) и прочитать секреты
+// 3. Закрыть хранилище до запуска: программа может работать долго
+// 4. Запустить программу и завершиться с её кодом
+
+func runRunCommand(reg *VaultRegistry, args []string) error {
+	// 1
+	refs := make(map[string]string)
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Func("env", "set environment variable `VAR=ENTRY[#field]` from the vault", func(s string) error {
+		name, ref, err := parseEnvRef(s)
+		if err != nil {
+			return err
+		}
+		refs[name] = ref
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || len(refs) == 0 {
+		return fmt.Errorf("usage: run --env VAR=ENTRY[#field] ... -- COMMAND [ARGS]")
+	}
+
+	// 2
+	messageOutput = os.Stderr
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	env, err := readEnvSecrets(sess, refs)
+
+	// 3
+	sess.Close()
+	if err != nil {
+		return err
+	}
+
+	// 4
+	code, err := runWithSecrets(fs.Args(), env)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+	return nil
+}
+
+// Значения переменных окружения по ссылкам на записи
+func readEnvSecrets(sess *vaultSession, refs map[string]string) (map[string]string, error) {
+	if err := unlockVaultSessionTTY(sess); err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(refs))
+	for name, ref := range refs {
+		value, err := resolveSecretRef(sess.PM, ref)
+		if err != nil {
+			return nil, err
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать шаблон из файла или stdin (без аргумента или "-")
+// 2. Открыть хранилище; результат может идти в stdout, поэтому пароль - через терминал
+// 3. Подставить секреты; пропущенные ссылки перечислить в stderr
+// 4. Записать результат в файл с правами 0600 или вывести в stdout
+
+func runInjectCommand(reg *VaultRegistry, args []string) error {
+	fs := flag.NewFlagSet("inject", flag.ContinueOnError)
+	out := fs.String("o", "", "write the result to `FILE` (mode 0600) instead of stdout")
+	strict := fs.Bool("strict", false, "fail on references to missing entries")
+	path, err := parseWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// 1
+	messageOutput = os.Stderr
+	var text []byte
+	name := "stdin"
+	if path == "" || path == "-" {
+		text, err = io.ReadAll(os.Stdin)
+	} else {
+		text, err = os.ReadFile(path)
+		name = filepath.Base(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := unlockVaultSessionTTY(sess); err != nil {
+		return err
+	}
+
+	// 3
+	result, missing, err := renderTemplate(sess.PM, name, string(text), *strict)
+	if err != nil {
+		return err
+	}
+	for _, m := range missing {
+		showInfo(fmt.Sprintf("Entry %q not found, rendered as empty (use --strict to fail)", m))
+	}
+
+	// 4
+	if *out == "" {
+		_, err = os.Stdout.Write(result)
+		return err
+	}
+	return writeFileAtomic(*out, result, 0600)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать подкоманду и её аргументы
+// 2. Открыть хранилище
+// 3. generate и import сохраняют закрытый ключ в хранилище, public его только читает
+// 4. Вывести открытый ключ в формате authorized_keys
+
+func runSSHKeyCommand(reg *VaultRegistry, args []string) error {
+	usage := fmt.Errorf("usage: ssh-key generate NAME [--type ed25519|ecdsa|rsa] | import NAME FILE | public NAME")
+	if len(args) < 2 {
+		return usage
+	}
+
+	// 1
+	action, name := args[0], args[1]
+	keyType, keyFile := "", ""
+	switch action {
+	case "generate":
+		fs := flag.NewFlagSet("ssh-key generate", flag.ContinueOnError)
+		fs.StringVar(&keyType, "type", "ed25519", "key type: ed25519, ecdsa or rsa")
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			return usage
+		}
+	case "import":
+		if len(args) != 3 {
+			return usage
+		}
+		keyFile = args[2]
+	case "public":
+		if len(args) != 2 {
+			return usage
+		}
+	default:
+		return usage
+	}
+
+	// 2
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+	pm := sess.PM
+
+	// 3
+	var public string
+	switch action {
+	case "public":
+		p, err := pm.GetPassword(name)
+		if err != nil {
+			return err
+		}
+		if public, err = sshPublicKey(p); err != nil {
+			return err
+		}
+	default:
+		var private string
+		if action == "generate" {
+			private, public, err = GenerateSSHKey(keyType, name)
+		} else {
+			private, public, err = importSSHKeyFile(keyFile, name)
+		}
+		if err != nil {
+			return err
+		}
+		if err := pm.AddSSHKey(name, private); err != nil {
+			return err
+		}
+		if err := pm.SaveToFile(); err != nil {
+			return err
+		}
+		showSuccess(fmt.Sprintf("SSH key %q saved to vault %s", name, sess.Name))
+	}
+
+	// 4
+	fmt.Println(public)
+	return nil
+}
+
+func importSSHKeyFile(path, name string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	return ImportSSHKey(data, name, func() ([]byte, error) {
+		fmt.Printf("Enter passphrase for %s: ", path)
+		pass, err := readPassword()
+		return []byte(pass), err
+	})
+}
+
+// Алгоритм работы функции:
+//
+// 1. Занять сокет агента (до запроса пароля, чтобы сразу отказать, если агент уже запущен)
+// 2. Открыть хранилище, загрузить ключи и сразу освободить файл хранилища
+// 3. Вывести команду для оболочки, как это делает ssh-agent
+// 4. Обслуживать подключения до SIGINT/SIGTERM, затем удалить сокет
+
+func runSSHAgentCommand(reg *VaultRegistry, args []string) error {
+	fs := flag.NewFlagSet("ssh-agent", flag.ContinueOnError)
+	socket := fs.String("socket", defaultAgentSocket(), "Unix socket `PATH` for SSH_AUTH_SOCK")
+	confirm := fs.Bool("confirm", false, "ask in this terminal before every signature")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: ssh-agent [--socket PATH] [--confirm]")
+	}
+
+	// 1
+	ln, err := listenAgent(*socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+	defer ln.Close()
+
+	// 2
+	a := newVaultAgent(reg, appConfig.Vault)
+	if *confirm {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return fmt.Errorf("--confirm needs a terminal: %w", err)
+		}
+		defer tty.Close()
+		a.confirm = ttyConfirm(tty)
+	}
+
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	err = unlockVaultSession(sess)
+	if err == nil {
+		a.load(sess.PM)
+	}
+	sess.Close()
+	if err != nil {
+		return err
+	}
+	keys, _ := a.List()
+
+	// 3
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", *socket)
+	showSuccess(fmt.Sprintf("Agent serving %d key(s) from vault %s (Ctrl+C to stop)", len(keys), sess.Name))
+
+	// 4
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	return serveAgent(ln, a)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать подкоманду; файл для add прочитать и проверить до запроса пароля
+// 2. Открыть хранилище. Если вложение выводится в stdout, пароль запрашивается через терминал
+// 3. Выполнить действие; add и remove сохраняют хранилище
+
+func runAttachCommand(reg *VaultRegistry, args []string) error {
+	usage := fmt.Errorf("usage: attach add ENTRY FILE [--name NAME] | list [ENTRY] | extract ENTRY NAME [-o FILE|-] | remove ENTRY NAME")
+	if len(args) == 0 {
+		return usage
+	}
+
+	// 1
+	action := args[0]
+	fs := flag.NewFlagSet("attach "+action, flag.ContinueOnError)
+	name := fs.String("name", "", "attachment `NAME` (default: the file name)")
+	out := fs.String("o", "", "write the attachment to `FILE`, - for stdout (default: ./NAME)")
+	positional, err := parseWithArgs(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch {
+	case action == "add" && len(positional) == 2:
+		if *name == "" {
+			*name = filepath.Base(positional[1])
+		}
+		info, err := os.Stat(positional[1])
+		if err != nil {
+			return err
+		}
+		if err := checkAttachmentSize(*name, info.Size()); err != nil {
+			return err
+		}
+		if data, err = os.ReadFile(positional[1]); err != nil {
+			return err
+		}
+	case action == "list" && len(positional) <= 1:
+	case action == "extract" && len(positional) == 2:
+	case action == "remove" && len(positional) == 2:
+	default:
+		return usage
+	}
+
+	// 2
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if *out == "-" {
+		messageOutput = os.Stderr
+		err = unlockVaultSessionTTY(sess)
+	} else {
+		err = unlockVaultSession(sess)
+	}
+	if err != nil {
+		return err
+	}
+	pm := sess.PM
+
+	// 3
+	switch action {
+	case "add":
+		if err := pm.AddAttachment(positional[0], *name, data); err != nil {
+			return err
+		}
+		if err := pm.SaveToFile(); err != nil {
+			return err
+		}
+		showSuccess(fmt.Sprintf("Attached %s (%s) to %s", *name, formatSize(int64(len(data))), positional[0]))
+		return nil
+	case "list":
+		return attachList(pm, positional)
+	case "extract":
+		return attachExtract(pm, positional[0], positional[1], *out)
+	}
+
+	if err := pm.RemoveAttachment(positional[0], positional[1]); err != nil {
+		return err
+	}
+	if err := pm.SaveToFile(); err != nil {
+		return err
+	}
+	showSuccess(fmt.Sprintf("Removed %s from %s", positional[1], positional[0]))
+	return nil
+}
+
+func attachList(pm *PasswordManager, entry []string) error {
+	entries := pm.EntriesWithAttachments()
+	if len(entry) == 1 {
+		p, err := pm.GetPassword(entry[0])
+		if err != nil {
+			return err
+		}
+		entries = []Password{p}
+	}
+
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tNAME\tSIZE\tADDED")
+	for _, p := range entries {
+		for _, a := range p.Attachments {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, a.Name, formatSize(int64(len(a.Data))), a.AddedAt.Format("2006-01-02"))
+			total += int64(len(a.Data))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(entry) == 0 {
+		fmt.Printf("Total: %s of %s\n", formatSize(total), appConfig.Attachments.MaxTotalSize)
+	}
+	return nil
+}
+
+// Вложение пишется в новый файл с правами 0600: существующий файл не перезаписывается
+func attachExtract(pm *PasswordManager, entry, name, out string) error {
+	a, err := pm.GetAttachment(entry, name)
+	if err != nil {
+		return err
+	}
+
+	if out == "-" {
+		_, err = os.Stdout.Write(a.Data)
+		return err
+	}
+	if out == "" {
+		out = a.Name
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(a.Data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	showSuccess(fmt.Sprintf("Extracted %s (%s) to %s", a.Name, formatSize(int64(len(a.Data))), out))
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить подкоманду и число аргументов до запроса пароля
+// 2. Открыть хранилище
+// 3. Вывести дерево или записи папки; изменяющие команды сохраняют хранилище
+
+func runFoldersCommand(reg *VaultRegistry, args []string) error {
+	usage := fmt.Errorf("usage: folders [tree] | list FOLDER | rename FROM TO | move FROM PARENT | move-entry ENTRY FOLDER | normalize")
+	if len(args) == 0 {
+		args = []string{"tree"}
+	}
+
+	// 1
+	want := map[string]int{"tree": 0, "list": 1, "rename": 2, "move": 2, "move-entry": 2, "normalize": 0}
+	if n, ok := want[args[0]]; !ok || len(args)-1 != n {
+		return usage
+	}
+
+	// 2
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+	pm := sess.PM
+
+	// 3
+	var msg string
+	switch args[0] {
+	case "tree":
+		tree := pm.FolderTree()
+		fmt.Printf("%d entries, %d without folder\n", tree.Total, tree.Entries)
+		for _, line := range tree.Lines() {
+			fmt.Println(line)
+		}
+		return nil
+	case "list":
+		entries := pm.GetPasswordsInFolder(args[1])
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tUSERNAME\tTYPE\tFOLDER")
+		for _, p := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", shortID(p.ID), p.Name, p.Username, p.EntryKind(), p.Category)
+		}
+		return w.Flush()
+	case "rename", "move":
+		rename := pm.RenameFolder
+		if args[0] == "move" {
+			rename = pm.MoveFolder
+		}
+		n, err := rename(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		msg = fmt.Sprintf("Moved %d entries from %s", n, NormalizeFolder(args[1]))
+	case "move-entry":
+		if err := pm.MoveEntry(args[1], args[2]); err != nil {
+			return err
+		}
+		msg = fmt.Sprintf("Moved %s to %s", args[1], pm.CanonicalFolder(args[2]))
+	case "normalize":
+		n, err := pm.NormalizeFolders()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			showInfo("Folders are already normalized")
+			return nil
+		}
+		msg = fmt.Sprintf("Normalized the folder of %d entries", n)
+	}
+
+	if err := pm.SaveToFile(); err != nil {
+		return err
+	}
+	showSuccess(msg)
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать подкоманду; журнал читается только с мастер-паролем хранилища
+// 2. show - проверить журнал, вывести последние N событий (с фильтром по операции
+//    и записи) и предупредить, если проверка нашла нарушения
+// 3. verify - вывести результат проверки цепочки, подписей и обрезки; нарушения - ошибка
+// 4. rotate - начать новый файл журнала
+
+func runAuditLogCommand(reg *VaultRegistry, args []string) error {
+	const usage = "usage: audit-log show [N] [--op OP] [--entry ENTRY] | verify | rotate"
+
+	// 1
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet("audit-log", flag.ContinueOnError)
+	op := fs.String("op", "", "only events of this operation (get, add, update, delete, export, unlock-failed)")
+	ref := fs.String("entry", "", "only events of this entry (name or ID)")
+	positional, err := parseWithArgs(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	limit := 50
+	switch {
+	case args[0] == "show" && len(positional) == 1:
+		if limit, err = strconv.Atoi(positional[0]); err != nil || limit < 1 {
+			return errors.New(usage)
+		}
+	case args[0] == "show" && len(positional) == 0:
+	case (args[0] == "verify" || args[0] == "rotate") && len(positional) == 0 && fs.NFlag() == 0:
+	default:
+		return errors.New(usage)
+	}
+	if !appConfig.Audit.Enabled {
+		return fmt.Errorf("audit log is disabled (audit.enabled=false)")
+	}
+
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := unlockVaultSession(sess); err != nil {
+		return err
+	}
+	audit := sess.PM.Audit()
+
+	if args[0] == "rotate" {
+		// 4
+		if err := audit.Rotate(); err != nil {
+			return err
+		}
+		showSuccess("Started a new audit log file")
+		return nil
+	}
+
+	report, err := audit.Verify(sess.PM.AuditAnchor())
+	if err != nil {
+		return err
+	}
+
+	// 2
+	if args[0] == "show" {
+		var events []AuditEvent
+		for _, ev := range report.Events {
+			if (*op == "" || ev.Op == *op) && (*ref == "" || ev.Entry == *ref || (len(*ref) >= shortIDLen && strings.HasPrefix(ev.EntryID, *ref))) {
+				events = append(events, ev)
+			}
+		}
+		events = events[max(0, len(events)-limit):]
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tTIME\tUSER\tSOURCE\tOP\tENTRY\tDETAIL")
+		for _, ev := range events {
+			entry := ev.Entry
+			if ev.EntryID != "" {
+				entry += " [" + shortID(ev.EntryID) + "]"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", ev.Seq, ev.Time.Local().Format("2006-01-02 15:04:05"), ev.User, ev.Source, ev.Op, entry, ev.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(report.Problems) > 0 {
+			showError(fmt.Sprintf("%v: %d problems, run 'audit-log verify' for details", ErrAuditTampered, len(report.Problems)))
+		}
+		return nil
+	}
+
+	// 3
+	fmt.Printf("Checked %d records in %d files", report.Records, report.Files)
+	if report.Records > 0 {
+		fmt.Printf(" (records %d-%d)", report.First, report.Last)
+	}
+	fmt.Println()
+	if report.First > 1 {
+		fmt.Printf("Records before %d were in rotated files that are no longer kept (audit.keep)\n", report.First)
+	}
+	if report.Unsigned > 0 {
+		fmt.Printf("%d unsigned records: failed unlocks are written without the master password\n", report.Unsigned)
+	}
+	if len(report.Problems) > 0 {
+		for _, p := range report.Problems {
+			fmt.Println("  " + p)
+		}
+		return fmt.Errorf("%w: %d problems", ErrAuditTampered, len(report.Problems))
+	}
+	showSuccess("Audit log is intact")
+	return nil
+}
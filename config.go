@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Настройки приложения. Источники применяются по порядку, каждый следующий важнее:
+//
+//  1. значения по умолчанию (DefaultConfig)
+//  2. файл $XDG_CONFIG_HOME/passwordmanager/config в формате JSON
+//  3. переменные окружения PM_* (и NO_COLOR)
+//  4. флаги командной строки
+type Config struct {
+	// Хранилище по умолчанию: имя из реестра, путь или URI. Пусто - по умолчанию из реестра
+	Vault string `json:"vault,omitempty"`
+	// Минимальная длина паролей, мастер-пароля и паролей экспорта
+	MinPasswordLength int             `json:"min_password_length"`
+	Generator         GeneratorConfig `json:"generator"`
+	Colors            ColorConfig     `json:"colors"`
+	Timeouts          TimeoutConfig   `json:"timeouts"`
+	Git               GitConfig       `json:"git"`
+	Attachments       AttachConfig    `json:"attachments"`
+	Audit             AuditConfig     `json:"audit"`
+}
+
+type GeneratorConfig struct {
+	// Длина пароля, если пользователь не указал свою
+	Length int `json:"length"`
+	// Символы, из которых собирается пароль
+	Charset string `json:"charset"`
+}
+
+type ColorConfig struct {
+	Enabled bool   `json:"enabled"`
+	Success string `json:"success"`
+	Error   string `json:"error"`
+	Info    string `json:"info"`
+}
+
+type TimeoutConfig struct {
+	// Через сколько очищать буфер обмена после копирования в TUI. 0 - не очищать
+	Clipboard Duration `json:"clipboard"`
+}
+
+// Работа с хранилищем-файлом, лежащим в git-репозитории
+type GitConfig struct {
+	// Коммитить файл хранилища после каждого сохранения
+	AutoCommit bool `json:"auto_commit"`
+	// Писать имена записей в сообщения коммитов; по умолчанию - только количество изменений
+	CommitNames bool `json:"commit_names"`
+	// Удалённый репозиторий для sync
+	Remote string `json:"remote"`
+}
+
+// Ограничения на вложения записей: всё хранилище расшифровывается в память целиком
+type AttachConfig struct {
+	// Наибольший размер одного файла
+	MaxFileSize ByteSize `json:"max_file_size"`
+	// Наибольший общий размер вложений в хранилище
+	MaxTotalSize ByteSize `json:"max_total_size"`
+}
+
+// Журнал аудита хранилищ
+type AuditConfig struct {
+	// Записывать операции с хранилищем
+	Enabled bool `json:"enabled"`
+	// Размер файла журнала, после которого начинается новый
+	MaxSize ByteSize `json:"max_size"`
+	// Сколько старых файлов журнала хранить
+	Keep int `json:"keep"`
+}
+
+// time.Duration, который в JSON записывается строкой вида "30s"
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("negative duration %s", v)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Размер в байтах, который в JSON записывается строкой вида "5MiB"
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+func (b ByteSize) String() string {
+	for _, u := range byteSizeUnits {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatInt(int64(b/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// Число с необязательным суффиксом B, KiB, MiB или GiB
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	unit := ByteSize(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q, expected a number with B, KiB, MiB or GiB", text)
+	}
+	if v < 1 {
+		return fmt.Errorf("size must be positive, got %q", text)
+	}
+	*b = ByteSize(v) * unit
+	return nil
+}
+
+const (
+	DefaultMinPasswordLength = 8
+	configFileName           = "config"
+)
+
+// Текущие настройки. Заполняются в main до открытия хранилища
+var appConfig = DefaultConfig()
+
+func DefaultConfig() Config {
+	return Config{
+		MinPasswordLength: DefaultMinPasswordLength,
+		Generator: GeneratorConfig{
+			Length:  16,
+			Charset: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*-_+=.",
+		},
+		Colors: ColorConfig{
+			Enabled: true,
+			Success: "green",
+			Error:   "red",
+			Info:    "yellow",
+		},
+		Timeouts: TimeoutConfig{
+			Clipboard: Duration(30 * time.Second),
+		},
+		Git: GitConfig{
+			AutoCommit: true,
+			Remote:     "origin",
+		},
+		Attachments: AttachConfig{
+			MaxFileSize:  5 << 20,
+			MaxTotalSize: 50 << 20,
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+			MaxSize: 1 << 20,
+			Keep:    5,
+		},
+	}
+}
+
+// Путь к файлу настроек ($XDG_CONFIG_HOME/passwordmanager/config)
+func defaultConfigPath() (string, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFileName), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Начать со значений по умолчанию
+// 2. Если файла нет - вернуть их
+// 3. Наложить значения из файла и проверить результат
+
+func LoadConfigFile(path string) (Config, error) {
+	// 1
+	c := DefaultConfig()
+
+	// 2
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	// 3
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+func SaveConfigFile(path string, c Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Без HTML-экранирования, чтобы набор символов генератора читался в файле как есть
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// Настройка, доступная через config get/set, переменную окружения и флаг
+type configSetting struct {
+	key   string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, value string) error
+}
+
+var configSettings = []configSetting{
+	{
+		key:   "vault",
+		usage: "vault name from the registry, path or URI (file://, dir://, mem://)",
+		get:   func(c *Config) string { return c.Vault },
+		set:   func(c *Config, v string) error { c.Vault = v; return nil },
+	},
+	{
+		key:   "min_password_length",
+		usage: "minimum length of passwords and master passwords",
+		get:   func(c *Config) string { return strconv.Itoa(c.MinPasswordLength) },
+		set:   func(c *Config, v string) error { return parsePositive(v, &c.MinPasswordLength) },
+	},
+	{
+		key:   "generator.length",
+		usage: "default length of generated passwords",
+		get:   func(c *Config) string { return strconv.Itoa(c.Generator.Length) },
+		set:   func(c *Config, v string) error { return parsePositive(v, &c.Generator.Length) },
+	},
+	{
+		key:   "generator.charset",
+		usage: "characters used by the password generator",
+		get:   func(c *Config) string { return c.Generator.Charset },
+		set:   func(c *Config, v string) error { c.Generator.Charset = v; return nil },
+	},
+	{
+		key:   "colors.enabled",
+		usage: "colored output (true/false)",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Colors.Enabled) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			c.Colors.Enabled = b
+			return err
+		},
+	},
+	{
+		key:   "colors.success",
+		usage: "color of success messages",
+		get:   func(c *Config) string { return c.Colors.Success },
+		set:   func(c *Config, v string) error { c.Colors.Success = v; return nil },
+	},
+	{
+		key:   "colors.error",
+		usage: "color of error messages",
+		get:   func(c *Config) string { return c.Colors.Error },
+		set:   func(c *Config, v string) error { c.Colors.Error = v; return nil },
+	},
+	{
+		key:   "colors.info",
+		usage: "color of info messages",
+		get:   func(c *Config) string { return c.Colors.Info },
+		set:   func(c *Config, v string) error { c.Colors.Info = v; return nil },
+	},
+	{
+		key:   "timeouts.clipboard",
+		usage: "clear the clipboard this long after copying, 0 to keep",
+		get:   func(c *Config) string { return c.Timeouts.Clipboard.String() },
+		set:   func(c *Config, v string) error { return c.Timeouts.Clipboard.UnmarshalText([]byte(v)) },
+	},
+	{
+		key:   "git.auto_commit",
+		usage: "commit the vault file after each save when it is in a git repository (true/false)",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Git.AutoCommit) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			c.Git.AutoCommit = b
+			return err
+		},
+	},
+	{
+		key:   "git.commit_names",
+		usage: "list entry names in vault commit messages; they are pushed to the remote unencrypted (true/false)",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Git.CommitNames) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			c.Git.CommitNames = b
+			return err
+		},
+	},
+	{
+		key:   "git.remote",
+		usage: "git remote used by sync",
+		get:   func(c *Config) string { return c.Git.Remote },
+		set:   func(c *Config, v string) error { c.Git.Remote = v; return nil },
+	},
+	{
+		key:   "attachments.max_file_size",
+		usage: "largest attachment file, e.g. 5MiB",
+		get:   func(c *Config) string { return c.Attachments.MaxFileSize.String() },
+		set:   func(c *Config, v string) error { return c.Attachments.MaxFileSize.UnmarshalText([]byte(v)) },
+	},
+	{
+		key:   "attachments.max_total_size",
+		usage: "total size of all attachments in a vault, e.g. 50MiB",
+		get:   func(c *Config) string { return c.Attachments.MaxTotalSize.String() },
+		set:   func(c *Config, v string) error { return c.Attachments.MaxTotalSize.UnmarshalText([]byte(v)) },
+	},
+	{
+		key:   "audit.enabled",
+		usage: "record vault operations in the encrypted audit log (true/false)",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Audit.Enabled) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			c.Audit.Enabled = b
+			return err
+		},
+	},
+	{
+		key:   "audit.max_size",
+		usage: "start a new audit log file after this size, e.g. 1MiB",
+		get:   func(c *Config) string { return c.Audit.MaxSize.String() },
+		set:   func(c *Config, v string) error { return c.Audit.MaxSize.UnmarshalText([]byte(v)) },
+	},
+	{
+		key:   "audit.keep",
+		usage: "number of rotated audit log files to keep",
+		get:   func(c *Config) string { return strconv.Itoa(c.Audit.Keep) },
+		set:   func(c *Config, v string) error { return parsePositive(v, &c.Audit.Keep) },
+	},
+}
+
+func parsePositive(s string, dst *int) error {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if v < 1 {
+		return fmt.Errorf("value must be positive, got %d", v)
+	}
+	*dst = v
+	return nil
+}
+
+// PM_GENERATOR_LENGTH для generator.length
+func (s configSetting) envName() string {
+	return "PM_" + strings.ToUpper(strings.NewReplacer(".", "_").Replace(s.key))
+}
+
+// --generator-length для generator.length
+func (s configSetting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func findConfigSetting(key string) (configSetting, error) {
+	for _, s := range configSettings {
+		if s.key == key {
+			return s, nil
+		}
+	}
+	return configSetting{}, fmt.Errorf("%w: %s", ErrConfigKey, key)
+}
+
+func (c *Config) Get(key string) (string, error) {
+	s, err := findConfigSetting(key)
+	if err != nil {
+		return "", err
+	}
+	return s.get(c), nil
+}
+
+// Изменить настройку и проверить, что настройки остались согласованными
+func (c *Config) Set(key, value string) error {
+	if err := c.set(key, value); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+func (c *Config) set(key, value string) error {
+	s, err := findConfigSetting(key)
+	if err != nil {
+		return err
+	}
+	if err := s.set(c, value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Проверка согласованности настроек между собой
+func (c *Config) validate() error {
+	if c.MinPasswordLength < 1 {
+		return fmt.Errorf("min_password_length must be positive")
+	}
+	if c.Generator.Length < c.MinPasswordLength {
+		return fmt.Errorf("generator.length (%d) is shorter than min_password_length (%d)", c.Generator.Length, c.MinPasswordLength)
+	}
+	if c.Generator.Charset == "" {
+		return fmt.Errorf("generator.charset is empty")
+	}
+	if c.Git.Remote == "" {
+		return fmt.Errorf("git.remote is empty")
+	}
+	if c.Audit.Keep < 1 {
+		return fmt.Errorf("audit.keep must be positive")
+	}
+	if c.Attachments.MaxFileSize > c.Attachments.MaxTotalSize {
+		return fmt.Errorf("attachments.max_file_size (%s) is larger than attachments.max_total_size (%s)", c.Attachments.MaxFileSize, c.Attachments.MaxTotalSize)
+	}
+	for key, name := range map[string]string{"colors.success": c.Colors.Success, "colors.error": c.Colors.Error, "colors.info": c.Colors.Info} {
+		if _, ok := ansiColors[name]; !ok {
+			return fmt.Errorf("%s: unknown color %q (%s)", key, name, strings.Join(colorNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Для каждой настройки прочитать переменную PM_*
+// 2. NO_COLOR (https://no-color.org) отключает цвета при любом значении
+
+func (c *Config) applyEnv() error {
+	// 1
+	for _, s := range configSettings {
+		if v, ok := os.LookupEnv(s.envName()); ok {
+			if err := c.set(s.key, v); err != nil {
+				return fmt.Errorf("%s: %w", s.envName(), err)
+			}
+		}
+	}
+
+	// 2
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		c.Colors.Enabled = false
+	}
+
+	return nil
+}
+
+// Флаги командной строки для всех настроек. Значения запоминаются и применяются
+// в applyFlags, после файла и переменных окружения
+type configFlags struct {
+	path   string
+	values []configFlagValue
+}
+
+type configFlagValue struct {
+	setting configSetting
+	value   string
+}
+
+func registerConfigFlags(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	fs.StringVar(&cf.path, "config", "", "config file (default $XDG_CONFIG_HOME/passwordmanager/config)")
+	for _, s := range configSettings {
+		s := s
+		fs.Func(s.flagName(), s.usage, func(v string) error {
+			cf.values = append(cf.values, configFlagValue{setting: s, value: v})
+			return nil
+		})
+	}
+	return cf
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать файл настроек (из --config или из каталога по умолчанию)
+// 2. Применить переменные окружения
+// 3. Применить флаги и проверить итоговые настройки
+
+func (cf *configFlags) load() (Config, string, error) {
+	// 1
+	path := cf.path
+	if path == "" {
+		p, err := defaultConfigPath()
+		if err != nil {
+			return DefaultConfig(), "", err
+		}
+		path = p
+	}
+	c, err := LoadConfigFile(path)
+	if err != nil {
+		return c, path, err
+	}
+
+	// 2
+	if err := c.applyEnv(); err != nil {
+		return c, path, err
+	}
+
+	// 3
+	for _, fv := range cf.values {
+		if err := c.set(fv.setting.key, fv.value); err != nil {
+			return c, path, fmt.Errorf("--%s: %w", fv.setting.flagName(), err)
+		}
+	}
+
+	return c, path, c.validate()
+}
+
+// ANSI-коды цветов, доступных в настройках colors.*
+var ansiColors = map[string]string{
+	"default": "\033[39m",
+	"black":   "\033[30m",
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+	"white":   "\033[37m",
+}
+
+func colorNames() []string {
+	names := make([]string, 0, len(ansiColors))
+	for name := range ansiColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Текст в заданном цвете. Если цвета выключены - без escape-последовательностей
+func (c ColorConfig) paint(name, text string) string {
+	if !c.Enabled {
+		return text
+	}
+	return ansiColors[name] + text + colorReset
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+)
+
+// Файл переопределяет значения по умолчанию, переменные окружения - файл, флаги - всё остальное
+func TestConfigPrecedence(t *testing.T) {
+	testHome(t)
+	path := filepath.Join(t.TempDir(), "config")
+	file := DefaultConfig()
+	file.Generator.Length = 20
+	file.MinPasswordLength = 10
+	file.Git.Remote = "backup"
+	if err := SaveConfigFile(path, file); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PM_GENERATOR_LENGTH", "24")
+	t.Setenv("PM_GIT_REMOTE", "env-remote")
+
+	load := func(args ...string) Config {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		cf := registerConfigFlags(fs)
+		if err := fs.Parse(append([]string{"--config", path}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		c, got, err := cf.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != path {
+			t.Errorf("config path %q, want %q", got, path)
+		}
+		return c
+	}
+
+	c := load("--generator-length", "32")
+	for key, want := range map[string]string{
+		"generator.length":    "32",         // флаг
+		"git.remote":          "env-remote", // окружение
+		"min_password_length": "10",         // файл
+		"git.auto_commit":     "true",       // по умолчанию
+	} {
+		if got, err := c.Get(key); err != nil || got != want {
+			t.Errorf("%s = %q (%v), want %q", key, got, err, want)
+		}
+	}
+
+	if c = load(); c.Generator.Length != 24 {
+		t.Errorf("without flag: generator.length %d, want 24 from environment", c.Generator.Length)
+	}
+}
+
+// Недопустимые значения из окружения и флагов отклоняются с указанием источника
+func TestConfigOverrideErrors(t *testing.T) {
+	testHome(t)
+	load := func(args ...string) error {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		cf := registerConfigFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := cf.load()
+		return err
+	}
+
+	if err := load("--generator-length", "4"); err == nil {
+		t.Error("generator.length shorter than min_password_length accepted")
+	}
+	t.Setenv("PM_AUDIT_KEEP", "0")
+	if err := load(); err == nil {
+		t.Error("PM_AUDIT_KEEP=0 accepted")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Помощник учётных данных Docker (docker credential helper).
+//
+// Docker ищет в PATH программу docker-credential-<имя> из "credsStore" или
+// "credHelpers" в ~/.docker/config.json, поэтому достаточно ссылки на программу:
+//
+//	ln -s $(which PasswordManager) /usr/local/bin/docker-credential-passwordmanager
+//	{"credsStore": "passwordmanager"}
+//
+// Действие передаётся аргументом, данные - через stdin и stdout:
+//
+//	get    stdin: адрес реестра       stdout: {"ServerURL", "Username", "Secret"}
+//	store  stdin: {"ServerURL", "Username", "Secret"}
+//	erase  stdin: адрес реестра
+//	list                              stdout: {"адрес реестра": "логин", ...}
+//
+// Учётные данные хранятся записями категории docker: одна запись на реестр
+type dockerCredential struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+const (
+	dockerCredentialProgram  = "docker-credential-passwordmanager"
+	dockerCredentialCategory = "docker"
+)
+
+// Запуск Docker через ссылку docker-credential-passwordmanager
+func isDockerCredentialLaunch() bool {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	return name == dockerCredentialProgram
+}
+
+// Нужно ли хранилище для действия: неизвестное действие - ошибка без запроса пароля
+func dockerCredentialAction(action string) error {
+	switch action {
+	case "get", "store", "erase", "list":
+		return nil
+	}
+	return fmt.Errorf("unknown docker credential action %q (get, store, erase, list)", action)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать из stdin адрес реестра или учётные данные
+// 2. Выполнить действие над записями категории docker
+// 3. Для get и list вывести ответ в JSON
+
+func runDockerCredential(pm *PasswordManager, action string, r io.Reader, w io.Writer) error {
+	// 1
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	serverURL := strings.TrimSpace(string(input))
+
+	// 2
+	switch action {
+	case "get":
+		cred, err := dockerCredentialGet(pm, serverURL)
+		if err != nil {
+			return err
+		}
+		// 3
+		return json.NewEncoder(w).Encode(cred)
+	case "store":
+		var cred dockerCredential
+		if err := json.Unmarshal(input, &cred); err != nil {
+			return fmt.Errorf("invalid credentials: %w", err)
+		}
+		return dockerCredentialStore(pm, cred)
+	case "erase":
+		return dockerCredentialErase(pm, serverURL)
+	case "list":
+		list := make(map[string]string)
+		for _, p := range pm.GetPasswordsByCategory(dockerCredentialCategory) {
+			list[p.URL] = p.Username
+		}
+		// 3
+		return json.NewEncoder(w).Encode(list)
+	}
+	return dockerCredentialAction(action)
+}
+
+// Адрес реестра без схемы и завершающего "/": https://index.docker.io/v1/ -> index.docker.io/v1
+func dockerServerKey(serverURL string) string {
+	if _, rest, ok := strings.Cut(serverURL, "://"); ok {
+		serverURL = rest
+	}
+	return strings.ToLower(strings.TrimRight(serverURL, "/"))
+}
+
+// ID записи категории docker для реестра
+func dockerCredentialEntry(pm *PasswordManager, serverURL string) (string, bool) {
+	key := dockerServerKey(serverURL)
+
+	var found []Password
+	for _, p := range pm.GetPasswordsByCategory(dockerCredentialCategory) {
+		if dockerServerKey(p.URL) == key {
+			found = append(found, p)
+		}
+	}
+	if len(found) == 0 {
+		return "", false
+	}
+	sortEntries(found)
+	return found[0].ID, true
+}
+
+func dockerCredentialGet(pm *PasswordManager, serverURL string) (dockerCredential, error) {
+	id, ok := dockerCredentialEntry(pm, serverURL)
+	if !ok {
+		return dockerCredential{}, ErrDockerCredentialsNotFound
+	}
+
+	p, err := pm.GetPassword(id)
+	if err != nil {
+		return dockerCredential{}, err
+	}
+	return dockerCredential{ServerURL: serverURL, Username: p.Username, Secret: p.Value}, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить запрос
+// 2. Запись для реестра есть - заменить логин и секрет
+// 3. Иначе создать запись с именем реестра; занятое имя получает суффикс "(2)"
+// 4. Сохранить хранилище
+//
+// Секрет реестра (часто это токен) не проверяется на надёжность,
+// поэтому запись добавляется через ImportPasswords
+
+func dockerCredentialStore(pm *PasswordManager, cred dockerCredential) error {
+	// 1
+	if cred.ServerURL == "" || cred.Secret == "" {
+		return fmt.Errorf("ServerURL and Secret are required")
+	}
+	now := time.Now()
+
+	// 2
+	var record Password
+	policy := ConflictOverwrite
+	if id, ok := dockerCredentialEntry(pm, cred.ServerURL); ok {
+		p, err := pm.GetPassword(id)
+		if err != nil {
+			return err
+		}
+		if p.Username == cred.Username && p.Value == cred.Secret {
+			return nil
+		}
+		record = p
+		record.Username = cred.Username
+		record.Value = cred.Secret
+		record.LastModified = now
+	} else {
+		// 3
+		record = newImportedPassword(dockerServerKey(cred.ServerURL), cred.Secret, dockerCredentialCategory, now, now)
+		record.Username = cred.Username
+		record.URL = cred.ServerURL
+		policy = ConflictRename
+	}
+
+	if _, err := pm.ImportPasswords([]Password{record}, policy, false); err != nil {
+		return err
+	}
+
+	// 4
+	return pm.SaveToFile()
+}
+
+func dockerCredentialErase(pm *PasswordManager, serverURL string) error {
+	id, ok := dockerCredentialEntry(pm, serverURL)
+	if !ok {
+		return ErrDockerCredentialsNotFound
+	}
+	if err := pm.DeletePassword(id); err != nil {
+		return err
+	}
+	return pm.SaveToFile()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDockerServerKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://index.docker.io/v1/": "index.docker.io/v1",
+		"index.docker.io/v1":          "index.docker.io/v1",
+		"GHCR.io":                     "ghcr.io",
+		"http://localhost:5000//":     "localhost:5000",
+	} {
+		if got := dockerServerKey(in); got != want {
+			t.Errorf("dockerServerKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Docker передаёт адрес реестра с переводом строки, а учётные данные - JSON
+func TestDockerCredentialHelper(t *testing.T) {
+	pm := testManager(t)
+	run := func(action, input string) (string, error) {
+		var out bytes.Buffer
+		err := runDockerCredential(pm, action, strings.NewReader(input), &out)
+		return out.String(), err
+	}
+
+	if _, err := run("store", `{"ServerURL":"https://index.docker.io/v1/","Username":"alice","Secret":"tok1"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("store", `{"ServerURL":"index.docker.io/v1","Username":"alice","Secret":"tok2"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("store", `{"ServerURL":`); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+
+	out, err := run("get", "https://index.docker.io/v1/\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cred dockerCredential
+	if err := json.Unmarshal([]byte(out), &cred); err != nil {
+		t.Fatal(err)
+	}
+	if cred != (dockerCredential{ServerURL: "https://index.docker.io/v1/", Username: "alice", Secret: "tok2"}) {
+		t.Fatalf("get: %+v", cred)
+	}
+
+	out, err = run("list", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out) != `{"https://index.docker.io/v1/":"alice"}` {
+		t.Fatalf("list: %s", out)
+	}
+
+	if _, err := run("erase", "https://index.docker.io/v1/\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("get", "https://index.docker.io/v1/"); !errors.Is(err, ErrDockerCredentialsNotFound) {
+		t.Fatalf("get after erase: got %v, want ErrDockerCredentialsNotFound", err)
+	}
+	if _, err := run("login", ""); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
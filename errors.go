@@ -6,3 +6,47 @@ var ErrPassManagerNotInit = errors.New("password manager not initialized")
 var ErrPassExists = errors.New("password already exists")
 var ErrPassNotFound = errors.New("password not found")
 var ErrPassWeak = errors.New("password is too weak")
+var ErrImportFormat = errors.New("unknown import format")
+var ErrKDBXCredentials = errors.New("wrong KDBX password or corrupted file")
+var ErrVaultLocked = errors.New("vault is locked by another process")
+var ErrVaultNotFound = errors.New("vault not found")
+var ErrVaultExists = errors.New("vault already exists")
+var ErrConfigKey = errors.New("unknown config key")
+var ErrVaultNotVersioned = errors.New("vault file is not in a git repository")
+var ErrNoIdentity = errors.New("no identity, run 'identity create' first")
+var ErrIdentityExists = errors.New("identity already exists")
+var ErrIdentityPassphrase = errors.New("wrong identity passphrase")
+var ErrPublicKey = errors.New("invalid public identity key")
+var ErrNotMember = errors.New("identity is not a member of this vault")
+var ErrMemberExists = errors.New("member already exists")
+var ErrMemberNotFound = errors.New("member not found")
+var ErrMemberRevoked = errors.New("member was removed from this vault")
+var ErrVaultReadOnly = errors.New("vault is read-only for this member")
+var ErrTeamSignature = errors.New("team vault signature verification failed")
+var ErrTeamRollback = errors.New("team vault file is older than the last seen version")
+var ErrShareInvalid = errors.New("invalid or tampered share")
+var ErrShareRecipient = errors.New("share is addressed to another identity")
+var ErrShareExpired = errors.New("share expired")
+var ErrTokenExists = errors.New("token already exists")
+var ErrTokenNotFound = errors.New("token not found")
+var ErrUnauthorized = errors.New("missing or invalid API token")
+var ErrForbidden = errors.New("token scope does not allow this operation")
+var ErrBadRequest = errors.New("bad request")
+var ErrVaultClosed = errors.New("vault is not unlocked")
+var ErrMasterPassword = errors.New("wrong master password")
+var ErrDockerCredentialsNotFound = errors.New("credentials not found in native keychain")
+var ErrSSHKeyInvalid = errors.New("invalid SSH private key")
+var ErrNotSSHKey = errors.New("entry is not an SSH key")
+var ErrAgentLocked = errors.New("agent is locked")
+var ErrAgentDenied = errors.New("signing request denied")
+var ErrAgentReadOnly = errors.New("agent keys are managed with 'ssh-key' commands")
+var ErrKindUnknown = errors.New("unknown entry kind")
+var ErrFieldInvalid = errors.New("invalid field")
+var ErrAttachmentNotFound = errors.New("attachment not found")
+var ErrAttachmentExists = errors.New("attachment already exists")
+var ErrAttachmentTooLarge = errors.New("attachment is too large")
+var ErrAttachmentCorrupted = errors.New("attachment checksum mismatch")
+var ErrFolderNotFound = errors.New("folder not found")
+var ErrEntryAmbiguous = errors.New("ambiguous entry name")
+var ErrAuditLog = errors.New("audit log is damaged")
+var ErrAuditTampered = errors.New("audit log verification failed")
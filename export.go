@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Форматы экспорта
+type ExportFormat string
+
+const (
+	ExportCSV     ExportFormat = "csv"
+	ExportJSON    ExportFormat = "json"
+	ExportArchive ExportFormat = "archive"
+	ExportKDBX    ExportFormat = "kdbx"
+)
+
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(s)); f {
+	case ExportCSV, ExportJSON, ExportArchive, ExportKDBX:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("unknown export format: %s", s)
+}
+
+// Открытый текст: такие файлы нужно явно подтверждать и хранить осторожно
+func (f ExportFormat) IsPlaintext() bool {
+	return f == ExportCSV || f == ExportJSON
+}
+
+// Фильтр экспортируемых записей. Пустое поле - без ограничения
+type ExportFilter struct {
+	Category string
+	Tag      string
+}
+
+func (f ExportFilter) match(p Password) bool {
+	if f.Category != "" && !inFolder(p.Category, f.Category) {
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, t := range p.Tags {
+		if strings.EqualFold(t, f.Tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что менеджер инициализирован
+// 2. Отобрать записи, подходящие под фильтр
+// 3. Отсортировать по имени, чтобы экспорт был стабильным
+
+func (pm *PasswordManager) ExportPasswords(filter ExportFilter) ([]Password, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	// 1
+	if err := pm.passInit(); err != nil {
+		return nil, err
+	}
+
+	// 2
+	res := make([]Password, 0, len(pm.passwords))
+	for _, p := range pm.passwords {
+		if filter.match(p) {
+			res = append(res, p)
+		}
+	}
+
+	// 3
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сформировать содержимое в выбранном формате
+// 2. Записать файл с правами 0600 (только владелец)
+
+func WriteExportFile(path string, format ExportFormat, passwords []Password, passphrase string) error {
+	var buf bytes.Buffer
+
+	// 1
+	var err error
+	switch format {
+	case ExportCSV:
+		err = writeExportCSV(&buf, passwords)
+	case ExportJSON:
+		err = writeExportJSON(&buf, passwords)
+	case ExportArchive:
+		err = writeArchive(&buf, passwords, passphrase)
+	case ExportKDBX:
+		err = writeKDBX(&buf, passwords, passphrase)
+	default:
+		err = fmt.Errorf("unknown export format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// Столбцы CSV совпадают с полями Password. Поля заметок, карт и удостоверений
+// записываются в столбец fields как JSON-объект, у логинов он пуст
+func writeExportCSV(w io.Writer, passwords []Password) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"name", "kind", "username", "url", "category", "tags", "password", "notes", "fields", "created_at", "last_modified"}); err != nil {
+		return err
+	}
+
+	for _, p := range passwords {
+		var fields string
+		if len(p.Fields) > 0 {
+			data, err := json.Marshal(p.Fields)
+			if err != nil {
+				return err
+			}
+			fields = string(data)
+		}
+		row := []string{
+			p.Name,
+			p.EntryKind(),
+			p.Username,
+			p.URL,
+			p.Category,
+			strings.Join(p.Tags, ","),
+			p.Value,
+			p.Notes,
+			fields,
+			p.CreatedAt.Format(time.RFC3339),
+			p.LastModified.Format(time.RFC3339),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeExportJSON(w io.Writer, passwords []Password) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(passwords)
+}
+
+// Переносимый зашифрованный архив.
+//
+// Формат файла:
+//
+//	[magic "PMARCH01" (8 байт)] [соль (16)] [time (4)] [memory KiB (4)] [threads (1)] [nonce (12)] [AES-256-GCM шифротекст]
+//
+// Ключ выводится из пароля архива через Argon2id, поэтому архив не зависит
+// от мастер-пароля хранилища и может быть импортирован в новое хранилище
+const (
+	archiveMagic     = "PMARCH01"
+	archiveSaltSize  = 16
+	archiveTime      = 3
+	archiveMemoryKiB = 64 * 1024
+	archiveThreads   = 4
+	archiveVersion   = 1
+	// Пределы параметров Argon2id при чтении: параметры берутся из файла
+	archiveMaxTime      = 100
+	archiveMaxMemoryKiB = 1024 * 1024
+)
+
+type archivePayload struct {
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	Entries   []Password `json:"entries"`
+}
+
+type archiveHeader struct {
+	Salt    [archiveSaltSize]byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сериализовать записи в JSON
+// 2. Сгенерировать соль и вывести ключ из пароля архива
+// 3. Зашифровать AES-256-GCM, заголовок используется как дополнительные данные
+// 4. Записать заголовок, nonce и шифротекст
+
+func writeArchive(w io.Writer, passwords []Password, passphrase string) error {
+	if len(passphrase) < appConfig.MinPasswordLength {
+		return ErrPassWeak
+	}
+
+	// 1
+	plain, err := json.Marshal(archivePayload{Version: archiveVersion, CreatedAt: time.Now(), Entries: passwords})
+	if err != nil {
+		return err
+	}
+
+	// 2
+	hdr := archiveHeader{Time: archiveTime, Memory: archiveMemoryKiB, Threads: archiveThreads}
+	if _, err := io.ReadFull(rand.Reader, hdr.Salt[:]); err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(passphrase), hdr.Salt[:], hdr.Time, hdr.Memory, hdr.Threads, MasterKeySize)
+
+	// 3
+	var header bytes.Buffer
+	header.WriteString(archiveMagic)
+	if err := binary.Write(&header, binary.BigEndian, hdr); err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nil, nonce, plain, header.Bytes())
+
+	// 4
+	for _, part := range [][]byte{header.Bytes(), nonce, sealed} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить magic, прочитать параметры Argon2id и проверить их пределы
+// 2. Вывести ключ из пароля архива
+// 3. Расшифровать и проверить целостность (GCM)
+// 4. Вернуть записи
+
+func readArchive(r io.Reader, passphrase string) ([]Password, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1
+	headerSize := len(archiveMagic) + binary.Size(archiveHeader{})
+	if len(data) < headerSize || string(data[:len(archiveMagic)]) != archiveMagic {
+		return nil, fmt.Errorf("not a PasswordManager archive")
+	}
+	var hdr archiveHeader
+	if err := binary.Read(bytes.NewReader(data[len(archiveMagic):headerSize]), binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Time < 1 || hdr.Time > archiveMaxTime || hdr.Threads < 1 || hdr.Memory > archiveMaxMemoryKiB {
+		return nil, fmt.Errorf("archive key derivation parameters are out of range")
+	}
+
+	// 2
+	key := argon2.IDKey([]byte(passphrase), hdr.Salt[:], hdr.Time, hdr.Memory, hdr.Threads, MasterKeySize)
+
+	// 3
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[headerSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("archive is truncated")
+	}
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], data[:headerSize])
+	if err != nil {
+		return nil, fmt.Errorf("wrong archive password or corrupted archive")
+	}
+
+	// 4
+	var payload archivePayload
+	if err := json.Unmarshal(plain, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Version != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version: %d", payload.Version)
+	}
+
+	return payload.Entries, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Импорт архива подключается к общему механизму импорта.
+// Пароль архива передаётся через WithPassphrase перед разбором
+type archiveImporter struct {
+	passphrase string
+}
+
+func (archiveImporter) Name() string        { return "archive" }
+func (archiveImporter) Description() string { return "PasswordManager encrypted archive" }
+
+func (a archiveImporter) WithPassphrase(passphrase string) Importer {
+	a.passphrase = passphrase
+	return a
+}
+
+func (a archiveImporter) Parse(r io.Reader) ([]Password, error) {
+	return readArchive(r, a.passphrase)
+}
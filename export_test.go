@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Записи для проверки экспорта: вложенная папка, теги, заметки и вложение
+func exportSample() []Password {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	p := Password{
+		ID: newEntryID(), Name: "github", Value: "Secret#Pass1", Username: "alice",
+		URL: "https://github.com/login", Notes: "recovery codes attached", Category: "work/dev",
+		Tags: []string{"2fa", "shared"}, CreatedAt: created, LastModified: created.Add(time.Hour),
+		Attachments: []Attachment{newAttachment("codes.txt", []byte("1111 2222"))},
+	}
+	note := Password{
+		ID: newEntryID(), Name: "wifi", Value: "Home#Wifi1", Category: "personal",
+		CreatedAt: created, LastModified: created,
+	}
+	return []Password{p, note}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	want := exportSample()
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, want, "archivepass1"); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	got, err := readArchive(bytes.NewReader(data), "archivepass1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !samePassword(got[i], want[i]) {
+			t.Errorf("entry %d:\ngot  %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := readArchive(bytes.NewReader(data), "wrongpass1"); err == nil {
+		t.Error("wrong password accepted")
+	}
+	for _, i := range []int{len(archiveMagic), len(data) - 1} {
+		damaged := slices.Clone(data)
+		damaged[i] ^= 1
+		if _, err := readArchive(bytes.NewReader(damaged), "archivepass1"); err == nil {
+			t.Errorf("byte %d changed: archive accepted", i)
+		}
+	}
+}
+
+// Параметры Argon2id из заголовка проверяются до вывода ключа
+func TestArchiveKDFLimits(t *testing.T) {
+	for name, hdr := range map[string]archiveHeader{
+		"no threads": {Time: 1, Memory: 64, Threads: 0},
+		"no passes":  {Time: 0, Memory: 64, Threads: 1},
+		"memory":     {Time: 1, Memory: 4 * archiveMaxMemoryKiB, Threads: 1},
+		"passes":     {Time: archiveMaxTime + 1, Memory: 64, Threads: 1},
+	} {
+		var buf bytes.Buffer
+		buf.WriteString(archiveMagic)
+		binary.Write(&buf, binary.BigEndian, hdr)
+		buf.Write(make([]byte, 64))
+		if _, err := readArchive(&buf, "archivepass1"); err == nil {
+			t.Errorf("%s: archive accepted", name)
+		}
+	}
+}
+
+// CSV сохраняет тип записи и поля нелогинов в столбцах kind и fields
+func TestExportCSVKindAndFields(t *testing.T) {
+	card := Password{
+		ID: newEntryID(), Name: "visa", Kind: KindCard, Value: "4111111111111111",
+		Fields: map[string]string{"expiry": "12/29", "cvv": "123"},
+	}
+	var buf bytes.Buffer
+	if err := writeExportCSV(&buf, append(exportSample(), card)); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := rows[0]
+	col := func(name string) int {
+		i := slices.Index(header, name)
+		if i < 0 {
+			t.Fatalf("no %q column in %v", name, header)
+		}
+		return i
+	}
+	kind, fields := col("kind"), col("fields")
+
+	if got := rows[1][kind]; got != KindLogin {
+		t.Errorf("login kind: got %q", got)
+	}
+	if got := rows[1][fields]; got != "" {
+		t.Errorf("login fields: got %q, want empty", got)
+	}
+	if got := rows[3][kind]; got != KindCard {
+		t.Errorf("card kind: got %q", got)
+	}
+	var got map[string]string
+	if err := json.Unmarshal([]byte(rows[3][fields]), &got); err != nil {
+		t.Fatalf("card fields %q: %v", rows[3][fields], err)
+	}
+	if got["expiry"] != "12/29" || got["cvv"] != "123" {
+		t.Errorf("card fields: got %v", got)
+	}
+}
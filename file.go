@@ -5,22 +5,24 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // Алгоритм работы функции:
 //
 // 1. Проверить, что менеджер инициализирован
-// 2. Сериализовать map паролей в JSON
-// 3. Создать новый блок шифрования AES
-// 4. Сгененрировать случайный вектор инициализации
-// 5. Создать шифровальщик и зашифровать данные
-// 6. Сохранить IV и зашифрованные данные в файл
+// 2. Добавить к паролям служебные записи с якорем журнала аудита
+// 3. Передать данные хранилищу, которое само сериализует и зашифрует их
 
 func (pm *PasswordManager) SaveToFile() error {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
 	// 1
 	if err := pm.passInit(); err != nil {
@@ -28,96 +30,269 @@ func (pm *PasswordManager) SaveToFile() error {
 	}
 
 	// 2
-	data, err := json.Marshal(pm.passwords)
+	data := pm.vaultDataLocked()
+
+	// 3
+	if err := pm.store.Save(pm.masterKey, data); err != nil {
+		return err
+	}
+	_, pm.meta = splitVaultMeta(data)
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что менеджер инициализирован
+// 2. Загрузить и расшифровать пароли из хранилища
+// 3. Заменить содержимое менеджера загруженными данными, отделив служебные записи
+
+func (pm *PasswordManager) LoadFromFile() error {
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// 1
+	if err := pm.passInit(); err != nil {
+		return err
+	}
+
+	// 2
+	passwords, err := pm.store.Load(pm.masterKey)
 	if err != nil {
 		return err
 	}
 
 	// 3
-	block, err := aes.NewCipher(pm.masterKey)
+	pm.passwords, pm.meta = splitVaultMeta(passwords)
+	return nil
+}
+
+// Хранилище по умолчанию: один зашифрованный файл [IV][AES-CFB(JSON)]
+type fileStore struct {
+	path string
+}
+
+func newFileStore(path string) *fileStore {
+	return &fileStore{path: path}
+}
+
+func (s *fileStore) Load(key []byte) (map[string]Password, error) {
+	data, err := os.ReadFile(s.path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 4
-	iv := make([]byte, aes.BlockSize) // BlockSize = 16
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return err
+	return decodeVault(key, data)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Расшифровать содержимое файла хранилища
+// 2. Преобразовать расшифрованные данные обратно в структуры
+// 3. Записи хранилищ, где ключом было имя записи, перевести на ID
+
+func decodeVault(key, data []byte) (map[string]Password, error) {
+	// 1
+	plain, err := decryptData(key, data)
+	if err != nil {
+		return nil, err
 	}
 
-	// 5
-	stream := cipher.NewCFBEncrypter(block, iv)
-	encryptedData := make([]byte, len(data))
-	stream.XORKeyStream(encryptedData, data)
+	// 2
+	passwords := make(map[string]Password)
+	if err := json.Unmarshal(plain, &passwords); err != nil {
+		return nil, err
+	}
 
-	// 6
-	file, err := os.Create(pm.filePath)
+	// 3
+	return migrateEntryIDs(passwords), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сериализовать map паролей в JSON
+// 2. Зашифровать данные
+// 3. Записать во временный файл и переименовать, чтобы сбой не оставил файл наполовину записанным
+
+func (s *fileStore) Save(key []byte, passwords map[string]Password) error {
+	// 1
+	data, err := json.Marshal(passwords)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	// Сначала записываем IV
-	if _, err := file.Write(iv); err != nil {
+	// 2
+	encrypted, err := encryptData(key, data)
+	if err != nil {
 		return err
 	}
 
-	// Затем шифрованные данные
-	if _, err := file.Write(encryptedData); err != nil {
-		return err
+	// 3
+	return writeFileAtomic(s.path, encrypted, 0600)
+}
+
+func (s *fileStore) Lock() (func() error, error) {
+	return lockPath(s.path + ".lock")
+}
+
+func (s *fileStore) Stat() (VaultInfo, error) {
+	info := VaultInfo{URI: "file://" + s.path}
+
+	st, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
 	}
 
-	return nil
+	info.Exists = true
+	info.Size = st.Size()
+	info.ModTime = st.ModTime()
+	return info, nil
 }
 
 // Алгоритм работы функции:
 //
-// 1. Проверить, что менеджер инициализирован
-// 2. Открыть файл и прочитать его содержимое
-// 3. Прочитать вектор инициализации (первые 16 байт)
-// 4. Прочитать зашифрованные данные
-// 5. Создать расшифровщик и расшифровать данные
-// 6. Преобразовать расшифрованные данные обратно в структуры
+// 1. Создать новый блок шифрования AES
+// 2. Сгенерировать случайный вектор инициализации
+// 3. Создать шифровальщик и зашифровать данные
+// 4. Вернуть IV и зашифрованные данные одним срезом
 
-func (pm *PasswordManager) LoadFromFile() error {
+func encryptData(key, data []byte) ([]byte, error) {
+	// 1
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
 
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+	// 2
+	iv := make([]byte, aes.BlockSize) // BlockSize = 16
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	// 3
+	stream := cipher.NewCFBEncrypter(block, iv)
+	encryptedData := make([]byte, len(data))
+	stream.XORKeyStream(encryptedData, data)
 
+	// 4
+	// Сначала IV, затем шифрованные данные
+	return append(iv, encryptedData...), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать вектор инициализации (первые 16 байт)
+// 2. Создать расшифровщик и расшифровать остальные данные
+
+func decryptData(key, data []byte) ([]byte, error) {
 	// 1
-	if err := pm.passInit(); err != nil {
-		return err
+	if len(data) < aes.BlockSize {
+		return nil, io.ErrUnexpectedEOF
 	}
+	iv, encryptedData := data[:aes.BlockSize], data[aes.BlockSize:]
 
 	// 2
-	file, err := os.Open(pm.filePath)
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer file.Close()
 
-	// 3
-	iv := make([]byte, aes.BlockSize)
-	if _, err := io.ReadFull(file, iv); err != nil {
+	stream := cipher.NewCFBDecrypter(block, iv)
+	decryptedData := make([]byte, len(encryptedData))
+	stream.XORKeyStream(decryptedData, encryptedData)
+
+	return decryptedData, nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp.Name())
 
-	// 4
-	encryptedData, err := io.ReadAll(file)
-	if err != nil {
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
 		return err
 	}
 
-	// 5
-	block, err := aes.NewCipher(pm.masterKey)
+	return os.Rename(tmp.Name(), path)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Захватить flock на файле блокировки - ядро снимает его, когда процесс завершается
+//    (в том числе по Ctrl+C или kill), поэтому оставшийся файл не мешает следующему запуску
+// 2. Где flock нет - атомарно создать файл (O_EXCL); файл, чей процесс уже завершился, занять заново
+// 3. Записать в файл PID, вернуть функцию, удаляющую файл и снимающую блокировку
+
+func lockPath(lockFile string) (func() error, error) {
+	// 1
+	f, err := flockPath(lockFile)
+
+	// 2
+	if errors.Is(err, errors.ErrUnsupported) {
+		f, err = exclusivePath(lockFile)
+	}
 	if err != nil {
+		return nil, err
+	}
+
+	// 3
+	f.Truncate(0)
+	f.WriteString(strconv.Itoa(os.Getpid()))
+	return func() error {
+		err := os.Remove(lockFile)
+		f.Close()
 		return err
+	}, nil
+}
+
+// Создать файл блокировки с O_EXCL. Если файл остался от завершившегося процесса, он удаляется
+// и создаётся заново; файл без PID считается занятым
+func exclusivePath(lockFile string) (*os.File, error) {
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if !os.IsExist(err) {
+		return f, err
+	}
+	pid, ok := lockOwner(lockFile)
+	if !ok || processAlive(pid) {
+		return nil, lockedError(lockFile, pid)
+	}
+	if err := os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err = os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		pid, _ := lockOwner(lockFile)
+		return nil, lockedError(lockFile, pid)
 	}
+	return f, err
+}
 
-	stream := cipher.NewCFBDecrypter(block, iv)
-	decryptedData := make([]byte, len(encryptedData))
-	stream.XORKeyStream(decryptedData, encryptedData)
+// PID, записанный в файл блокировки
+func lockOwner(lockFile string) (int, bool) {
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
 
-	// 6
-	return json.Unmarshal(decryptedData, &pm.passwords)
+func lockedError(lockFile string, pid int) error {
+	if pid > 0 {
+		return fmt.Errorf("%w (process %d, lock file %s)", ErrVaultLocked, pid, lockFile)
+	}
+	return fmt.Errorf("%w (remove %s if no other instance is running)", ErrVaultLocked, lockFile)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLockPath(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "vault.lock")
+	unlock, err := lockPath(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockPath(lockFile); !errors.Is(err, ErrVaultLocked) {
+		t.Fatalf("second lock: got %v, want ErrVaultLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = lockPath(lockFile)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	unlock()
+}
+
+// Файл блокировки, оставшийся после Ctrl+C, не мешает открыть хранилище
+func TestLockPathStale(t *testing.T) {
+	dir := t.TempDir()
+	for name, lock := range map[string]func(string) (func() error, error){
+		"lockPath": lockPath,
+		"exclusive": func(lockFile string) (func() error, error) {
+			f, err := exclusivePath(lockFile)
+			if err != nil {
+				return nil, err
+			}
+			return f.Close, nil
+		},
+	} {
+		lockFile := filepath.Join(dir, name+".lock")
+		if err := os.WriteFile(lockFile, []byte(strconv.Itoa(deadPID(t))), 0600); err != nil {
+			t.Fatal(err)
+		}
+		unlock, err := lock(lockFile)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		unlock()
+	}
+
+	// Файл с PID живого процесса занят
+	lockFile := filepath.Join(dir, "live.lock")
+	os.WriteFile(lockFile, []byte(strconv.Itoa(os.Getpid())), 0600)
+	if _, err := exclusivePath(lockFile); !errors.Is(err, ErrVaultLocked) {
+		t.Fatalf("live owner: got %v, want ErrVaultLocked", err)
+	}
+}
+
+// PID завершившегося процесса
+func deadPID(t *testing.T) int {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := os.StartProcess(exe, []string{exe, "-test.run=^$"}, &os.ProcAttr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	return p.Pid
+}
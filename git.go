@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Хранилище-файл внутри git-репозитория. После каждого сохранения файл коммитится
+// с описанием изменённых записей, а sync синхронизирует его с удалённым репозиторием.
+// В git попадает только зашифрованный файл, записи расшифровываются лишь при слиянии
+type gitStore struct {
+	*fileStore
+	// Корень рабочего дерева и путь файла хранилища относительно него
+	repo string
+	rel  string
+	// Записи на момент последней загрузки или сохранения - для описания коммита
+	snapshot map[string]Password
+	// Имя автора для коммитов, если в git оно не настроено
+	env []string
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти корень git-репозитория, в котором лежит файл хранилища
+// 2. Если файл не в репозитории или git не установлен - вернуть false
+
+func newGitStore(fs *fileStore) (*gitStore, bool) {
+	abs, err := filepath.Abs(fs.path)
+	if err != nil {
+		return nil, false
+	}
+
+	// 1
+	top, err := runGit(filepath.Dir(abs), nil, "rev-parse", "--show-toplevel")
+
+	// 2
+	if err != nil {
+		return nil, false
+	}
+	top, err = filepath.EvalSymlinks(top)
+	if err != nil {
+		return nil, false
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return nil, false
+	}
+	rel, err := filepath.Rel(top, filepath.Join(dir, filepath.Base(abs)))
+	if err != nil {
+		return nil, false
+	}
+
+	s := &gitStore{fileStore: fs, repo: top, rel: filepath.ToSlash(rel)}
+	// Без настроенного имени автора git откажется коммитить и сливать ветки
+	if email, _ := s.git("config", "user.email"); email == "" {
+		s.env = []string{
+			"GIT_AUTHOR_NAME=PasswordManager", "GIT_AUTHOR_EMAIL=passwordmanager@localhost",
+			"GIT_COMMITTER_NAME=PasswordManager", "GIT_COMMITTER_EMAIL=passwordmanager@localhost",
+		}
+	}
+	return s, true
+}
+
+func (s *gitStore) Load(key []byte) (map[string]Password, error) {
+	passwords, err := s.fileStore.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	s.snapshot = copyPasswords(passwords)
+	return passwords, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сравнить записи с последним снимком
+// 2. Если данные не менялись и файл уже в git - не перезаписывать его (IV случаен,
+//    иначе каждый выход из программы давал бы новый коммит). Изменившийся якорь журнала
+//    аудита записывается, хотя записи те же: иначе якорь в файле отстаёт от журнала
+// 3. Записать файл и закоммитить его с описанием изменений
+
+func (s *gitStore) Save(key []byte, passwords map[string]Password) error {
+	// 1
+	changes := diffEntries(s.snapshot, passwords)
+	message := commitMessage(s.vaultName(), changes)
+
+	// 2
+	if len(changes) == 0 && s.tracked() {
+		if sameEntries(s.snapshot, passwords) {
+			return nil
+		}
+		message = fmt.Sprintf("%s: update audit log anchor", s.vaultName())
+	}
+
+	// 3
+	if err := s.fileStore.Save(key, passwords); err != nil {
+		return err
+	}
+	s.snapshot = copyPasswords(passwords)
+
+	if !appConfig.Git.AutoCommit {
+		return nil
+	}
+	return s.commit(message)
+}
+
+func (s *gitStore) Stat() (VaultInfo, error) {
+	info, err := s.fileStore.Stat()
+	info.URI += " (git)"
+	return info, err
+}
+
+// Имя для сообщений коммитов: имя файла без расширения
+func (s *gitStore) vaultName() string {
+	return strings.TrimSuffix(filepath.Base(s.rel), filepath.Ext(s.rel))
+}
+
+func (s *gitStore) tracked() bool {
+	_, err := s.git("ls-files", "--error-unmatch", "--", s.rel)
+	return err == nil
+}
+
+func (s *gitStore) commit(message string) error {
+	if _, err := s.git("add", "--", s.rel); err != nil {
+		return err
+	}
+	// Нечего коммитить - файл совпадает с последней версией в git
+	if _, err := s.git("diff", "--cached", "--quiet", "--", s.rel); err == nil {
+		return nil
+	}
+
+	_, err := s.git("commit", "--quiet", "-m", message, "--", s.rel)
+	return err
+}
+
+func (s *gitStore) git(args ...string) (string, error) {
+	return runGit(s.repo, s.env, args...)
+}
+
+func runGit(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Изменение одной записи между двумя версиями хранилища
+type entryChange struct {
+	Op   string // add, update, remove
+	ID   string
+	Name string
+}
+
+// Служебные записи (якоря журнала аудита) изменениями не считаются
+func diffEntries(before, after map[string]Password) []entryChange {
+	var changes []entryChange
+	for id, p := range after {
+		old, ok := before[id]
+		switch {
+		case isVaultMeta(id):
+		case !ok:
+			changes = append(changes, entryChange{Op: "add", ID: id, Name: p.Name})
+		case !samePassword(old, p):
+			changes = append(changes, entryChange{Op: "update", ID: id, Name: p.Name})
+		}
+	}
+	for id, p := range before {
+		if _, ok := after[id]; !ok && !isVaultMeta(id) {
+			changes = append(changes, entryChange{Op: "remove", ID: id, Name: p.Name})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Данные хранилища совпадают целиком, включая служебные записи
+func sameEntries(a, b map[string]Password) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, p := range a {
+		if q, ok := b[id]; !ok || !samePassword(p, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// Записи равны, если совпадает их сериализованное содержимое
+func samePassword(a, b Password) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+// Коммиты уходят в удалённый репозиторий, поэтому по умолчанию сообщение содержит только
+// количество изменений: имена записей раскрыли бы то, что скрыто шифрованием файла.
+// С git.commit_names заголовок перечисляет до трёх изменений, полный список - в теле
+func commitMessage(vault string, changes []entryChange) string {
+	if len(changes) == 0 {
+		return fmt.Sprintf("%s: save vault", vault)
+	}
+	if !appConfig.Git.CommitNames {
+		counts := map[string]int{}
+		for _, c := range changes {
+			counts[c.Op]++
+		}
+		var parts []string
+		for _, op := range []struct{ op, label string }{{"add", "added"}, {"update", "changed"}, {"remove", "removed"}} {
+			if counts[op.op] > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[op.op], op.label))
+			}
+		}
+		return fmt.Sprintf("%s: update vault: %s", vault, strings.Join(parts, ", "))
+	}
+
+	var subject string
+	if len(changes) <= 3 {
+		parts := make([]string, len(changes))
+		for i, c := range changes {
+			parts[i] = c.Op + " " + c.Name
+		}
+		subject = strings.Join(parts, ", ")
+	} else {
+		counts := map[string]int{}
+		for _, c := range changes {
+			counts[c.Op]++
+		}
+		var parts []string
+		for _, op := range []string{"add", "update", "remove"} {
+			if counts[op] > 0 {
+				parts = append(parts, fmt.Sprintf("%s %d", op, counts[op]))
+			}
+		}
+		subject = strings.Join(parts, ", ") + " entries"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n\n", vault, subject)
+	for _, c := range changes {
+		fmt.Fprintf(&b, "%s %s\n", c.Op, c.Name)
+	}
+	return b.String()
+}
+
+// Результат синхронизации
+type SyncReport struct {
+	Remote      string
+	Pulled      bool
+	FastForward bool
+	Merged      bool
+	Pushed      bool
+	// Изменения, пришедшие с удалённой стороны
+	Incoming []entryChange
+	// Записи, изменённые на обеих сторонах; оставлена более новая версия
+	Conflicts []string
+}
+
+// Алгоритм работы функции:
+//
+// 1. Закоммитить несохранённое состояние файла и получить изменения из удалённого репозитория
+// 2. Удалённой ветки ещё нет - просто отправить свою
+// 3. Удалённая ветка уже содержит наши коммиты - перемотать вперёд, отправлять нечего
+// 4. Ветки разошлись - расшифровать общую, свою и чужую версии и слить по записям
+// 5. Отправить результат
+
+func (s *gitStore) Sync(key []byte) (SyncReport, error) {
+	report := SyncReport{Remote: appConfig.Git.Remote}
+
+	// 1
+	if err := s.commit(fmt.Sprintf("%s: save vault", s.vaultName())); err != nil {
+		return report, err
+	}
+	branch, err := s.git("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return report, fmt.Errorf("vault repository has no commits yet: %w", err)
+	}
+	if _, err := s.git("fetch", "--quiet", report.Remote); err != nil {
+		return report, err
+	}
+	upstream := report.Remote + "/" + branch
+
+	current, err := s.fileStore.Load(key)
+	if err != nil {
+		return report, err
+	}
+
+	// 2
+	if _, err := s.git("rev-parse", "--verify", "--quiet", upstream); err != nil {
+		if _, err := s.git("push", "--quiet", "-u", report.Remote, branch); err != nil {
+			return report, err
+		}
+		report.Pushed = true
+		return report, nil
+	}
+
+	head, _ := s.git("rev-parse", "HEAD")
+	remote, _ := s.git("rev-parse", upstream)
+	switch {
+	case head == remote:
+		return report, nil
+
+	case s.isAncestor(remote, head):
+		// Удалённая сторона отстаёт - только отправить
+
+	// 3
+	case s.isAncestor(head, remote):
+		if _, err := s.git("merge", "--quiet", "--ff-only", upstream); err != nil {
+			return report, err
+		}
+		merged, err := s.fileStore.Load(key)
+		if err != nil {
+			return report, err
+		}
+		report.Pulled, report.FastForward = true, true
+		report.Incoming = diffEntries(current, merged)
+		s.snapshot = copyPasswords(merged)
+		return report, nil
+
+	// 4
+	default:
+		merged, err := s.mergeDiverged(key, upstream, &report)
+		if err != nil {
+			return report, err
+		}
+		report.Incoming = diffEntries(current, merged)
+		current = merged
+	}
+
+	// 5
+	if _, err := s.git("push", "--quiet", report.Remote, branch); err != nil {
+		return report, err
+	}
+	report.Pushed = true
+	s.snapshot = copyPasswords(current)
+
+	return report, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать и расшифровать версии файла: общего предка, свою и удалённую
+// 2. Слить записи трёхсторонним слиянием, конфликты решаются в пользу более новой записи
+// 3. Запустить git merge; конфликт по файлу хранилища ожидаем, конфликты в других файлах - ошибка
+// 4. Записать результат слияния записей и завершить merge-коммит
+
+func (s *gitStore) mergeDiverged(key []byte, upstream string, report *SyncReport) (map[string]Password, error) {
+	// 1
+	base, err := s.git("merge-base", "HEAD", upstream)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]map[string]Password, 3)
+	for i, rev := range []string{base, "HEAD", upstream} {
+		if versions[i], err = s.loadRevision(key, rev); err != nil {
+			return nil, fmt.Errorf("%s: %w", rev, err)
+		}
+	}
+
+	// 2
+	res := mergeEntries(versions[0], versions[1], versions[2])
+	var conflicts []string
+	for _, c := range res.Conflicts {
+		res.Resolve(c, ResolveNewest)
+		conflicts = append(conflicts, c.Name)
+	}
+	merged := res.Merged
+
+	// 3
+	_, mergeErr := s.git("merge", "--quiet", "--no-ff", "--no-commit", upstream)
+	unmerged, _ := s.git("diff", "--name-only", "--diff-filter=U")
+	if mergeErr != nil && unmerged == "" {
+		return nil, mergeErr
+	}
+	for _, path := range strings.Fields(unmerged) {
+		if path != s.rel {
+			s.git("merge", "--abort")
+			return nil, fmt.Errorf("git merge conflict in %s, resolve it manually", path)
+		}
+	}
+
+	// 4
+	if err := s.fileStore.Save(key, merged); err != nil {
+		s.git("merge", "--abort")
+		return nil, err
+	}
+	message := fmt.Sprintf("%s: merge %s", s.vaultName(), upstream)
+	switch {
+	case len(conflicts) > 0 && appConfig.Git.CommitNames:
+		message += "\n\nConflicts resolved by last modification time:\n" + strings.Join(conflicts, "\n")
+	case len(conflicts) > 0:
+		message += fmt.Sprintf("\n\n%d conflicts resolved by last modification time", len(conflicts))
+	}
+	if _, err := s.git("add", "--", s.rel); err != nil {
+		return nil, err
+	}
+	if _, err := s.git("commit", "--quiet", "-m", message); err != nil {
+		return nil, err
+	}
+
+	report.Pulled, report.Merged = true, true
+	report.Conflicts = conflicts
+	return merged, nil
+}
+
+// Версия хранилища из коммита. Если файла в коммите нет - пустое хранилище
+func (s *gitStore) loadRevision(key []byte, rev string) (map[string]Password, error) {
+	if _, err := s.git("cat-file", "-e", rev+":"+s.rel); err != nil {
+		return map[string]Password{}, nil
+	}
+
+	cmd := exec.Command("git", "-C", s.repo, "show", rev+":"+s.rel)
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return decodeVault(key, data)
+}
+
+func (s *gitStore) isAncestor(a, b string) bool {
+	_, err := s.git("merge-base", "--is-ancestor", a, b)
+	return err == nil
+}
+
+// Последние коммиты файла хранилища
+func (s *gitStore) Log(limit int) (string, error) {
+	return s.git("log", fmt.Sprintf("-n%d", limit), "--date=format:%Y-%m-%d %H:%M", "--format=%h  %ad  %s", "--", s.rel)
+}
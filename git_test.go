@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitMessage(t *testing.T) {
+	changes := []entryChange{
+		{Op: "add", Name: "github"},
+		{Op: "add", Name: "gitlab"},
+		{Op: "update", Name: "bank"},
+	}
+
+	msg := commitMessage("personal", changes)
+	if want := "personal: update vault: 2 added, 1 changed"; msg != want {
+		t.Errorf("got %q, want %q", msg, want)
+	}
+	for _, c := range changes {
+		if strings.Contains(msg, c.Name) {
+			t.Errorf("message %q leaks entry name %q", msg, c.Name)
+		}
+	}
+
+	defer func(names bool) { appConfig.Git.CommitNames = names }(appConfig.Git.CommitNames)
+	appConfig.Git.CommitNames = true
+	msg = commitMessage("personal", changes)
+	if want := "personal: add github, add gitlab, update bank\n\n"; !strings.HasPrefix(msg, want) {
+		t.Errorf("with commit_names: got %q, want prefix %q", msg, want)
+	}
+}
+
+// Изменившийся якорь журнала аудита записывается и коммитится, хотя записи те же,
+// а сохранение без изменений новых коммитов не создаёт
+func TestGitStoreSavesAnchorChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	if _, err := runGit(dir, nil, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	s, ok := newGitStore(newFileStore(filepath.Join(dir, "vault.pm")))
+	if !ok {
+		t.Fatal("vault file is not detected as a git store")
+	}
+	commits := func() string {
+		n, err := s.git("rev-list", "--count", "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	data := map[string]Password{
+		"1":                       {ID: "1", Name: "github", Value: "secret"},
+		auditAnchorPrefix + "dev": {ID: auditAnchorPrefix + "dev", Kind: auditAnchorKind, Notes: "1"},
+	}
+	if err := s.Save(testKey, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(testKey, copyPasswords(data)); err != nil {
+		t.Fatal(err)
+	}
+	if n := commits(); n != "1" {
+		t.Fatalf("unchanged save: %s commits, want 1", n)
+	}
+
+	data = copyPasswords(data)
+	data[auditAnchorPrefix+"dev"] = Password{ID: auditAnchorPrefix + "dev", Kind: auditAnchorKind, Notes: "2"}
+	if err := s.Save(testKey, data); err != nil {
+		t.Fatal(err)
+	}
+	if n := commits(); n != "2" {
+		t.Fatalf("anchor-only save: %s commits, want 2", n)
+	}
+	if msg, _ := s.git("log", "-1", "--format=%s"); msg != "vault: update audit log anchor" {
+		t.Errorf("commit message %q", msg)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Помощник учётных данных git (git credential helper).
+//
+//	git config --global credential.helper 'PasswordManager git-credential'
+//
+// git запускает программу с действием get, store или erase и передаёт в stdin строки
+// "ключ=значение" до пустой строки:
+//
+//	protocol=https
+//	host=github.com
+//	path=org/repo.git     (если включён credential.useHttpPath)
+//	username=alice
+//
+// На get помощник отвечает теми же строками с username и password или не выводит ничего,
+// если подходящей записи нет. Запись подходит, если схема и хост её адреса совпадают
+// с запрошенными, путь (если он указан в записи) совпадает с путём репозитория,
+// а логин (если он передан) - с логином записи
+type gitCredential struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Категория для записей, сохранённых git
+const gitCredentialCategory = "git"
+
+// Нужно ли открывать хранилище для запроса. Неизвестные действия пропускаются (так
+// требует протокол), а без протокола и хоста подобрать запись невозможно
+func gitCredentialWanted(action string, req gitCredential) bool {
+	switch action {
+	case "get", "store", "erase":
+		return req.Protocol != "" && req.Host != ""
+	}
+	return false
+}
+
+func runGitCredential(pm *PasswordManager, action string, req gitCredential, w io.Writer) error {
+	switch action {
+	case "get":
+		return gitCredentialGet(pm, req, w)
+	case "store":
+		return gitCredentialStore(pm, req)
+	case "erase":
+		return gitCredentialErase(pm, req)
+	}
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Читать строки "ключ=значение" до пустой строки или конца ввода
+// 2. Ключ url раскладывается на протокол, хост, путь и логин
+// 3. Прочие ключи (capability[], wwwauth[] и т.п.) не нужны и пропускаются
+
+func readGitCredential(r io.Reader) (gitCredential, error) {
+	var c gitCredential
+
+	// 1
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return c, fmt.Errorf("invalid credential line %q", line)
+		}
+
+		switch key {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		// 2
+		case "url":
+			u, err := url.Parse(value)
+			if err != nil {
+				return c, fmt.Errorf("invalid credential url: %w", err)
+			}
+			c.Protocol, c.Host, c.Path = u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/")
+			if u.User != nil {
+				c.Username = u.User.Username()
+			}
+		}
+		// 3
+	}
+	return c, scanner.Err()
+}
+
+func writeGitCredential(w io.Writer, c gitCredential) error {
+	_, err := fmt.Fprintf(w, "protocol=%s\nhost=%s\nusername=%s\npassword=%s\n", c.Protocol, c.Host, c.Username, c.Password)
+	return err
+}
+
+// Подходит ли запись к запросу. Чем больше результат, тем точнее совпадение:
+// запись с путём точнее записи для всего хоста, а записи категории git
+// предпочтительнее прочих записей того же сайта. При точном сравнении (для store)
+// должны совпадать и логин, и путь
+func (c gitCredential) match(p Password, exact bool) (int, bool) {
+	if !p.isLogin() || !strings.Contains(p.URL, "://") {
+		return 0, false
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return 0, false
+	}
+	if !strings.EqualFold(u.Scheme, c.Protocol) || !strings.EqualFold(u.Host, c.Host) {
+		return 0, false
+	}
+	if (c.Username != "" || exact) && p.Username != c.Username {
+		return 0, false
+	}
+
+	score := 0
+	path := strings.Trim(u.Path, "/")
+	if path != "" || exact {
+		if path != strings.Trim(c.Path, "/") {
+			return 0, false
+		}
+		score += 2
+	}
+	if folderKey(p.Category) == gitCredentialCategory {
+		score++
+	}
+	return score, true
+}
+
+// Записи, подходящие к запросу, от самой точной к наименее точной
+func (c gitCredential) find(pm *PasswordManager, exact bool) []Password {
+	type candidate struct {
+		entry Password
+		score int
+	}
+	var found []candidate
+	for _, p := range pm.ListPasswords() {
+		if score, ok := c.match(p, exact); ok {
+			found = append(found, candidate{p, score})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score > found[j].score
+		}
+		return found[i].entry.Name < found[j].entry.Name
+	})
+
+	entries := make([]Password, len(found))
+	for i, f := range found {
+		entries[i] = f.entry
+	}
+	return entries
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти самую точную запись
+// 2. Прочитать её через GetPassword и вернуть git логин и пароль
+
+func gitCredentialGet(pm *PasswordManager, req gitCredential, w io.Writer) error {
+	// 1
+	found := req.find(pm, false)
+	if len(found) == 0 {
+		return nil
+	}
+
+	// 2
+	p, err := pm.GetPassword(found[0].ID)
+	if err != nil {
+		return err
+	}
+	req.Username = p.Username
+	req.Password = p.Value
+	return writeGitCredential(w, req)
+}
+
+// Алгоритм работы функции:
+//
+// 1. git передаёт логин и пароль, которые подошли к серверу
+// 2. Запись с тем же адресом и логином есть - обновить пароль, если он изменился
+// 3. Иначе создать запись в категории git с именем "host/path (username)"
+// 4. Сохранить хранилище
+//
+// Записи добавляются через ImportPasswords: пароль уже принят сервером,
+// и проверять его надёжность здесь незачем
+
+func gitCredentialStore(pm *PasswordManager, req gitCredential) error {
+	// 1
+	if req.Username == "" || req.Password == "" {
+		return nil
+	}
+	now := time.Now()
+
+	// 2
+	var record Password
+	policy := ConflictOverwrite
+	if found := req.find(pm, true); len(found) > 0 {
+		p, err := pm.GetPassword(found[0].ID)
+		if err != nil {
+			return err
+		}
+		if p.Value == req.Password {
+			return nil
+		}
+		record = p
+		record.Value = req.Password
+		record.LastModified = now
+	} else {
+		// 3
+		location := req.Host
+		if path := strings.Trim(req.Path, "/"); path != "" {
+			location += "/" + path
+		}
+		record = newImportedPassword(fmt.Sprintf("%s (%s)", location, req.Username), req.Password, gitCredentialCategory, now, now)
+		record.Username = req.Username
+		record.URL = req.Protocol + "://" + location
+		policy = ConflictRename
+	}
+
+	if _, err := pm.ImportPasswords([]Password{record}, policy, false); err != nil {
+		return err
+	}
+
+	// 4
+	return pm.SaveToFile()
+}
+
+// Алгоритм работы функции:
+//
+// 1. git отклонил логин и пароль - найти записи категории git с этим адресом и логином.
+//    Записи, созданные вручную в других категориях, не удаляются
+// 2. Если git передал пароль, удалить только записи с этим паролем
+// 3. Сохранить хранилище, если что-то удалено
+
+func gitCredentialErase(pm *PasswordManager, req gitCredential) error {
+	// 1
+	removed := 0
+	for _, p := range req.find(pm, false) {
+		if folderKey(p.Category) != gitCredentialCategory {
+			continue
+		}
+
+		// 2
+		if req.Password != "" {
+			full, err := pm.GetPassword(p.ID)
+			if err != nil {
+				return err
+			}
+			if full.Value != req.Password {
+				continue
+			}
+		}
+		if err := pm.DeletePassword(p.ID); err != nil {
+			return err
+		}
+		removed++
+	}
+
+	// 3
+	if removed == 0 {
+		return nil
+	}
+	return pm.SaveToFile()
+}
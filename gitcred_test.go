@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadGitCredential(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  gitCredential
+	}{
+		{"fields", "protocol=https\nhost=github.com\npath=org/repo.git\nusername=alice\npassword=p=w\n\nhost=ignored\n",
+			gitCredential{Protocol: "https", Host: "github.com", Path: "org/repo.git", Username: "alice", Password: "p=w"}},
+		{"url", "url=https://alice@git.example.com:8443/org/repo.git\ncapability[]=authtype\n",
+			gitCredential{Protocol: "https", Host: "git.example.com:8443", Path: "org/repo.git", Username: "alice"}},
+		{"crlf", "protocol=https\r\nhost=github.com\r\n\r\n",
+			gitCredential{Protocol: "https", Host: "github.com"}},
+	} {
+		got, err := readGitCredential(strings.NewReader(tc.input))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := readGitCredential(strings.NewReader("protocol\n")); err == nil {
+		t.Error("line without '=' accepted")
+	}
+}
+
+// store сохраняет учётные данные, get находит самую точную запись, erase удаляет только записи git
+func TestGitCredentialHelper(t *testing.T) {
+	pm := testManager(t)
+	if err := pm.SaveEntry(Password{Name: "github", Username: "alice", URL: "https://github.com", Value: "Site#Pass1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(input string) string {
+		t.Helper()
+		req, err := readGitCredential(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := runGitCredential(pm, "get", req, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	if got := get("protocol=https\nhost=github.com\n"); !strings.Contains(got, "password=Site#Pass1\n") {
+		t.Fatalf("get: %q", got)
+	}
+	if got := get("protocol=https\nhost=gitlab.com\n"); got != "" {
+		t.Fatalf("get for another host: %q", got)
+	}
+
+	repo := gitCredential{Protocol: "https", Host: "github.com", Path: "org/repo.git", Username: "alice", Password: "Token#1"}
+	if err := runGitCredential(pm, "store", repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("protocol=https\nhost=github.com\npath=org/repo.git\n"); !strings.Contains(got, "password=Token#1\n") {
+		t.Fatalf("get with path: %q", got)
+	}
+
+	repo.Password = "Token#2"
+	if err := runGitCredential(pm, "store", repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pm.ListPasswords()); n != 2 {
+		t.Fatalf("%d entries after updating a stored credential, want 2", n)
+	}
+
+	if err := runGitCredential(pm, "erase", gitCredential{Protocol: "https", Host: "github.com", Path: "org/repo.git", Username: "alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	entries := pm.ListPasswords()
+	if len(entries) != 1 || entries[0].Name != "github" {
+		t.Fatalf("after erase: %+v", entries)
+	}
+}
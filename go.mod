@@ -2,9 +2,9 @@ module PasswordManager
 
 go 1.25
 
-require golang.org/x/crypto v0.44.0
-
 require (
-	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/term v0.37.0 // indirect
+	golang.org/x/crypto v0.44.0
+	golang.org/x/term v0.37.0
 )
+
+require golang.org/x/sys v0.38.0 // indirect
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,16 +17,11 @@ import (
 func HandlePasswordGeneration(pm *PasswordManager) error {
 	clearScreen()
 
-	input, err := ReadUserInput("Enter password length (min 8): ")
+	length, err := readPasswordLength()
 	if err != nil {
 		return err
 	}
 
-	length, err := strconv.Atoi(input)
-	if err != nil {
-		return fmt.Errorf("invalid input: %w", err)
-	}
-
 	pass, err := pm.GeneratePassword(length)
 	if err != nil {
 		return fmt.Errorf("generation failed: %w", err)
@@ -43,10 +39,10 @@ func HandlePasswordGeneration(pm *PasswordManager) error {
 
 // Алгоритм работы
 //
-// 1. Запросить имя сервиса
-// 2. Предложить ввести пароль или сгенерировать новый
-// 3. Запросить категорию
-// 4. Сохранить пароль
+// 1. Запросить имя сервиса и тип записи
+// 2. Запросить поля по схеме типа (пароль записи login можно сгенерировать)
+// 3. Запросить категорию и необязательные теги
+// 4. Сохранить запись
 // 5. Показать результат операции
 
 func HandlePasswordAdd(pm *PasswordManager) error {
@@ -56,22 +52,36 @@ func HandlePasswordAdd(pm *PasswordManager) error {
 		return err
 	}
 
-	input, err := passInput(pm)
+	schema, err := readEntryKind()
 	if err != nil {
 		return err
 	}
 
+	// 2
+	entry := Password{Name: nameInput, Kind: schema.Kind}
+	if err = readKindFields(pm, schema, &entry, false); err != nil {
+		return err
+	}
+
 	clearScreen()
-	catInput, err := ReadUserInput("Enter category: ")
+	catInput, err := ReadUserInput("Enter folder (e.g. work/aws): ")
 	if err != nil {
 		return err
 	}
 
-	if err = pm.SavePassword(nameInput, input, catInput); err != nil {
+	tagsInput, err := readOptionalInput("Enter tags, comma separated (optional): ")
+	if err != nil {
 		return err
 	}
 
-	showSuccess("Password saved successfully\n")
+	// 4
+	entry.Category = catInput
+	entry.Tags = splitTags(tagsInput)
+	if err = pm.SaveEntry(entry); err != nil {
+		return err
+	}
+
+	showSuccess("Entry saved successfully\n")
 
 	waitForEnter()
 
@@ -80,29 +90,44 @@ func HandlePasswordAdd(pm *PasswordManager) error {
 
 // Алгоритм работы
 //
-// 1. Запросить имя сервиса
-// 2. Найти пароль
-// 3. Показать детальную информацию
-// 4. Обработать случай отсутствия пароля
+// 1. Запросить поисковый запрос (нечёткий, 'точный или /регулярное выражение)
+// 2. Найти подходящие записи по имени и категории
+// 3. Предложить выбрать запись из пронумерованного списка
+// 4. Показать детальную информацию
+// 5. Обработать случай отсутствия совпадений
 
 func HandlePasswordSearch(pm *PasswordManager) error {
 	clearScreen()
-	nameInput, err := ReadUserInput("Enter service name: ")
+	query, err := ReadUserInput("Enter search query (fuzzy, 'exact or /regex): ")
 	if err != nil {
 		return err
 	}
 
-	pass, err := pm.GetPassword(nameInput)
+	// 2
+	mode, query := ParseSearchQuery(query)
+	results, err := pm.Search(query, mode)
 	if err != nil {
 		return err
 	}
 
+	// 5
+	if len(results) == 0 {
+		return ErrPassNotFound
+	}
+
+	// 3
+	pass, err := SelectSearchResult(results)
+	if err != nil {
+		return err
+	}
+
+	// 4
+	if err := pm.RecordAudit(auditEntry(AuditGet, pass, "")); err != nil {
+		return err
+	}
+	clearScreen()
 	fmt.Println("Password Details:")
-	fmt.Println("Service:", pass.Name)
-	fmt.Println("Category:", pass.Category)
-	fmt.Println("Password:", pass.Value)
-	fmt.Println("Created:", pass.CreatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Println("Last Modified:", pass.LastModified.Format("2006-01-02 15:04:05"))
+	ShowPasswordDetails(pass)
 
 	fmt.Println()
 
@@ -113,28 +138,81 @@ func HandlePasswordSearch(pm *PasswordManager) error {
 
 // Алгоритм работы
 //
-// 1. Запросить имя сервиса
-// 2. Запросить новый пароль
-// 3. Обновить запись
+// 1. Запросить имя сервиса или ID и найти запись; из нескольких аккаунтов выбрать один
+// 2. Запросить новое имя и папку, затем поля по схеме типа записи и теги.
+//    Enter оставляет текущее значение, "-" очищает необязательное поле
+// 3. Собрать изменённые поля и обновить запись
 // 4. Показать результат обновления
 
 func HandlePasswordUpdate(pm *PasswordManager) error {
 	clearScreen()
-	nameInput, err := ReadUserInput("Enter service name: ")
+	nameInput, err := ReadUserInput("Enter service name or ID: ")
+	if err != nil {
+		return err
+	}
+
+	entry, err := SelectEntry(pm, nameInput)
+	if err != nil {
+		return err
+	}
+	schema, err := FindKind(entry.Kind)
 	if err != nil {
 		return err
 	}
 
-	newValue, err := passInput(pm)
+	// 2
+	fmt.Printf("Editing %s (%s). Enter keeps the current value, \"-\" clears an optional field.\n", entry.Name, schema.Title)
+	name, err := readEditInput("Name", entry.Name)
+	if err != nil {
+		return err
+	}
+	folder, err := readEditInput("Folder", entry.Category)
+	if err != nil {
+		return err
+	}
+	edited := entry
+	if err = readKindFields(pm, schema, &edited, true); err != nil {
+		return err
+	}
+	tags, err := readEditInput("Tags, comma separated", strings.Join(entry.Tags, ", "))
 	if err != nil {
 		return err
 	}
 
-	if err = pm.UpdatePassword(nameInput, newValue); err != nil {
+	// 3
+	patch := EntryPatch{Fields: make(map[string]string)}
+	if name != "" && name != entry.Name {
+		patch.Name = &name
+	}
+	if folder == "-" {
+		folder = ""
+		patch.Category = &folder
+	} else if folder != "" {
+		patch.Category = &folder
+	}
+	for _, f := range schema.Fields {
+		if value := edited.Field(f.Key); value != entry.Field(f.Key) {
+			patch.Fields[f.Key] = value
+		}
+	}
+	if tags == "-" {
+		patch.Tags = new([]string)
+	} else if tags != "" {
+		newTags := splitTags(tags)
+		patch.Tags = &newTags
+	}
+
+	updated, changed, err := pm.EditEntry(entry.ID, patch)
+	if err != nil {
 		return err
 	}
 
-	showSuccess("Password updated successfully!\n")
+	// 4
+	if changed {
+		showSuccess(fmt.Sprintf("Entry %s updated successfully!\n", entryLabel(updated)))
+	} else {
+		showInfo("Nothing changed\n")
+	}
 
 	waitForEnter()
 
@@ -165,16 +243,30 @@ func HandleExitAndSave(pm *PasswordManager) error {
 
 // Алгоритм работы
 //
-// 1. Пройти по всем элементам []Password и вывести значения
-// 2. Обработать ошибки
+// 1. Запросить необязательный фильтр по типу записи
+// 2. Пройти по всем элементам []Password и вывести значения
+// 3. Обработать ошибки
 
 func HandlePasswordsList(pm *PasswordManager) error {
 	clearScreen()
 
+	// 1
+	kind, err := readOptionalInput(fmt.Sprintf("Filter by type (%s; Enter = all): ", strings.Join(kindNames(), ", ")))
+	if err != nil {
+		return err
+	}
+
+	// 2
 	passwords := pm.ListPasswords()
-	fmt.Printf("Total passwords: %d\n\n", len(passwords))
+	if kind != "" {
+		if _, err := FindKind(kind); err != nil {
+			return err
+		}
+		passwords = pm.GetPasswordsByKind(kind)
+	}
+	fmt.Printf("Total entries: %d\n\n", len(passwords))
 	for _, p := range passwords {
-		fmt.Printf("Service: %-25s Category: %-15s CreatedAt: %s\n", p.Name, p.Category, p.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("ID: %s  Service: %-25s Type: %-9s Category: %-15s CreatedAt: %s\n", shortID(p.ID), p.Name, p.EntryKind(), p.Category, p.CreatedAt.Format("2006-01-02 15:04:05"))
 	}
 
 	fmt.Println()
@@ -185,19 +277,23 @@ func HandlePasswordsList(pm *PasswordManager) error {
 
 // Алгоритм работы
 //
-// 1. Ввести имя сервиса
+// 1. Ввести имя сервиса или ID; из нескольких аккаунтов выбрать один
 // 2. Удалить пароль
 // 3. Обработать ошибки
 
 func HandlePasswordDelete(pm *PasswordManager) error {
 	clearScreen()
 
-	nameInput, err := ReadUserInput("Enter service name: ")
+	nameInput, err := ReadUserInput("Enter service name or ID: ")
 	if err != nil {
 		return err
 	}
 
-	if err := pm.DeletePassword(nameInput); err != nil {
+	entry, err := SelectEntry(pm, nameInput)
+	if err != nil {
+		return err
+	}
+	if err := pm.DeletePassword(entry.ID); err != nil {
 		return err
 	}
 
@@ -208,15 +304,34 @@ func HandlePasswordDelete(pm *PasswordManager) error {
 	return nil
 }
 
+// Алгоритм работы
+//
+// 1. Показать дерево папок с числом записей, включая вложенные папки
+// 2. Предложить выбрать папку и показать её записи вместе с вложенными
+
 func HandlePasswordListCategories(pm *PasswordManager) error {
 	clearScreen()
 
-	categories := pm.ListCategories()
-	fmt.Printf("Total categories: %d\n\n", len(categories))
-	fmt.Println("List of categories:")
-	for _, category := range categories {
-		count := len(pm.GetPasswordsByCategory(category))
-		fmt.Printf("- %s (%d passwords)\n", category, count)
+	// 1
+	tree := pm.FolderTree()
+	fmt.Printf("Total entries: %d, without folder: %d\n\n", tree.Total, tree.Entries)
+	for _, line := range tree.Lines() {
+		fmt.Println(line)
+	}
+
+	// 2
+	fmt.Println()
+	folder, err := readOptionalInput("Show entries of folder (Enter to go back): ")
+	if err != nil || NormalizeFolder(folder) == "" {
+		return err
+	}
+	entries := pm.GetPasswordsInFolder(folder)
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: %s", ErrFolderNotFound, NormalizeFolder(folder))
+	}
+	fmt.Println()
+	for _, p := range entries {
+		fmt.Printf("Service: %-25s Type: %-9s Folder: %s\n", p.Name, p.EntryKind(), p.Category)
 	}
 
 	fmt.Println()
@@ -263,10 +378,14 @@ func HandlePasswordDuplicate(pm *PasswordManager) error {
 		fmt.Println("Duplicates not found")
 	} else {
 		fmt.Printf("\nFound duplicates:\n")
-		for password, services := range duplicates {
+		entries := make(map[string]Password)
+		for _, p := range pm.ListPasswords() {
+			entries[p.ID] = p
+		}
+		for password, ids := range duplicates {
 			fmt.Printf("\nPassword '%s' is used in the following services:\n", password)
-			for _, service := range services {
-				fmt.Printf("- %s\n", service)
+			for _, id := range ids {
+				fmt.Printf("- %s\n", entryLabel(entries[id]))
 			}
 		}
 	}
@@ -276,3 +395,257 @@ func HandlePasswordDuplicate(pm *PasswordManager) error {
 
 	return nil
 }
+
+// Алгоритм работы
+//
+// 1. Выбрать формат из списка поддерживаемых
+// 2. Запросить путь к файлу и политику конфликтов
+// 3. Разобрать файл и показать итог пробного импорта
+// 4. После подтверждения выполнить импорт
+
+func HandlePasswordImport(pm *PasswordManager) error {
+	clearScreen()
+
+	// 1
+	fmt.Println("Supported formats:")
+	for i, imp := range importers {
+		fmt.Printf("%d. %-10s %s\n", i+1, imp.Name(), imp.Description())
+	}
+	fmt.Println()
+
+	input, err := ReadUserInput("Select format: ")
+	if err != nil {
+		return err
+	}
+	choice, err := strconv.Atoi(input)
+	if err != nil || choice < 1 || choice > len(importers) {
+		return fmt.Errorf("%w: %s", ErrImportFormat, input)
+	}
+	imp := importers[choice-1]
+	if pi, ok := imp.(PassphraseImporter); ok {
+		fmt.Print("Enter file password: ")
+		passphrase, err := readPassword()
+		if err != nil {
+			return err
+		}
+		imp = pi.WithPassphrase(passphrase)
+	}
+
+	// 2
+	path, err := ReadUserInput("Enter path to export file: ")
+	if err != nil {
+		return err
+	}
+
+	input, err = ReadUserInput("On name conflict (skip/overwrite/rename): ")
+	if err != nil {
+		return err
+	}
+	policy, err := ParseConflictPolicy(input)
+	if err != nil {
+		return err
+	}
+
+	// 3
+	records, err := ParseImportFile(imp, path)
+	if err != nil {
+		return err
+	}
+
+	report, err := pm.ImportPasswords(records, policy, true)
+	if err != nil {
+		return err
+	}
+
+	clearScreen()
+	PrintImportReport(report)
+	fmt.Println()
+
+	// 4
+	ok, err := confirmAction("Apply import?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		showInfo("Import cancelled")
+		waitForEnter()
+		return nil
+	}
+
+	if _, err := pm.ImportPasswords(records, policy, false); err != nil {
+		return err
+	}
+
+	showSuccess(fmt.Sprintf("Imported %d records from %s\n", len(records)-report.Invalid-len(report.Skipped), imp.Name()))
+
+	waitForEnter()
+
+	return nil
+}
+
+// Алгоритм работы
+//
+// 1. Выбрать формат и необязательный фильтр по категории или тегу
+// 2. Для открытого текста показать предупреждение и потребовать явное подтверждение
+// 3. Для архива и базы KDBX запросить пароль файла
+// 4. Записать экспорт в журнал аудита и записать файл с правами 0600
+
+func HandlePasswordExport(pm *PasswordManager) error {
+	clearScreen()
+
+	// 1
+	input, err := ReadUserInput("Export format (csv/json/archive/kdbx): ")
+	if err != nil {
+		return err
+	}
+	format, err := ParseExportFormat(input)
+	if err != nil {
+		return err
+	}
+
+	var filter ExportFilter
+	if filter.Category, err = readOptionalInput("Only category (Enter for all): "); err != nil {
+		return err
+	}
+	if filter.Tag, err = readOptionalInput("Only tag (Enter for all): "); err != nil {
+		return err
+	}
+
+	passwords, err := pm.ExportPasswords(filter)
+	if err != nil {
+		return err
+	}
+	if len(passwords) == 0 {
+		return ErrPassNotFound
+	}
+
+	path, err := ReadUserInput("Enter output file path: ")
+	if err != nil {
+		return err
+	}
+
+	// 2
+	passphrase := ""
+	if format.IsPlaintext() {
+		showError(fmt.Sprintf("WARNING: %d passwords will be written to %s UNENCRYPTED.", len(passwords), path))
+		showInfo("Anyone with access to this file can read them. Delete it as soon as you are done.")
+		input, err := ReadUserInput("Type 'yes' to continue: ")
+		if err != nil {
+			return err
+		}
+		if input != "yes" {
+			showInfo("Export cancelled")
+			waitForEnter()
+			return nil
+		}
+	} else {
+		// 3
+		fmt.Print("Enter password for the exported file: ")
+		if passphrase, err = readPassword(); err != nil {
+			return err
+		}
+		fmt.Print("Repeat password: ")
+		repeat, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if repeat != passphrase {
+			return fmt.Errorf("passwords do not match")
+		}
+	}
+
+	// 4
+	if err := pm.RecordAudit(AuditEvent{Op: AuditExport, Detail: fmt.Sprintf("%d entries, %s, %s", len(passwords), format, path)}); err != nil {
+		return err
+	}
+	if err := WriteExportFile(path, format, passwords, passphrase); err != nil {
+		return err
+	}
+
+	showSuccess(fmt.Sprintf("Exported %d passwords to %s\n", len(passwords), path))
+	if format == ExportCSV {
+		for _, p := range passwords {
+			if len(p.Attachments) > 0 {
+				showInfo("CSV has no place for attachments: use json, archive or kdbx to keep them")
+				break
+			}
+		}
+	}
+
+	waitForEnter()
+
+	return nil
+}
+
+// Алгоритм работы
+//
+// 1. Запустить полноэкранный интерфейс
+// 2. После выхода вернуться в главное меню
+
+func HandleInteractiveMode(pm *PasswordManager) error {
+	clearScreen()
+
+	pm.SetAuditSource("tui")
+	defer pm.SetAuditSource("")
+	return RunTUI(pm)
+}
+
+// Алгоритм работы
+//
+// 1. Показать список хранилищ из реестра и выбрать одно
+// 2. Открыть и заблокировать выбранное хранилище, запросить его мастер-пароль
+// 3. Сохранить и закрыть текущее хранилище
+// 4. При любой ошибке остаться в текущем хранилище
+
+func HandleVaultSwitch(reg *VaultRegistry, current *vaultSession) (*vaultSession, error) {
+	clearScreen()
+
+	// 1
+	fmt.Println("=== Vaults ===")
+	for i, v := range reg.Vaults {
+		mark := " "
+		if v.Name == current.Name {
+			mark = "*"
+		}
+		fmt.Printf("%s %d. %s (%s)\n", mark, i+1, v.Name, v.URI)
+	}
+	fmt.Println()
+
+	input, err := ReadUserInput("Select vault number or enter name: ")
+	if err != nil {
+		return current, err
+	}
+	ref := input
+	if n, err := strconv.Atoi(input); err == nil {
+		if n < 1 || n > len(reg.Vaults) {
+			return current, fmt.Errorf("invalid choice: %d", n)
+		}
+		ref = reg.Vaults[n-1].Name
+	}
+	if ref == current.Name {
+		return current, nil
+	}
+
+	// 2
+	next, err := openVaultSession(reg, ref)
+	if err != nil {
+		return current, err
+	}
+	clearScreen()
+	if err := unlockVaultSession(next); err != nil {
+		next.Close()
+		return current, err
+	}
+
+	// 3
+	if err := current.PM.SaveToFile(); err != nil {
+		next.Close()
+		return current, fmt.Errorf("saving %s: %w", current.Name, err)
+	}
+	current.Close()
+
+	showSuccess(fmt.Sprintf("Switched to vault %s", next.Name))
+	waitForEnter()
+
+	return next, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Личность пользователя для командных хранилищ: пара ключей X25519 (получение ключа
+// данных хранилища) и Ed25519 (подпись изменений). Закрытые ключи хранятся в
+// $XDG_CONFIG_HOME/passwordmanager/identity.json, зашифрованные паролем личности
+type Identity struct {
+	Name     string
+	exchange *ecdh.PrivateKey
+	signing  ed25519.PrivateKey
+}
+
+// Открытая часть личности, которую пользователь передаёт владельцу хранилища
+type PublicIdentity struct {
+	exchange *ecdh.PublicKey
+	signing  ed25519.PublicKey
+}
+
+const (
+	identityFileName = "identity.json"
+	// Префикс строкового представления открытого ключа
+	publicIdentityPrefix = "pmid1:"
+)
+
+type identityFile struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+	Salt      []byte `json:"salt"`
+	Nonce     []byte `json:"nonce"`
+	// AES-256-GCM(X25519 закрытый ключ || Ed25519 seed)
+	Sealed []byte `json:"sealed"`
+}
+
+func identityPath() (string, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, identityFileName), nil
+}
+
+// Ключ шифрования файла личности. key - ключ, полученный из пароля (masterKeyFromPassword)
+func identityKey(key, salt []byte) []byte {
+	return argon2.IDKey(key, salt, archiveTime, archiveMemoryKiB, archiveThreads, MasterKeySize)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Не перезаписывать существующую личность
+// 2. Сгенерировать пары ключей X25519 и Ed25519
+// 3. Зашифровать закрытые ключи ключом из пароля (Argon2id + AES-GCM)
+// 4. Записать файл с правами 0600
+
+func CreateIdentity(name string, key []byte) (*Identity, error) {
+	path, err := identityPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1
+	if _, err := os.Stat(path); err == nil {
+		return nil, ErrIdentityExists
+	}
+
+	// 2
+	exchange, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	_, signing, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{Name: name, exchange: exchange, signing: signing}
+
+	// 3
+	f := identityFile{Name: name, PublicKey: id.Public(), Salt: randomBytes(archiveSaltSize)}
+	gcm, err := newGCM(identityKey(key, f.Salt))
+	if err != nil {
+		return nil, err
+	}
+	f.Nonce = randomBytes(gcm.NonceSize())
+	secret := append(exchange.Bytes(), signing.Seed()...)
+	f.Sealed = gcm.Seal(nil, f.Nonce, secret, []byte(f.PublicKey))
+
+	// 4
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+func readIdentityFile() (identityFile, error) {
+	var f identityFile
+
+	path, err := identityPath()
+	if err != nil {
+		return f, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, ErrNoIdentity
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f, nil
+}
+
+// Имя и открытый ключ без расшифровки закрытых ключей
+func ReadPublicIdentity() (string, string, error) {
+	f, err := readIdentityFile()
+	return f.Name, f.PublicKey, err
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать файл личности
+// 2. Расшифровать закрытые ключи; ошибка GCM означает неверный пароль
+// 3. Восстановить ключи
+
+func LoadIdentity(key []byte) (*Identity, error) {
+	// 1
+	f, err := readIdentityFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2
+	gcm, err := newGCM(identityKey(key, f.Salt))
+	if err != nil {
+		return nil, err
+	}
+	secret, err := gcm.Open(nil, f.Nonce, f.Sealed, []byte(f.PublicKey))
+	if err != nil {
+		return nil, ErrIdentityPassphrase
+	}
+	if len(secret) != 32+ed25519.SeedSize {
+		return nil, fmt.Errorf("identity file is corrupted")
+	}
+
+	// 3
+	exchange, err := ecdh.X25519().NewPrivateKey(secret[:32])
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Name: f.Name, exchange: exchange, signing: ed25519.NewKeyFromSeed(secret[32:])}, nil
+}
+
+// Строка вида pmid1:<base64(X25519 || Ed25519)>
+func (id *Identity) Public() string {
+	raw := append(id.exchange.PublicKey().Bytes(), id.signing.Public().(ed25519.PublicKey)...)
+	return publicIdentityPrefix + base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func ParsePublicIdentity(s string) (PublicIdentity, error) {
+	var pub PublicIdentity
+
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), publicIdentityPrefix)
+	if !ok {
+		return pub, fmt.Errorf("%w: missing %s prefix", ErrPublicKey, publicIdentityPrefix)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 32+ed25519.PublicKeySize {
+		return pub, ErrPublicKey
+	}
+	if pub.exchange, err = ecdh.X25519().NewPublicKey(raw[:32]); err != nil {
+		return pub, ErrPublicKey
+	}
+	pub.signing = ed25519.PublicKey(raw[32:])
+
+	return pub, nil
+}
+
+// Короткий отпечаток ключа для показа пользователю
+func fingerprint(public string) string {
+	s := strings.TrimPrefix(public, publicIdentityPrefix)
+	if len(s) > 16 {
+		s = s[:16]
+	}
+	return s
+}
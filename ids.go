@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Каждая запись имеет постоянный ID (UUID), а имя - только отображаемое поле,
+// поэтому в хранилище может быть несколько записей с одним именем (два аккаунта GitHub).
+// Записи ищутся по ID, по имени или по началу ID не короче shortIDLen символов
+
+const shortIDLen = 8
+
+// Пространство имён UUID v5 для ID записей из хранилищ, где записи хранились по имени
+var legacyIDNamespace = [16]byte{0x6f, 0x1c, 0x2e, 0x4a, 0x93, 0x57, 0x4d, 0x0b, 0xa8, 0x21, 0x5e, 0x7d, 0xc4, 0x3a, 0x90, 0x12}
+
+// Новый ID записи - случайный UUID v4
+func newEntryID() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return formatUUID(u)
+}
+
+// ID записи старого хранилища - UUID v5 от имени. Две копии одного хранилища,
+// переведённые на ID независимо, получают одинаковые ID, и их по-прежнему можно слить
+func legacyEntryID(name string) string {
+	h := sha1.New()
+	h.Write(legacyIDNamespace[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// ID записи в виде 16 байт: так UUID записи хранит KeePass
+func uuidBytes(id string) ([16]byte, bool) {
+	var u [16]byte
+	raw, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+	if err != nil || len(raw) != len(u) {
+		return u, false
+	}
+	copy(u[:], raw)
+	return u, true
+}
+
+func shortID(id string) string {
+	if len(id) > shortIDLen {
+		return id[:shortIDLen]
+	}
+	return id
+}
+
+// Алгоритм работы функции:
+//
+// 1. Записи без ID (хранилище, где ключ map - имя записи) получают ID от ключа
+// 2. Собрать map по ID; у записей с ID ключ берётся из самой записи
+
+func migrateEntryIDs(passwords map[string]Password) map[string]Password {
+	res := make(map[string]Password, len(passwords))
+	for key, p := range passwords {
+		// 1
+		if p.ID == "" {
+			p.ID = legacyEntryID(key)
+		}
+		// 2
+		res[p.ID] = p
+	}
+	return res
+}
+
+// Строка записи для списков выбора: имя, логин, папка и короткий ID
+func entryLabel(p Password) string {
+	var details []string
+	if p.Username != "" {
+		details = append(details, p.Username)
+	}
+	if p.Category != "" {
+		details = append(details, p.Category)
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("%s [%s]", p.Name, shortID(p.ID))
+	}
+	return fmt.Sprintf("%s (%s) [%s]", p.Name, strings.Join(details, ", "), shortID(p.ID))
+}
+
+func sortEntries(entries []Password) {
+	slices.SortFunc(entries, func(a, b Password) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Username, b.Username); c != 0 {
+			return c
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+}
+
+// Алгоритм работы функции:
+//
+// 1. Точное совпадение ID
+// 2. Записи с таким именем
+// 3. Записи, ID которых начинается с ref (не короче shortIDLen символов)
+
+func (pm *PasswordManager) findEntriesLocked(ref string) []Password {
+	// 1
+	if p, ok := pm.passwords[ref]; ok {
+		return []Password{p}
+	}
+
+	// 2
+	var res []Password
+	for _, p := range pm.passwords {
+		if p.Name == ref {
+			res = append(res, p)
+		}
+	}
+
+	// 3
+	if len(res) == 0 && len(ref) >= shortIDLen {
+		for id, p := range pm.passwords {
+			if strings.HasPrefix(id, strings.ToLower(ref)) {
+				res = append(res, p)
+			}
+		}
+	}
+
+	sortEntries(res)
+	return res
+}
+
+// Все записи, подходящие под ссылку (ID, имя или начало ID)
+func (pm *PasswordManager) FindEntries(ref string) []Password {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.findEntriesLocked(ref)
+}
+
+// ID единственной записи по ссылке; несколько записей с одним именем - ErrEntryAmbiguous
+// со списком их ID, чтобы можно было повторить команду с ID
+func (pm *PasswordManager) lookupLocked(ref string) (string, error) {
+	matches := pm.findEntriesLocked(ref)
+	switch len(matches) {
+	case 0:
+		return "", ErrPassNotFound
+	case 1:
+		return matches[0].ID, nil
+	}
+	return "", ambiguousEntry(ref, matches)
+}
+
+func ambiguousEntry(ref string, matches []Password) error {
+	labels := make([]string, len(matches))
+	for i, p := range matches {
+		labels[i] = entryLabel(p)
+	}
+	return fmt.Errorf("%w: %q matches %d entries, use an ID: %s", ErrEntryAmbiguous, ref, len(matches), strings.Join(labels, "; "))
+}
+
+// Ключ аккаунта: имя записи и логин без учёта регистра
+func accountKey(name, username string) string {
+	return name + "\x00" + strings.ToLower(username)
+}
+
+// Занят ли аккаунт: запись с тем же именем и логином (без учёта регистра логина).
+// Записи с одним именем и разными логинами - разные аккаунты одного сервиса
+func (pm *PasswordManager) accountTakenLocked(name, username, exceptID string) bool {
+	for id, p := range pm.passwords {
+		if id != exceptID && accountKey(p.Name, p.Username) == accountKey(name, username) {
+			return true
+		}
+	}
+	return false
+}
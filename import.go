@@ -0,0 +1,821 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Категория по умолчанию для записей, у которых в источнике нет папки или группы
+const DefaultImportCategory = "imported"
+
+// Парсер файла экспорта другого менеджера паролей.
+// Чтобы добавить новый формат, достаточно реализовать интерфейс и добавить парсер в importers
+type Importer interface {
+	// Короткое имя формата, по которому его выбирают
+	Name() string
+	// Описание для меню
+	Description() string
+	// Разбор файла в записи Password
+	Parse(r io.Reader) ([]Password, error)
+}
+
+// Парсер зашифрованного формата, которому перед разбором нужен пароль
+type PassphraseImporter interface {
+	Importer
+	WithPassphrase(passphrase string) Importer
+}
+
+var importers = []Importer{
+	bitwardenImporter{},
+	keepassXMLImporter{},
+	chromeCSVImporter{},
+	firefoxCSVImporter{},
+	lastpassCSVImporter{},
+	onePasswordCSVImporter{},
+	kdbxImporter{},
+	archiveImporter{},
+}
+
+func FindImporter(name string) (Importer, error) {
+	for _, imp := range importers {
+		if imp.Name() == strings.ToLower(name) {
+			return imp, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrImportFormat, name)
+}
+
+// Политика разрешения конфликтов при импорте. Конфликт - запись с тем же именем и логином:
+// записи с одним именем и разными логинами - разные аккаунты и добавляются обе
+type ConflictPolicy int
+
+const (
+	// Оставить существующую запись, импортируемую пропустить
+	ConflictSkip ConflictPolicy = iota
+	// Заменить существующую запись импортируемой
+	ConflictOverwrite
+	// Сохранить импортируемую запись под новым именем: "name (2)"
+	ConflictRename
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch strings.ToLower(s) {
+	case "skip":
+		return ConflictSkip, nil
+	case "overwrite":
+		return ConflictOverwrite, nil
+	case "rename":
+		return ConflictRename, nil
+	}
+
+	return ConflictSkip, fmt.Errorf("unknown conflict policy: %s", s)
+}
+
+// Запись, сохранённая под другим именем из-за конфликта
+type RenamedRecord struct {
+	From string
+	To   string
+}
+
+// Итог импорта. При пробном запуске описывает то, что было бы сделано
+type ImportReport struct {
+	Added       []string
+	Overwritten []string
+	Renamed     []RenamedRecord
+	Skipped     []string
+	// Записи без имени или без пароля
+	Invalid int
+	// Вложения сверх attachments.max_file_size или с недопустимым именем: "запись/файл"
+	DroppedAttachments []string
+	DryRun             bool
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что менеджер инициализирован
+// 2. Для каждой записи проверить наличие имени и содержимого (пароля или полей типа)
+// 3. Отбросить вложения, которые нельзя добавить вручную (слишком большие, с путём в имени)
+// 4. При конфликте аккаунтов применить политику (skip, overwrite, rename);
+//    запись с ID, который уже есть в хранилище, конфликтует с этой записью;
+//    перезапись сохраняет ID существующей записи, остальные записи получают свободный ID;
+//    папку привести к написанию, которое уже есть в хранилище или в импорте
+// 5. Если это не пробный запуск - записать добавления и перезаписи в журнал аудита
+//    и сохранить записи в хранилище
+// 6. Вернуть отчёт
+
+func (pm *PasswordManager) ImportPasswords(records []Password, policy ConflictPolicy, dryRun bool) (ImportReport, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	report := ImportReport{DryRun: dryRun}
+
+	// 1
+	if err := pm.passInit(); err != nil {
+		return report, err
+	}
+
+	// Аккаунты существующих и уже импортированных записей -> ID записи
+	taken := make(map[string]string, len(pm.passwords)+len(records))
+	for id, p := range pm.passwords {
+		taken[accountKey(p.Name, p.Username)] = id
+	}
+	usedIDs := make(map[string]bool, len(records))
+
+	spell := pm.folderSpellingsLocked("")
+	result := make(map[string]Password, len(records))
+	for _, rec := range records {
+		// 2
+		if rec.Name == "" || !rec.hasContent() {
+			report.Invalid++
+			continue
+		}
+
+		// 3
+		rec.Attachments, report.DroppedAttachments = importAttachments(rec, report.DroppedAttachments)
+
+		// 4
+		name := rec.Name
+		id, conflict := taken[accountKey(name, rec.Username)]
+		if _, ok := pm.passwords[rec.ID]; ok {
+			id, conflict = rec.ID, true
+		}
+		if conflict {
+			switch policy {
+			case ConflictSkip:
+				report.Skipped = append(report.Skipped, name)
+				continue
+			case ConflictOverwrite:
+				report.Overwritten = append(report.Overwritten, name)
+			case ConflictRename:
+				name = uniqueName(name, func(n string) bool {
+					_, ok := taken[accountKey(n, rec.Username)]
+					return ok
+				})
+				report.Renamed = append(report.Renamed, RenamedRecord{From: rec.Name, To: name})
+				id = ""
+			}
+		} else {
+			report.Added = append(report.Added, name)
+		}
+
+		if id == "" {
+			id = rec.ID
+			if _, exists := pm.passwords[id]; id == "" || exists || usedIDs[id] {
+				id = newEntryID()
+			}
+		}
+		rec.ID, rec.Name = id, name
+		rec.Category = spell.canonical(rec.Category)
+		spell.add(rec.Category)
+		taken[accountKey(name, rec.Username)] = id
+		usedIDs[id] = true
+		result[id] = rec
+	}
+
+	// 5
+	if !dryRun {
+		before := make(map[string]Password, len(result))
+		for id := range result {
+			if p, ok := pm.passwords[id]; ok {
+				before[id] = p
+			}
+		}
+		if err := pm.auditChangesLocked(before, result, "import"); err != nil {
+			return report, err
+		}
+		for id, rec := range result {
+			pm.passwords[id] = rec
+		}
+	}
+
+	// 6
+	return report, nil
+}
+
+// Вложения записи, прошедшие проверки имени и размера; имена отброшенных добавляются к dropped
+func importAttachments(rec Password, dropped []string) ([]Attachment, []string) {
+	var kept []Attachment
+	for _, a := range rec.Attachments {
+		name, err := attachmentName(a.Name)
+		if err != nil || name != a.Name || checkAttachmentSize(name, int64(len(a.Data))) != nil {
+			dropped = append(dropped, rec.Name+"/"+a.Name)
+			continue
+		}
+		if a.SHA256 == "" {
+			a = newAttachment(a.Name, a.Data)
+		}
+		kept = append(kept, a)
+	}
+	return kept, dropped
+}
+
+// Подбор свободного имени вида "name (2)", "name (3)", ...
+func uniqueName(name string, taken func(string) bool) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Открыть файл
+// 2. Разобрать его выбранным парсером
+// 3. Вернуть полученные записи
+
+func ParseImportFile(imp Importer, path string) ([]Password, error) {
+	// 1
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// 2
+	records, err := imp.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", imp.Name(), err)
+	}
+
+	// 3
+	return records, nil
+}
+
+// Создание импортируемой записи с заполнением пустых полей
+func newImportedPassword(name, value, category string, created, modified time.Time) Password {
+	if category == "" {
+		category = DefaultImportCategory
+	}
+	if created.IsZero() {
+		created = time.Now()
+	}
+	if modified.IsZero() {
+		modified = created
+	}
+
+	return Password{
+		Name:         strings.TrimSpace(name),
+		Value:        value,
+		Category:     strings.TrimSpace(category),
+		CreatedAt:    created,
+		LastModified: modified,
+	}
+}
+
+// Разбор списка тегов: KeePass разделяет их ";", остальные - ","
+func splitTags(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' })
+
+	tags := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if t := strings.TrimSpace(f); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// Имя записи из URL, если в источнике нет названия: https://www.github.com/login -> github.com
+func nameFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// Импорт из Bitwarden JSON
+
+type bitwardenImporter struct{}
+
+func (bitwardenImporter) Name() string        { return "bitwarden" }
+func (bitwardenImporter) Description() string { return "Bitwarden JSON (unencrypted)" }
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		Type         int       `json:"type"`
+		Name         string    `json:"name"`
+		Notes        string    `json:"notes"`
+		FolderID     string    `json:"folderId"`
+		CreationDate time.Time `json:"creationDate"`
+		RevisionDate time.Time `json:"revisionDate"`
+		Login        *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+		Card     *bitwardenCard     `json:"card"`
+		Identity *bitwardenIdentity `json:"identity"`
+		SSHKey   *struct {
+			PrivateKey string `json:"privateKey"`
+		} `json:"sshKey"`
+	} `json:"items"`
+}
+
+type bitwardenCard struct {
+	CardholderName string `json:"cardholderName"`
+	Number         string `json:"number"`
+	ExpMonth       string `json:"expMonth"`
+	ExpYear        string `json:"expYear"`
+	Code           string `json:"code"`
+}
+
+type bitwardenIdentity struct {
+	FirstName      string `json:"firstName"`
+	LastName       string `json:"lastName"`
+	Email          string `json:"email"`
+	Phone          string `json:"phone"`
+	Address1       string `json:"address1"`
+	Address2       string `json:"address2"`
+	City           string `json:"city"`
+	State          string `json:"state"`
+	PostalCode     string `json:"postalCode"`
+	Country        string `json:"country"`
+	Company        string `json:"company"`
+	PassportNumber string `json:"passportNumber"`
+	LicenseNumber  string `json:"licenseNumber"`
+	SSN            string `json:"ssn"`
+}
+
+// Типы элементов Bitwarden
+const (
+	bitwardenTypeLogin    = 1
+	bitwardenTypeNote     = 2
+	bitwardenTypeCard     = 3
+	bitwardenTypeIdentity = 4
+	bitwardenTypeSSHKey   = 5
+)
+
+// Bitwarden: логины, заметки, карты, удостоверения и ключи SSH переносятся в записи
+// соответствующих типов, категория - название папки
+func (bitwardenImporter) Parse(r io.Reader) ([]Password, error) {
+	var export bitwardenExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	if export.Encrypted {
+		return nil, fmt.Errorf("encrypted Bitwarden exports are not supported")
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+
+	res := make([]Password, 0, len(export.Items))
+	for _, item := range export.Items {
+		p := newImportedPassword(item.Name, "", folders[item.FolderID], item.CreationDate, item.RevisionDate)
+		p.Notes = item.Notes
+		switch {
+		case item.Type == bitwardenTypeLogin && item.Login != nil:
+			p.Value = item.Login.Password
+			p.Username = item.Login.Username
+			if len(item.Login.URIs) > 0 {
+				p.URL = item.Login.URIs[0].URI
+			}
+		case item.Type == bitwardenTypeNote:
+			// Текст заметки Bitwarden - основное значение записи note
+			p.Kind, p.Value, p.Notes = KindNote, item.Notes, ""
+		case item.Type == bitwardenTypeCard && item.Card != nil:
+			p.Kind = KindCard
+			bitwardenCardFields(&p, *item.Card)
+		case item.Type == bitwardenTypeIdentity && item.Identity != nil:
+			p.Kind = KindIdentity
+			bitwardenIdentityFields(&p, *item.Identity)
+		case item.Type == bitwardenTypeSSHKey && item.SSHKey != nil:
+			p.Kind, p.Value = KindSSHKey, item.SSHKey.PrivateKey
+		default:
+			continue
+		}
+		res = append(res, p)
+	}
+
+	return res, nil
+}
+
+// Номер и срок действия приводятся к общему виду, если проходят проверку, иначе
+// переносятся как есть: импорт не должен терять карты с необычным номером
+func bitwardenCardFields(p *Password, c bitwardenCard) {
+	p.Value = c.Number
+	if number, err := normalizeCardNumber(c.Number); err == nil {
+		p.Value = number
+	}
+	if c.ExpMonth != "" && c.ExpYear != "" {
+		expiry := c.ExpMonth + "/" + c.ExpYear
+		if normalized, err := normalizeCardExpiry(expiry); err == nil {
+			expiry = normalized
+		}
+		p.SetField("expiry", expiry)
+	}
+	p.SetField("holder", c.CardholderName)
+	p.SetField("cvv", c.Code)
+}
+
+// Адрес собирается в одну строку; номер паспорта - основное значение, номера прав
+// и SSN сохраняются в дополнительных полях
+func bitwardenIdentityFields(p *Password, id bitwardenIdentity) {
+	var address []string
+	for _, part := range []string{id.Address1, id.Address2, id.City, id.State, id.PostalCode, id.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			address = append(address, part)
+		}
+	}
+
+	p.Value = id.PassportNumber
+	p.SetField("first_name", id.FirstName)
+	p.SetField("last_name", id.LastName)
+	p.SetField("email", id.Email)
+	p.SetField("phone", id.Phone)
+	p.SetField("address", strings.Join(address, ", "))
+	p.SetField("company", id.Company)
+	p.SetField("license_number", id.LicenseNumber)
+	p.SetField("ssn", id.SSN)
+}
+
+// Импорт из KeePass 2 XML
+
+type keepassXMLImporter struct{}
+
+func (keepassXMLImporter) Name() string        { return "keepass" }
+func (keepassXMLImporter) Description() string { return "KeePass 2 XML export" }
+
+// Модель XML KeePass 2. Используется и для XML-экспорта KeePass, и внутри KDBX 4 (kdbx.go)
+type keepassFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    struct {
+		Generator      string `xml:"Generator,omitempty"`
+		DatabaseName   string `xml:"DatabaseName,omitempty"`
+		RecycleBinUUID string `xml:"RecycleBinUUID,omitempty"`
+	} `xml:"Meta"`
+	Root struct {
+		Groups []keepassGroup `xml:"Group"`
+	} `xml:"Root"`
+	// Содержимое вложений из внутреннего заголовка KDBX; в XML записи ссылаются на номер
+	binaries [][]byte
+}
+
+type keepassGroup struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Entries []keepassEntry `xml:"Entry"`
+	Groups  []keepassGroup `xml:"Group"`
+}
+
+type keepassEntry struct {
+	UUID     string          `xml:"UUID,omitempty"`
+	Tags     string          `xml:"Tags,omitempty"`
+	Times    keepassTimes    `xml:"Times"`
+	Strings  []keepassString `xml:"String"`
+	Binaries []keepassBinary `xml:"Binary"`
+}
+
+type keepassBinary struct {
+	Key   string           `xml:"Key"`
+	Value keepassBinaryRef `xml:"Value"`
+}
+
+type keepassBinaryRef struct {
+	Ref string `xml:"Ref,attr"`
+}
+
+type keepassTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+}
+
+type keepassString struct {
+	Key   string       `xml:"Key"`
+	Value keepassValue `xml:"Value"`
+}
+
+type keepassValue struct {
+	Text string `xml:",chardata"`
+	// "True" - значение зашифровано внутренним потоком KDBX
+	Protected string `xml:"Protected,attr,omitempty"`
+}
+
+func (e keepassEntry) field(key string) string {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return s.Value.Text
+		}
+	}
+	return ""
+}
+
+// Стандартные поля записи KeePass в Password
+func (e keepassEntry) password(category string) Password {
+	created := parseKeePassTime(e.Times.CreationTime)
+	modified := parseKeePassTime(e.Times.LastModificationTime)
+
+	p := newImportedPassword(e.field("Title"), e.field("Password"), category, created, modified)
+	p.Username = e.field("UserName")
+	p.URL = e.field("URL")
+	p.Notes = e.field("Notes")
+	p.Tags = splitTags(e.Tags)
+	if raw, err := base64.StdEncoding.DecodeString(e.UUID); err == nil && len(raw) == 16 {
+		p.ID = formatUUID([16]byte(raw))
+	}
+
+	return p
+}
+
+// KeePass 2 XML хранит время в RFC 3339, KDBX 4 - секунды от 0001-01-01 в base64
+func parseKeePassTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != 8 {
+		return time.Time{}
+	}
+	secs := int64(binary.LittleEndian.Uint64(raw))
+
+	return time.Unix(secs-keepassEpochOffset, 0).UTC()
+}
+
+// Секунды между 0001-01-01 (начало отсчёта KDBX 4) и 1970-01-01
+const keepassEpochOffset = 62135596800
+
+// Алгоритм работы функции:
+//
+// 1. Обойти дерево групп, начиная с корневой
+// 2. Категория записи - путь групп без корневой ("Work/AWS")
+// 3. Корзину пропустить
+
+func (f keepassFile) passwords() []Password {
+	res := make([]Password, 0)
+
+	// 1
+	var walk func(g keepassGroup, path string)
+	walk = func(g keepassGroup, path string) {
+		// 3
+		if f.Meta.RecycleBinUUID != "" && g.UUID == f.Meta.RecycleBinUUID {
+			return
+		}
+		for _, e := range g.Entries {
+			p := e.password(path)
+			p.Attachments = f.attachments(e)
+			res = append(res, p)
+		}
+		// 2
+		for _, sub := range g.Groups {
+			subPath := sub.Name
+			if path != "" {
+				subPath = path + "/" + sub.Name
+			}
+			walk(sub, subPath)
+		}
+	}
+
+	for _, root := range f.Root.Groups {
+		walk(root, "")
+	}
+
+	return res
+}
+
+// Вложения записи по ссылкам на внутренний заголовок KDBX. В XML-экспорте KeePass
+// содержимого нет, и ссылки пропускаются
+func (f keepassFile) attachments(e keepassEntry) []Attachment {
+	var res []Attachment
+	for _, b := range e.Binaries {
+		i, err := strconv.Atoi(b.Value.Ref)
+		if err != nil || i < 0 || i >= len(f.binaries) {
+			continue
+		}
+		res = append(res, newAttachment(b.Key, f.binaries[i]))
+	}
+	return res
+}
+
+func (keepassXMLImporter) Parse(r io.Reader) ([]Password, error) {
+	var file keepassFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	return file.passwords(), nil
+}
+
+// Импорт из CSV (Chrome, Firefox, LastPass, 1Password)
+
+// Чтение CSV в список строк с доступом по имени столбца (без учёта регистра)
+func readCSVRecords(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("empty CSV file")
+	}
+
+	header := make([]string, len(rows[0]))
+	for i, h := range rows[0] {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	}
+
+	res := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := make(map[string]string, len(header))
+		for i, v := range row {
+			if i < len(header) {
+				rec[header[i]] = v
+			}
+		}
+		res = append(res, rec)
+	}
+
+	return res, nil
+}
+
+// Первое непустое значение из нескольких возможных столбцов
+func csvField(rec map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(rec[k]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func requireColumns(rec map[string]string, keys ...string) error {
+	for _, k := range keys {
+		if _, ok := rec[k]; !ok {
+			return fmt.Errorf("missing column %q", k)
+		}
+	}
+	return nil
+}
+
+type chromeCSVImporter struct{}
+
+func (chromeCSVImporter) Name() string { return "chrome" }
+func (chromeCSVImporter) Description() string {
+	return "Chrome/Chromium/Edge CSV (name,url,username,password)"
+}
+
+func (chromeCSVImporter) Parse(r io.Reader) ([]Password, error) {
+	rows, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Password, 0, len(rows))
+	for _, rec := range rows {
+		if err := requireColumns(rec, "url", "password"); err != nil {
+			return nil, err
+		}
+		name := csvField(rec, "name")
+		if name == "" {
+			name = nameFromURL(rec["url"])
+		}
+		p := newImportedPassword(name, rec["password"], "", time.Time{}, time.Time{})
+		p.Username = csvField(rec, "username")
+		p.URL = csvField(rec, "url")
+		p.Notes = csvField(rec, "note")
+		res = append(res, p)
+	}
+
+	return res, nil
+}
+
+type firefoxCSVImporter struct{}
+
+func (firefoxCSVImporter) Name() string        { return "firefox" }
+func (firefoxCSVImporter) Description() string { return "Firefox CSV (url,username,password,...)" }
+
+// Firefox хранит время в миллисекундах с начала эпохи
+func (firefoxCSVImporter) Parse(r io.Reader) ([]Password, error) {
+	rows, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Password, 0, len(rows))
+	for _, rec := range rows {
+		if err := requireColumns(rec, "url", "password"); err != nil {
+			return nil, err
+		}
+		created := unixMillis(rec["timecreated"])
+		modified := unixMillis(rec["timepasswordchanged"])
+		p := newImportedPassword(nameFromURL(rec["url"]), rec["password"], "", created, modified)
+		p.Username = csvField(rec, "username")
+		p.URL = csvField(rec, "url")
+		res = append(res, p)
+	}
+
+	return res, nil
+}
+
+func unixMillis(s string) time.Time {
+	ms, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+type lastpassCSVImporter struct{}
+
+func (lastpassCSVImporter) Name() string { return "lastpass" }
+func (lastpassCSVImporter) Description() string {
+	return "LastPass CSV (url,username,password,extra,name,grouping,...)"
+}
+
+// LastPass: категория - столбец grouping, защищённые заметки (url http://sn) пропускаются
+func (lastpassCSVImporter) Parse(r io.Reader) ([]Password, error) {
+	rows, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Password, 0, len(rows))
+	for _, rec := range rows {
+		if err := requireColumns(rec, "name", "password"); err != nil {
+			return nil, err
+		}
+		if rec["url"] == "http://sn" {
+			continue
+		}
+		name := csvField(rec, "name")
+		if name == "" {
+			name = nameFromURL(rec["url"])
+		}
+		p := newImportedPassword(name, rec["password"], csvField(rec, "grouping"), time.Time{}, time.Time{})
+		p.Username = csvField(rec, "username")
+		p.URL = csvField(rec, "url")
+		p.Notes = csvField(rec, "extra")
+		res = append(res, p)
+	}
+
+	return res, nil
+}
+
+type onePasswordCSVImporter struct{}
+
+func (onePasswordCSVImporter) Name() string { return "1password" }
+func (onePasswordCSVImporter) Description() string {
+	return "1Password CSV (title,url,username,password,...)"
+}
+
+// 1Password: название в title, категория - первый тег, теги сохраняются целиком
+func (onePasswordCSVImporter) Parse(r io.Reader) ([]Password, error) {
+	rows, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Password, 0, len(rows))
+	for _, rec := range rows {
+		if err := requireColumns(rec, "title", "password"); err != nil {
+			return nil, err
+		}
+		name := csvField(rec, "title")
+		if name == "" {
+			name = nameFromURL(csvField(rec, "url", "website"))
+		}
+		tags := splitTags(csvField(rec, "tags"))
+		category := ""
+		if len(tags) > 0 {
+			category = tags[0]
+		}
+		p := newImportedPassword(name, rec["password"], category, time.Time{}, time.Time{})
+		p.Username = csvField(rec, "username")
+		p.URL = csvField(rec, "url", "website")
+		p.Notes = csvField(rec, "notes")
+		p.Tags = tags
+		res = append(res, p)
+	}
+
+	return res, nil
+}
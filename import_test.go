@@ -0,0 +1,234 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Заметки, карты, удостоверения и ключи SSH из Bitwarden становятся записями своих типов
+func TestBitwardenImportKinds(t *testing.T) {
+	const data = `{"encrypted": false, "folders": [], "items": [
+		{"type": 2, "name": "wifi", "notes": "Home#Wifi1", "secureNote": {"type": 0}},
+		{"type": 3, "name": "visa", "card": {"cardholderName": "Alice", "number": "4111 1111 1111 1111",
+			"expMonth": "3", "expYear": "2029", "code": "123"}},
+		{"type": 4, "name": "passport", "identity": {"firstName": "Alice", "lastName": "Smith",
+			"city": "Berlin", "country": "DE", "passportNumber": "X123", "ssn": "000-00-0000"}},
+		{"type": 6, "name": "unknown"}
+	]}`
+
+	got, err := bitwardenImporter{}.Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3", len(got))
+	}
+
+	if note := got[0]; note.Kind != KindNote || note.Value != "Home#Wifi1" || note.Notes != "" {
+		t.Errorf("note: got %+v", note)
+	}
+	card := got[1]
+	if card.Kind != KindCard || card.Value != "4111111111111111" {
+		t.Errorf("card: got kind %q, number %q", card.Kind, card.Value)
+	}
+	for key, want := range map[string]string{"holder": "Alice", "expiry": "03/29", "cvv": "123"} {
+		if card.Field(key) != want {
+			t.Errorf("card %s: got %q, want %q", key, card.Field(key), want)
+		}
+	}
+	id := got[2]
+	if id.Kind != KindIdentity || id.Value != "X123" {
+		t.Errorf("identity: got kind %q, value %q", id.Kind, id.Value)
+	}
+	for key, want := range map[string]string{"first_name": "Alice", "last_name": "Smith", "address": "Berlin, DE", "ssn": "000-00-0000"} {
+		if id.Field(key) != want {
+			t.Errorf("identity %s: got %q, want %q", key, id.Field(key), want)
+		}
+	}
+}
+
+// Поля, которые заполняют парсеры CSV и XML
+type importedFields struct {
+	Name, Username, URL, Value, Category, Notes string
+	Tags                                        []string
+}
+
+func importedOf(p Password) importedFields {
+	return importedFields{p.Name, p.Username, p.URL, p.Value, p.Category, p.Notes, p.Tags}
+}
+
+func TestImportParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		imp     Importer
+		data    string
+		want    []importedFields
+		wantErr bool
+	}{
+		{
+			name: "bitwarden login with folder",
+			imp:  bitwardenImporter{},
+			data: `{"folders": [{"id": "f1", "name": "work"}], "items": [
+				{"type": 1, "name": "github", "folderId": "f1", "notes": "2fa",
+				 "login": {"username": "alice", "password": "Secret#1", "uris": [{"uri": "https://github.com"}]}}]}`,
+			want: []importedFields{{"github", "alice", "https://github.com", "Secret#1", "work", "2fa", nil}},
+		},
+		{
+			name:    "bitwarden encrypted",
+			imp:     bitwardenImporter{},
+			data:    `{"encrypted": true, "items": []}`,
+			wantErr: true,
+		},
+		{
+			name: "keepass nested groups, recycle bin skipped",
+			imp:  keepassXMLImporter{},
+			data: `<KeePassFile><Meta><RecycleBinUUID>bin</RecycleBinUUID></Meta><Root><Group><Name>Root</Name>
+				<Group><Name>Work</Name><Group><Name>AWS</Name><Entry><Tags>cloud;prod</Tags>
+					<String><Key>Title</Key><Value>console</Value></String>
+					<String><Key>UserName</Key><Value>admin</Value></String>
+					<String><Key>Password</Key><Value>Aws#Pass1</Value></String>
+					<String><Key>URL</Key><Value>https://aws.amazon.com</Value></String>
+					<String><Key>Notes</Key><Value>root account</Value></String>
+				</Entry></Group></Group>
+				<Group><UUID>bin</UUID><Name>Recycle Bin</Name><Entry>
+					<String><Key>Title</Key><Value>deleted</Value></String>
+					<String><Key>Password</Key><Value>x</Value></String>
+				</Entry></Group>
+			</Group></Root></KeePassFile>`,
+			want: []importedFields{{"console", "admin", "https://aws.amazon.com", "Aws#Pass1", "Work/AWS", "root account", []string{"cloud", "prod"}}},
+		},
+		{
+			name: "chrome, name from url",
+			imp:  chromeCSVImporter{},
+			data: "\ufeffname,url,username,password,note\n" +
+				"github,https://github.com/login,alice,Secret#1,personal\n" +
+				",https://www.example.com/login,bob,Secret#2,\n",
+			want: []importedFields{
+				{"github", "alice", "https://github.com/login", "Secret#1", DefaultImportCategory, "personal", nil},
+				{"example.com", "bob", "https://www.example.com/login", "Secret#2", DefaultImportCategory, "", nil},
+			},
+		},
+		{
+			name:    "chrome missing password column",
+			imp:     chromeCSVImporter{},
+			data:    "name,url,username\ngithub,https://github.com,alice\n",
+			wantErr: true,
+		},
+		{
+			name: "firefox",
+			imp:  firefoxCSVImporter{},
+			data: `"url","username","password","httpRealm","formActionOrigin","guid","timeCreated","timeLastUsed","timePasswordChanged"` + "\n" +
+				`"https://accounts.google.com","alice","Secret#1",,"https://accounts.google.com","{1}","1700000000000","1700000000000","1700000000000"` + "\n",
+			want: []importedFields{{"accounts.google.com", "alice", "https://accounts.google.com", "Secret#1", DefaultImportCategory, "", nil}},
+		},
+		{
+			name: "lastpass, secure notes skipped",
+			imp:  lastpassCSVImporter{},
+			data: "url,username,password,totp,extra,name,grouping,fav\n" +
+				"https://bank.com,alice,Bank#Pass1,,pin 1234,bank,finance,0\n" +
+				"http://sn,,,,note text,wifi,home,0\n",
+			want: []importedFields{{"bank", "alice", "https://bank.com", "Bank#Pass1", "finance", "pin 1234", nil}},
+		},
+		{
+			name: "1password, category from first tag",
+			imp:  onePasswordCSVImporter{},
+			data: "Title,Website,Username,Password,Notes,Tags\n" +
+				"mail,https://mail.com,alice,Mail#Pass1,,\"personal,email\"\n",
+			want: []importedFields{{"mail", "alice", "https://mail.com", "Mail#Pass1", "personal", "", []string{"personal", "email"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.imp.Parse(strings.NewReader(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %d entries, want error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, p := range got {
+				if g := importedOf(p); !reflect.DeepEqual(g, tt.want[i]) {
+					t.Errorf("entry %d: got %+v, want %+v", i, g, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// Политики конфликтов: пробный запуск сообщает то же, что и настоящий импорт,
+// но хранилище не меняет
+func TestImportConflictPolicies(t *testing.T) {
+	existing := []Password{{Name: "github", Username: "alice", Value: "Old#Pass1", Category: "work"}}
+	records := []Password{
+		{Name: "github", Username: "alice", Value: "New#Pass1", Category: "work"},
+		{Name: "github", Username: "bob", Value: "Bob#Pass1", Category: "work"},
+		{Name: "broken", Username: "alice"},
+	}
+
+	tests := []struct {
+		policy ConflictPolicy
+		want   ImportReport
+		// Значения записей github по логину и имени после импорта
+		values map[string]string
+	}{
+		{
+			policy: ConflictSkip,
+			want:   ImportReport{Added: []string{"github"}, Skipped: []string{"github"}, Invalid: 1},
+			values: map[string]string{"github/alice": "Old#Pass1", "github/bob": "Bob#Pass1"},
+		},
+		{
+			policy: ConflictOverwrite,
+			want:   ImportReport{Added: []string{"github"}, Overwritten: []string{"github"}, Invalid: 1},
+			values: map[string]string{"github/alice": "New#Pass1", "github/bob": "Bob#Pass1"},
+		},
+		{
+			policy: ConflictRename,
+			want:   ImportReport{Added: []string{"github"}, Renamed: []RenamedRecord{{From: "github", To: "github (2)"}}, Invalid: 1},
+			values: map[string]string{"github/alice": "Old#Pass1", "github (2)/alice": "New#Pass1", "github/bob": "Bob#Pass1"},
+		},
+	}
+
+	for _, tt := range tests {
+		pm := testManager(t)
+		if _, err := pm.ImportPasswords(existing, ConflictSkip, false); err != nil {
+			t.Fatal(err)
+		}
+
+		dry, err := pm.ImportPasswords(records, tt.policy, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pm.ListPasswords()) != 1 {
+			t.Fatalf("policy %d: dry run changed the vault", tt.policy)
+		}
+		report, err := pm.ImportPasswords(records, tt.policy, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := tt.want
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("policy %d: report %+v, want %+v", tt.policy, report, want)
+		}
+		want.DryRun = true
+		if !reflect.DeepEqual(dry, want) {
+			t.Errorf("policy %d: dry run report %+v, want %+v", tt.policy, dry, want)
+		}
+
+		values := map[string]string{}
+		for _, p := range pm.ListPasswords() {
+			values[p.Name+"/"+p.Username] = p.Value
+		}
+		if !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("policy %d: entries %v, want %v", tt.policy, values, tt.values)
+		}
+	}
+}
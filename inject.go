@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// Подстановка секретов в шаблон конфигурации (команда inject). Шаблон - text/template
+// с функциями:
+//
+//	{{ vault "prod-db" }}                    пароль записи
+//	{{ vault "prod-db" "username" }}         поле записи: password, username, url, notes
+//	{{ vault "corp-card" "cvv" }}            поле типа записи
+//	{{ vault "prod-db" | base64 }}           base64, например для data в Secret Kubernetes
+//
+// В строгом режиме ссылка на несуществующую запись - ошибка, иначе она заменяется
+// пустой строкой и попадает в список пропущенных
+type templateRenderer struct {
+	pm      *PasswordManager
+	strict  bool
+	missing []string
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать шаблон с функциями vault и base64
+// 2. Выполнить его, подставляя значения из хранилища
+// 3. Вернуть результат и список ссылок на отсутствующие записи
+
+func renderTemplate(pm *PasswordManager, name, text string, strict bool) ([]byte, []string, error) {
+	r := &templateRenderer{pm: pm, strict: strict}
+
+	// 1
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"vault":  r.vault,
+		"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	}).Parse(text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, nil); err != nil {
+		return nil, nil, err
+	}
+
+	// 3
+	return out.Bytes(), r.missing, nil
+}
+
+// Функция шаблона vault NAME [FIELD]
+func (r *templateRenderer) vault(name string, field ...string) (string, error) {
+	if len(field) > 1 {
+		return "", fmt.Errorf("vault takes an entry name and an optional field")
+	}
+	f := "password"
+	if len(field) == 1 {
+		f = field[0]
+	}
+
+	value, err := lookupSecret(r.pm, name, f)
+	if errors.Is(err, ErrPassNotFound) && !r.strict {
+		r.missing = append(r.missing, name)
+		return "", nil
+	}
+	return value, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func injectManager(t *testing.T) *PasswordManager {
+	t.Helper()
+	pm := testManager(t)
+	for _, p := range []Password{
+		{Name: "prod-db", Username: "app", URL: "postgres://db:5432", Value: "Db#Secret1"},
+		{Name: "corp-card", Kind: KindCard, Value: "4111 1111 1111 1111", Fields: map[string]string{"expiry": "03/29", "cvv": "123"}},
+	} {
+		if err := pm.SaveEntry(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pm
+}
+
+func TestRenderTemplate(t *testing.T) {
+	pm := injectManager(t)
+	const text = `user={{ vault "prod-db" "username" }}
+password={{ vault "prod-db" }}
+url={{ vault "prod-db" "url" }}
+secret={{ vault "prod-db" | base64 }}
+cvv={{ vault "corp-card" "cvv" }}
+card={{ vault "corp-card" "password" }}`
+	const want = `user=app
+password=Db#Secret1
+url=postgres://db:5432
+secret=RGIjU2VjcmV0MQ==
+cvv=123
+card=4111111111111111`
+
+	out, missing, err := renderTemplate(pm, "config", text, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing %q", missing)
+	}
+}
+
+// Без строгого режима отсутствующая запись заменяется пустой строкой и попадает
+// в список пропущенных; неизвестное поле - ошибка в любом режиме
+func TestRenderTemplateErrors(t *testing.T) {
+	pm := injectManager(t)
+
+	out, missing, err := renderTemplate(pm, "config", `a={{ vault "nope" }} b={{ vault "prod-db" "username" }}`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "a= b=app" || !slices.Equal(missing, []string{"nope"}) {
+		t.Errorf("lenient: got %q, missing %q", out, missing)
+	}
+
+	if _, _, err := renderTemplate(pm, "config", `{{ vault "nope" }}`, true); !errors.Is(err, ErrPassNotFound) {
+		t.Errorf("strict missing entry: got %v, want ErrPassNotFound", err)
+	}
+	for _, strict := range []bool{true, false} {
+		_, _, err := renderTemplate(pm, "config", `{{ vault "prod-db" "pin" }}`, strict)
+		if err == nil || !strings.Contains(err.Error(), `unknown field "pin"`) {
+			t.Errorf("strict %v, unknown field: got %v", strict, err)
+		}
+	}
+	if _, _, err := renderTemplate(pm, "config", `{{ vault "prod-db" "username" "url" }}`, false); err == nil {
+		t.Error("vault with two fields: no error")
+	}
+	if _, _, err := renderTemplate(pm, "config", `{{ vault "prod-db" `, false); err == nil {
+		t.Error("unterminated action: no error")
+	}
+}
@@ -0,0 +1,806 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Чтение и запись баз KeePass в формате KDBX 4.
+//
+// Структура файла:
+//
+//	[сигнатуры и версия] [внешний заголовок] [SHA-256 заголовка] [HMAC-SHA-256 заголовка]
+//	[поток блоков с HMAC: зашифрованные (и сжатые) внутренний заголовок + XML]
+//
+// Поддерживаются KDF Argon2d, Argon2id и AES-KDF, внешние шифры AES-256-CBC и ChaCha20,
+// внутренний поток ChaCha20 для защищённых полей. Новые файлы пишутся с Argon2id и AES-256.
+// Вложения записей хранятся во внутреннем заголовке (kdbxInnerBinary), записи ссылаются
+// на них по номеру
+
+const (
+	kdbxSignature1 = 0x9AA2D903
+	kdbxSignature2 = 0xB54BFB67
+	kdbxVersion4   = 0x00040000
+	kdbxMajorMask  = 0xFFFF0000
+)
+
+// Поля внешнего заголовка
+const (
+	kdbxHeaderEnd         = 0
+	kdbxHeaderCipherID    = 2
+	kdbxHeaderCompression = 3
+	kdbxHeaderMasterSeed  = 4
+	kdbxHeaderEncryptIV   = 7
+	kdbxHeaderKdfParams   = 11
+)
+
+// Поля внутреннего заголовка
+const (
+	kdbxInnerEnd       = 0
+	kdbxInnerStreamID  = 1
+	kdbxInnerStreamKey = 2
+	kdbxInnerBinary    = 3
+)
+
+const (
+	kdbxInnerStreamChaCha20 = 3
+	kdbxCompressionGzip     = 1
+	kdbxBlockSize           = 1024 * 1024
+)
+
+// Идентификаторы шифров и KDF
+var (
+	kdbxCipherAES256   = mustHex("31c1f2e6bf714350be5805216afc5aff")
+	kdbxCipherChaCha20 = mustHex("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdbxKdfAES         = mustHex("c9d9f39a628a4460bf740d08c18a4fea")
+	kdbxKdfArgon2d     = mustHex("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdbxKdfArgon2id    = mustHex("9e298b1956db4773b23dfc3ec6f0a1e6")
+)
+
+// Параметры Argon2id для новых файлов (как у KeePassXC по умолчанию)
+const (
+	kdbxArgonIterations = 10
+	kdbxArgonMemory     = 64 * 1024 * 1024
+	kdbxArgonThreads    = 2
+)
+
+// Предельные параметры KDF при чтении: параметры задаёт файл, и без ограничений чужая база
+// может потребовать терабайты памяти или часы вычислений. Пределы с запасом покрывают
+// настройки KeePass и KeePassXC
+const (
+	kdbxMaxArgonMemory     = 1 << 30 // 1 ГиБ
+	kdbxMaxArgonIterations = 100
+	kdbxMaxArgonThreads    = 64
+	kdbxMaxAESRounds       = 100_000_000
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить сигнатуры и версию
+// 2. Прочитать внешний заголовок и проверить его SHA-256
+// 3. Вывести ключи из пароля через KDF и проверить HMAC заголовка
+// 4. Собрать и проверить блоки с HMAC, расшифровать и распаковать данные
+// 5. Прочитать внутренний заголовок (с вложениями) и снять защиту с полей
+// 6. Разобрать XML и преобразовать записи
+
+func readKDBX(r io.Reader, password string) ([]Password, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewReader(data)
+
+	// 1
+	var sig [3]uint32
+	if err := binary.Read(buf, binary.LittleEndian, &sig); err != nil {
+		return nil, fmt.Errorf("not a KDBX file")
+	}
+	if sig[0] != kdbxSignature1 || sig[1] != kdbxSignature2 {
+		return nil, fmt.Errorf("not a KDBX file")
+	}
+	if sig[2]&kdbxMajorMask != kdbxVersion4 {
+		return nil, fmt.Errorf("unsupported KDBX version %d.%d, only KDBX 4 is supported", sig[2]>>16, sig[2]&0xFFFF)
+	}
+
+	// 2
+	fields, err := readKDBXFields(buf)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(data) - buf.Len()
+	header := data[:headerLen]
+
+	var headerHash, headerHMAC [32]byte
+	if _, err := io.ReadFull(buf, headerHash[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(buf, headerHMAC[:]); err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(header); !hmac.Equal(sum[:], headerHash[:]) {
+		return nil, fmt.Errorf("KDBX header is corrupted")
+	}
+
+	// 3
+	kdf, err := parseVariantDict(fields[kdbxHeaderKdfParams])
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := kdbxTransformKey(kdf, kdbxCompositeKey(password))
+	if err != nil {
+		return nil, err
+	}
+	seed := fields[kdbxHeaderMasterSeed]
+	hmacKey := kdbxHMACKey(seed, transformed)
+	if !hmac.Equal(kdbxHeaderHMAC(hmacKey, header), headerHMAC[:]) {
+		return nil, ErrKDBXCredentials
+	}
+
+	// 4
+	encrypted, err := readKDBXBlocks(buf, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	encKey := sha256.Sum256(append(append([]byte{}, seed...), transformed...))
+	plain, err := kdbxDecrypt(fields[kdbxHeaderCipherID], encKey[:], fields[kdbxHeaderEncryptIV], encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if c := fields[kdbxHeaderCompression]; len(c) == 4 && binary.LittleEndian.Uint32(c) == kdbxCompressionGzip {
+		zr, err := gzip.NewReader(bytes.NewReader(plain))
+		if err != nil {
+			return nil, err
+		}
+		if plain, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	// 5
+	inner := bytes.NewReader(plain)
+	innerList, err := readKDBXFieldList(inner)
+	if err != nil {
+		return nil, err
+	}
+	innerFields := kdbxFieldMap(innerList)
+	stream, err := kdbxInnerStream(innerFields)
+	if err != nil {
+		return nil, err
+	}
+	xmlData, err := kdbxTransformProtected(plain[len(plain)-inner.Len():], stream, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 6
+	var file keepassFile
+	if err := xml.Unmarshal(xmlData, &file); err != nil {
+		return nil, err
+	}
+	// Вложения нумеруются в порядке полей; первый байт - флаги KeePass, дальше содержимое
+	for _, f := range innerList {
+		if f.id != kdbxInnerBinary {
+			continue
+		}
+		var data []byte
+		if len(f.value) > 0 {
+			data = f.value[1:]
+		}
+		file.binaries = append(file.binaries, data)
+	}
+
+	return file.passwords(), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сгенерировать соль KDF, зерно и IV, вывести ключи через Argon2id
+// 2. Записать внешний заголовок, его SHA-256 и HMAC
+// 3. Построить XML: категории превращаются в дерево групп, пароли защищаются внутренним потоком,
+//    вложения записываются во внутренний заголовок
+// 4. Сжать и зашифровать внутренний заголовок + XML
+// 5. Записать результат блоками с HMAC
+
+func writeKDBX(w io.Writer, passwords []Password, password string) error {
+	if len(password) < appConfig.MinPasswordLength {
+		return ErrPassWeak
+	}
+
+	// 1
+	seed := randomBytes(32)
+	iv := randomBytes(aes.BlockSize)
+	salt := randomBytes(32)
+	kdf := variantDict{
+		{key: "$UUID", typ: variantBytes, value: kdbxKdfArgon2id},
+		{key: "S", typ: variantBytes, value: salt},
+		{key: "P", typ: variantUint32, value: le32(kdbxArgonThreads)},
+		{key: "M", typ: variantUint64, value: le64(kdbxArgonMemory)},
+		{key: "I", typ: variantUint64, value: le64(kdbxArgonIterations)},
+		{key: "V", typ: variantUint32, value: le32(argon2Version)},
+	}
+	transformed := argon2.IDKey(kdbxCompositeKey(password), salt, kdbxArgonIterations, kdbxArgonMemory/1024, kdbxArgonThreads, 32)
+	hmacKey := kdbxHMACKey(seed, transformed)
+	encKey := sha256.Sum256(append(append([]byte{}, seed...), transformed...))
+
+	// 2
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, [3]uint32{kdbxSignature1, kdbxSignature2, kdbxVersion4})
+	writeKDBXField(&header, kdbxHeaderCipherID, kdbxCipherAES256)
+	writeKDBXField(&header, kdbxHeaderCompression, le32(kdbxCompressionGzip))
+	writeKDBXField(&header, kdbxHeaderMasterSeed, seed)
+	writeKDBXField(&header, kdbxHeaderEncryptIV, iv)
+	writeKDBXField(&header, kdbxHeaderKdfParams, kdf.bytes())
+	writeKDBXField(&header, kdbxHeaderEnd, []byte("\r\n\r\n"))
+
+	headerHash := sha256.Sum256(header.Bytes())
+	out := bytes.NewBuffer(append([]byte{}, header.Bytes()...))
+	out.Write(headerHash[:])
+	out.Write(kdbxHeaderHMAC(hmacKey, header.Bytes()))
+
+	// 3
+	streamKey := randomBytes(64)
+	var payload bytes.Buffer
+	writeKDBXField(&payload, kdbxInnerStreamID, le32(kdbxInnerStreamChaCha20))
+	writeKDBXField(&payload, kdbxInnerStreamKey, streamKey)
+	file := buildKeePassFile(passwords)
+	for _, b := range file.binaries {
+		writeKDBXField(&payload, kdbxInnerBinary, append([]byte{0}, b...))
+	}
+	writeKDBXField(&payload, kdbxInnerEnd, nil)
+
+	xmlData, err := xml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	stream, err := newKDBXChaCha20(streamKey)
+	if err != nil {
+		return err
+	}
+	protected, err := kdbxTransformProtected(append([]byte(xml.Header), xmlData...), stream, true)
+	if err != nil {
+		return err
+	}
+	payload.Write(protected)
+
+	// 4
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(payload.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	encrypted, err := kdbxEncryptAES(encKey[:], iv, compressed.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// 5
+	writeKDBXBlocks(out, hmacKey, encrypted)
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// Дерево групп из категорий записей: "work/aws" -> Root/work/aws
+func buildKeePassFile(passwords []Password) keepassFile {
+	var file keepassFile
+	file.Meta.Generator = "PasswordManager"
+	file.Meta.DatabaseName = "PasswordManager"
+
+	root := &keepassGroup{UUID: kdbxUUID(), Name: "Root"}
+	sorted := append([]Password{}, passwords...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, p := range sorted {
+		g := root
+		for _, part := range strings.Split(p.Category, "/") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			g = g.child(part)
+		}
+		e := keepassEntryFrom(p)
+		for _, a := range p.Attachments {
+			e.Binaries = append(e.Binaries, keepassBinary{Key: a.Name, Value: keepassBinaryRef{Ref: strconv.Itoa(len(file.binaries))}})
+			file.binaries = append(file.binaries, a.Data)
+		}
+		g.Entries = append(g.Entries, e)
+	}
+	file.Root.Groups = []keepassGroup{*root}
+
+	return file
+}
+
+func (g *keepassGroup) child(name string) *keepassGroup {
+	for i := range g.Groups {
+		if g.Groups[i].Name == name {
+			return &g.Groups[i]
+		}
+	}
+	g.Groups = append(g.Groups, keepassGroup{UUID: kdbxUUID(), Name: name})
+	return &g.Groups[len(g.Groups)-1]
+}
+
+func keepassEntryFrom(p Password) keepassEntry {
+	e := keepassEntry{
+		UUID: kdbxEntryUUID(p.ID),
+		Tags: strings.Join(p.Tags, ";"),
+		Times: keepassTimes{
+			CreationTime:         formatKeePassTime(p.CreatedAt),
+			LastModificationTime: formatKeePassTime(p.LastModified),
+		},
+	}
+
+	for _, f := range []struct{ key, value string }{
+		{"Title", p.Name},
+		{"UserName", p.Username},
+		{"Password", p.Value},
+		{"URL", p.URL},
+		{"Notes", p.Notes},
+	} {
+		s := keepassString{Key: f.key, Value: keepassValue{Text: f.value}}
+		if f.key == "Password" {
+			s.Value.Protected = "True"
+		}
+		e.Strings = append(e.Strings, s)
+	}
+
+	return e
+}
+
+func formatKeePassTime(t time.Time) string {
+	return base64.StdEncoding.EncodeToString(le64(uint64(t.Unix() + keepassEpochOffset)))
+}
+
+func kdbxUUID() string {
+	return base64.StdEncoding.EncodeToString(randomBytes(16))
+}
+
+// UUID записи KeePass - ID записи, поэтому после экспорта и импорта запись остаётся той же
+func kdbxEntryUUID(id string) string {
+	if u, ok := uuidBytes(id); ok {
+		return base64.StdEncoding.EncodeToString(u[:])
+	}
+	return kdbxUUID()
+}
+
+type kdbxField struct {
+	id    byte
+	value []byte
+}
+
+// Поля заголовка: [id (1 байт)] [размер (4 байта)] [данные], до поля с id 0.
+// Во внутреннем заголовке поле вложения (kdbxInnerBinary) повторяется
+func readKDBXFieldList(r *bytes.Reader) ([]kdbxField, error) {
+	var fields []kdbxField
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("KDBX header is truncated")
+		}
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("KDBX header is truncated")
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("KDBX header is truncated")
+		}
+		value := make([]byte, size)
+		io.ReadFull(r, value)
+
+		if id == kdbxHeaderEnd {
+			return fields, nil
+		}
+		fields = append(fields, kdbxField{id: id, value: value})
+	}
+}
+
+func readKDBXFields(r *bytes.Reader) (map[byte][]byte, error) {
+	list, err := readKDBXFieldList(r)
+	if err != nil {
+		return nil, err
+	}
+	return kdbxFieldMap(list), nil
+}
+
+// Поля по id; из повторяющихся остаётся последнее
+func kdbxFieldMap(list []kdbxField) map[byte][]byte {
+	fields := make(map[byte][]byte, len(list))
+	for _, f := range list {
+		fields[f.id] = f.value
+	}
+	return fields
+}
+
+func writeKDBXField(w *bytes.Buffer, id byte, value []byte) {
+	w.WriteByte(id)
+	w.Write(le32(uint32(len(value))))
+	w.Write(value)
+}
+
+// Составной ключ из одного пароля: SHA-256(SHA-256(пароль))
+func kdbxCompositeKey(password string) []byte {
+	h := sha256.Sum256([]byte(password))
+	c := sha256.Sum256(h[:])
+	return c[:]
+}
+
+func kdbxTransformKey(kdf map[string][]byte, composite []byte) ([]byte, error) {
+	uuid := kdf["$UUID"]
+	switch {
+	case bytes.Equal(uuid, kdbxKdfArgon2d), bytes.Equal(uuid, kdbxKdfArgon2id):
+		mode := argon2d
+		if bytes.Equal(uuid, kdbxKdfArgon2id) {
+			mode = argon2id
+		}
+		if len(kdf["I"]) != 8 || len(kdf["M"]) != 8 || len(kdf["P"]) != 4 {
+			return nil, fmt.Errorf("invalid Argon2 parameters")
+		}
+		iterations := binary.LittleEndian.Uint64(kdf["I"])
+		memory := binary.LittleEndian.Uint64(kdf["M"]) / 1024
+		threads := binary.LittleEndian.Uint32(kdf["P"])
+		if memory > kdbxMaxArgonMemory/1024 {
+			return nil, fmt.Errorf("Argon2 memory %d MiB exceeds the limit of %d MiB", memory/1024, kdbxMaxArgonMemory>>20)
+		}
+		if iterations > kdbxMaxArgonIterations {
+			return nil, fmt.Errorf("Argon2 iterations %d exceed the limit of %d", iterations, kdbxMaxArgonIterations)
+		}
+		if threads > kdbxMaxArgonThreads {
+			return nil, fmt.Errorf("Argon2 parallelism %d exceeds the limit of %d", threads, kdbxMaxArgonThreads)
+		}
+		return argon2Key(mode, composite, kdf["S"], kdf["K"], kdf["A"], uint32(iterations), uint32(memory), uint8(threads), 32), nil
+
+	case bytes.Equal(uuid, kdbxKdfAES):
+		if len(kdf["R"]) != 8 {
+			return nil, fmt.Errorf("invalid AES-KDF parameters")
+		}
+		rounds := binary.LittleEndian.Uint64(kdf["R"])
+		if rounds > kdbxMaxAESRounds {
+			return nil, fmt.Errorf("AES-KDF rounds %d exceed the limit of %d", rounds, kdbxMaxAESRounds)
+		}
+		block, err := aes.NewCipher(kdf["S"])
+		if err != nil {
+			return nil, err
+		}
+		key := append([]byte{}, composite...)
+		for i := rounds; i > 0; i-- {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		sum := sha256.Sum256(key)
+		return sum[:], nil
+	}
+
+	return nil, fmt.Errorf("unsupported KDBX key derivation function")
+}
+
+func kdbxHMACKey(seed, transformed []byte) []byte {
+	h := sha512.New()
+	h.Write(seed)
+	h.Write(transformed)
+	h.Write([]byte{1})
+	return h.Sum(nil)
+}
+
+// Ключ HMAC для блока с номером index: SHA-512(index || hmacKey)
+func kdbxBlockKey(hmacKey []byte, index uint64) []byte {
+	h := sha512.New()
+	h.Write(le64(index))
+	h.Write(hmacKey)
+	return h.Sum(nil)
+}
+
+// HMAC блока данных: индекс || размер || содержимое
+func kdbxBlockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey, index))
+	mac.Write(le64(index))
+	mac.Write(le32(uint32(len(data))))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// HMAC заголовка считается ключом блока с номером 2^64-1
+func kdbxHeaderHMAC(hmacKey, header []byte) []byte {
+	mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey, math.MaxUint64))
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+func readKDBXBlocks(r *bytes.Reader, hmacKey []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for index := uint64(0); ; index++ {
+		var mac [32]byte
+		var size uint32
+		if _, err := io.ReadFull(r, mac[:]); err != nil {
+			return nil, fmt.Errorf("KDBX data is truncated")
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("KDBX data is truncated")
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("KDBX data is truncated")
+		}
+		block := make([]byte, size)
+		io.ReadFull(r, block)
+
+		if !hmac.Equal(kdbxBlockHMAC(hmacKey, index, block), mac[:]) {
+			return nil, fmt.Errorf("KDBX block %d is corrupted", index)
+		}
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+		out.Write(block)
+	}
+}
+
+func writeKDBXBlocks(w *bytes.Buffer, hmacKey, data []byte) {
+	index := uint64(0)
+	for {
+		n := len(data)
+		if n > kdbxBlockSize {
+			n = kdbxBlockSize
+		}
+		block := data[:n]
+		w.Write(kdbxBlockHMAC(hmacKey, index, block))
+		w.Write(le32(uint32(n)))
+		w.Write(block)
+		data = data[n:]
+		index++
+
+		// Последний блок всегда пустой
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func kdbxDecrypt(cipherID, key, iv, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(cipherID, kdbxCipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aes.BlockSize || len(data)%aes.BlockSize != 0 || len(data) == 0 {
+			return nil, ErrKDBXCredentials
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+		pad := int(out[len(out)-1])
+		if pad == 0 || pad > aes.BlockSize || pad > len(out) {
+			return nil, ErrKDBXCredentials
+		}
+		return out[:len(out)-pad], nil
+
+	case bytes.Equal(cipherID, kdbxCipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("unsupported KDBX cipher")
+}
+
+// AES-256-CBC с дополнением PKCS#7
+func kdbxEncryptAES(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+
+	return out, nil
+}
+
+func kdbxInnerStream(fields map[byte][]byte) (*chacha20.Cipher, error) {
+	id := fields[kdbxInnerStreamID]
+	if len(id) != 4 || binary.LittleEndian.Uint32(id) != kdbxInnerStreamChaCha20 {
+		return nil, fmt.Errorf("unsupported KDBX inner stream, only ChaCha20 is supported")
+	}
+	return newKDBXChaCha20(fields[kdbxInnerStreamKey])
+}
+
+// Ключ и nonce внутреннего потока ChaCha20 берутся из SHA-512 ключа потока
+func newKDBXChaCha20(streamKey []byte) (*chacha20.Cipher, error) {
+	h := sha512.Sum512(streamKey)
+	return chacha20.NewUnauthenticatedCipher(h[:32], h[32:44])
+}
+
+// Алгоритм работы функции:
+//
+// 1. Пройти по XML потоком токенов
+// 2. Для каждого <Value Protected="True"> применить внутренний поток к содержимому
+//    в порядке документа: при чтении base64 -> XOR -> текст, при записи наоборот
+// 3. Остальные токены скопировать без изменений
+
+func kdbxTransformProtected(data []byte, stream *chacha20.Cipher, protect bool) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	enc := xml.NewEncoder(&out)
+
+	inProtected := false
+	for {
+		// 1
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inProtected = false
+			if t.Name.Local == "Value" {
+				for _, a := range t.Attr {
+					if a.Name.Local == "Protected" && strings.EqualFold(a.Value, "True") {
+						inProtected = true
+					}
+				}
+			}
+		case xml.EndElement:
+			inProtected = false
+		case xml.CharData:
+			// 2
+			if inProtected {
+				value := []byte(t)
+				if !protect {
+					decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+					if err != nil {
+						return nil, fmt.Errorf("invalid protected value: %w", err)
+					}
+					value = decoded
+				}
+				stream.XORKeyStream(value, value)
+				if protect {
+					value = []byte(base64.StdEncoding.EncodeToString(value))
+				}
+				tok = xml.CharData(value)
+			}
+		}
+
+		// 3
+		if err := enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// VariantDictionary - формат параметров KDF: [версия (2)] и записи [тип (1)] [длина ключа (4)] [ключ] [длина значения (4)] [значение]
+const (
+	variantDictVersion = 0x0100
+	variantEnd         = 0x00
+	variantUint32      = 0x04
+	variantUint64      = 0x05
+	variantBytes       = 0x42
+)
+
+type variantItem struct {
+	key   string
+	typ   byte
+	value []byte
+}
+
+type variantDict []variantItem
+
+func (d variantDict) bytes() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(variantDictVersion))
+	for _, it := range d {
+		b.WriteByte(it.typ)
+		b.Write(le32(uint32(len(it.key))))
+		b.WriteString(it.key)
+		b.Write(le32(uint32(len(it.value))))
+		b.Write(it.value)
+	}
+	b.WriteByte(variantEnd)
+	return b.Bytes()
+}
+
+func parseVariantDict(data []byte) (map[string][]byte, error) {
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil || version>>8 != variantDictVersion>>8 {
+		return nil, fmt.Errorf("unsupported KDF parameters")
+	}
+
+	res := make(map[string][]byte)
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("KDF parameters are truncated")
+		}
+		if typ == variantEnd {
+			return res, nil
+		}
+
+		var parts [2][]byte
+		for i := range parts {
+			var size uint32
+			if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+				return nil, fmt.Errorf("KDF parameters are truncated")
+			}
+			parts[i] = make([]byte, size)
+			io.ReadFull(r, parts[i])
+		}
+		res[string(parts[0])] = parts[1]
+	}
+}
+
+func le32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+func le64(v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, v)
+}
+
+// crypto/rand.Read не возвращает ошибок начиная с Go 1.24
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// Импорт KDBX подключается к общему механизму импорта, пароль базы передаётся через WithPassphrase
+type kdbxImporter struct {
+	passphrase string
+}
+
+func (kdbxImporter) Name() string        { return "kdbx" }
+func (kdbxImporter) Description() string { return "KeePass/KeePassXC KDBX 4 database" }
+
+func (k kdbxImporter) WithPassphrase(passphrase string) Importer {
+	k.passphrase = passphrase
+	return k
+}
+
+func (k kdbxImporter) Parse(r io.Reader) ([]Password, error) {
+	return readKDBX(r, k.passphrase)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestKDBXRoundTrip(t *testing.T) {
+	want := exportSample()
+	var buf bytes.Buffer
+	if err := writeKDBX(&buf, want, "kdbxpass1"); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	got, err := readKDBX(bytes.NewReader(data), "kdbxpass1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	slices.SortFunc(got, func(a, b Password) int { return strings.Compare(a.Name, b.Name) })
+	for i, p := range got {
+		w := want[i]
+		if p.ID != w.ID || p.Name != w.Name || p.Value != w.Value || p.Username != w.Username || p.URL != w.URL ||
+			p.Notes != w.Notes || p.Category != w.Category || !slices.Equal(p.Tags, w.Tags) ||
+			!p.CreatedAt.Equal(w.CreatedAt) || !p.LastModified.Equal(w.LastModified) {
+			t.Errorf("entry %d:\ngot  %+v\nwant %+v", i, p, w)
+		}
+		if len(p.Attachments) != len(w.Attachments) {
+			t.Fatalf("%s: %d attachments, want %d", p.Name, len(p.Attachments), len(w.Attachments))
+		}
+		for j, a := range p.Attachments {
+			if a.Name != w.Attachments[j].Name || !bytes.Equal(a.Data, w.Attachments[j].Data) {
+				t.Errorf("%s: attachment %q", p.Name, a.Name)
+			}
+		}
+	}
+
+	if _, err := readKDBX(bytes.NewReader(data), "wrongpass1"); !errors.Is(err, ErrKDBXCredentials) {
+		t.Errorf("wrong password: got %v, want ErrKDBXCredentials", err)
+	}
+	data[len(data)-10] ^= 1
+	if _, err := readKDBX(bytes.NewReader(data), "kdbxpass1"); err == nil {
+		t.Error("damaged file accepted")
+	}
+}
+
+// Параметры KDF сверх пределов отклоняются до вычисления ключа
+func TestKDBXKDFLimits(t *testing.T) {
+	argon := func(memory, iterations uint64, threads uint32) map[string][]byte {
+		return map[string][]byte{
+			"$UUID": kdbxKdfArgon2d, "S": make([]byte, 32),
+			"M": le64(memory), "I": le64(iterations), "P": le32(threads),
+		}
+	}
+	for name, kdf := range map[string]map[string][]byte{
+		"memory":      argon(2<<30, 2, 2),
+		"iterations":  argon(64<<20, 1<<40, 2),
+		"parallelism": argon(64<<20, 2, 255),
+		"aes rounds":  {"$UUID": kdbxKdfAES, "S": make([]byte, 32), "R": le64(1 << 62)},
+	} {
+		if _, err := kdbxTransformKey(kdf, make([]byte, 32)); err == nil {
+			t.Errorf("%s: parameters over the limit accepted", name)
+		}
+	}
+	if _, err := kdbxTransformKey(argon(1<<20, 2, 2), make([]byte, 32)); err != nil {
+		t.Errorf("parameters within the limits: %v", err)
+	}
+}
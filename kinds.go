@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Типы записей. Основное значение каждого типа (пароль, текст заметки, номер карты,
+// секрет ключа API, закрытый ключ SSH) лежит в Value, логин и адрес - в Username и URL,
+// остальные поля - в Fields. Записи старых хранилищ не имеют типа и считаются login;
+// новые записи login тоже сохраняются без типа
+const (
+	KindLogin    = "login"
+	KindNote     = "note"
+	KindCard     = "card"
+	KindIdentity = "identity"
+	KindAPIKey   = "api-key"
+	KindSSHKey   = "ssh-key"
+)
+
+// Ключи полей, которые хранятся не в Fields, а в самой записи
+const (
+	fieldValue    = "value"
+	fieldUsername = "username"
+	fieldURL      = "url"
+)
+
+// Поле в схеме типа
+type KindField struct {
+	Key   string
+	Label string
+	// Значение скрывается при вводе
+	Secret   bool
+	Required bool
+	// Ввод нескольких строк до пустой строки
+	Multiline bool
+	// Проверка и приведение значения к общему виду
+	Normalize func(string) (string, error)
+}
+
+type KindSchema struct {
+	Kind  string
+	Title string
+	// Значение можно сгенерировать генератором паролей
+	Generated bool
+	Fields    []KindField
+}
+
+// Схемы в порядке показа в меню
+var entryKinds = []KindSchema{
+	{
+		Kind: KindLogin, Title: "Login", Generated: true,
+		Fields: []KindField{
+			{Key: fieldValue, Label: "Password", Secret: true, Required: true},
+			{Key: fieldUsername, Label: "Username"},
+			{Key: fieldURL, Label: "URL"},
+		},
+	},
+	{
+		Kind: KindNote, Title: "Secure note",
+		Fields: []KindField{
+			{Key: fieldValue, Label: "Note", Required: true, Multiline: true},
+		},
+	},
+	{
+		Kind: KindCard, Title: "Credit card",
+		Fields: []KindField{
+			{Key: "holder", Label: "Cardholder name"},
+			{Key: fieldValue, Label: "Card number", Required: true, Normalize: normalizeCardNumber},
+			{Key: "expiry", Label: "Expiry (MM/YY)", Required: true, Normalize: normalizeCardExpiry},
+			{Key: "cvv", Label: "CVV", Secret: true, Normalize: normalizeCVV},
+		},
+	},
+	{
+		Kind: KindIdentity, Title: "Identity",
+		Fields: []KindField{
+			{Key: "first_name", Label: "First name", Required: true},
+			{Key: "last_name", Label: "Last name"},
+			{Key: "birth_date", Label: "Birth date (YYYY-MM-DD)", Normalize: normalizeDate},
+			{Key: "email", Label: "Email", Normalize: normalizeEmail},
+			{Key: "phone", Label: "Phone"},
+			{Key: "address", Label: "Address"},
+			{Key: fieldValue, Label: "Passport / ID number", Secret: true},
+		},
+	},
+	{
+		Kind: KindAPIKey, Title: "API key",
+		Fields: []KindField{
+			{Key: "key_id", Label: "Key ID"},
+			{Key: fieldValue, Label: "Secret", Secret: true, Required: true},
+			{Key: fieldURL, Label: "Endpoint URL"},
+		},
+	},
+	{
+		Kind: KindSSHKey, Title: "SSH key",
+		Fields: []KindField{
+			{Key: fieldValue, Label: "Private key", Required: true, Multiline: true, Normalize: normalizeSSHKey},
+		},
+	},
+}
+
+// Схема типа; пустой тип - login
+func FindKind(kind string) (KindSchema, error) {
+	if kind == "" {
+		kind = KindLogin
+	}
+	for _, s := range entryKinds {
+		if s.Kind == kind {
+			return s, nil
+		}
+	}
+	return KindSchema{}, fmt.Errorf("%w %q (%s)", ErrKindUnknown, kind, strings.Join(kindNames(), ", "))
+}
+
+func kindNames() []string {
+	names := make([]string, len(entryKinds))
+	for i, s := range entryKinds {
+		names[i] = s.Kind
+	}
+	return names
+}
+
+// Тип записи; у записей старых хранилищ тип не указан
+func (p Password) EntryKind() string {
+	if p.Kind == "" {
+		return KindLogin
+	}
+	return p.Kind
+}
+
+func (p Password) Field(key string) string {
+	switch key {
+	case fieldValue:
+		return p.Value
+	case fieldUsername:
+		return p.Username
+	case fieldURL:
+		return p.URL
+	}
+	return p.Fields[key]
+}
+
+func (p *Password) SetField(key, value string) {
+	switch key {
+	case fieldValue:
+		p.Value = value
+	case fieldUsername:
+		p.Username = value
+	case fieldURL:
+		p.URL = value
+	default:
+		if value == "" {
+			delete(p.Fields, key)
+			return
+		}
+		if p.Fields == nil {
+			p.Fields = make(map[string]string)
+		}
+		p.Fields[key] = value
+	}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Привести каждое поле к общему виду и проверить его. Многострочные значения
+//    (заметки, ключи) сохраняются как есть
+// 2. Проверить, что обязательные поля заполнены
+// 3. Поля, которых нет в схеме, не трогать: их мог добавить импорт или новая версия
+
+func (s KindSchema) Validate(p *Password) error {
+	// Карта полей общая с записью в хранилище - менять можно только копию
+	p.Fields = maps.Clone(p.Fields)
+
+	for _, f := range s.Fields {
+		// 1
+		value := strings.TrimSpace(p.Field(f.Key))
+		if f.Multiline && value != "" {
+			value = p.Field(f.Key)
+		}
+		if value != "" && f.Normalize != nil {
+			normalized, err := f.Normalize(value)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrFieldInvalid, f.Label, err)
+			}
+			value = normalized
+		}
+
+		// 2
+		if f.Required && value == "" {
+			return fmt.Errorf("%w: %s is required", ErrFieldInvalid, f.Label)
+		}
+		p.SetField(f.Key, value)
+	}
+
+	// 3
+	return nil
+}
+
+// Есть ли у записи содержимое: у записи identity основного значения может не быть
+func (p Password) hasContent() bool {
+	return p.Value != "" || len(p.Fields) > 0
+}
+
+// Записи с паролями: к ним относятся проверки надёжности и поиск повторов
+func (p Password) isLogin() bool {
+	return p.EntryKind() == KindLogin
+}
+
+var nonDigits = regexp.MustCompile(`[\s-]`)
+
+// Номер карты без пробелов и дефисов с проверкой контрольной цифры по алгоритму Луна
+func normalizeCardNumber(s string) (string, error) {
+	number := nonDigits.ReplaceAllString(s, "")
+	if len(number) < 12 || len(number) > 19 || strings.Trim(number, "0123456789") != "" {
+		return "", fmt.Errorf("expected 12-19 digits")
+	}
+	if !luhnValid(number) {
+		return "", fmt.Errorf("checksum mismatch")
+	}
+	return number, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Идти по цифрам справа налево
+// 2. Каждую вторую цифру удвоить; если получилось больше 9 - вычесть 9
+// 3. Номер верен, если сумма делится на 10
+
+func luhnValid(number string) bool {
+	sum := 0
+	// 1
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		// 2
+		if (len(number)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	// 3
+	return sum%10 == 0
+}
+
+// Срок действия MM/YY или MM/YYYY приводится к MM/YY
+func normalizeCardExpiry(s string) (string, error) {
+	for _, layout := range []string{"01/06", "1/06", "01/2006", "1/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("01/06"), nil
+		}
+	}
+	return "", fmt.Errorf("expected MM/YY")
+}
+
+func normalizeCVV(s string) (string, error) {
+	if len(s) < 3 || len(s) > 4 || strings.Trim(s, "0123456789") != "" {
+		return "", fmt.Errorf("expected 3 or 4 digits")
+	}
+	return s, nil
+}
+
+func normalizeDate(s string) (string, error) {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return "", fmt.Errorf("expected YYYY-MM-DD")
+	}
+	return t.Format(time.DateOnly), nil
+}
+
+func normalizeEmail(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
+func normalizeSSHKey(s string) (string, error) {
+	if _, err := ssh.ParsePrivateKey([]byte(s)); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// Проверка записи перед сохранением
+func validateEntry(p *Password) error {
+	schema, err := FindKind(p.Kind)
+	if err != nil {
+		return err
+	}
+	if schema.Kind == KindLogin {
+		p.Kind = ""
+	}
+	return schema.Validate(p)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить тип и поля записи по схеме
+// 2. Добавить запись с новым ID; записи с тем же именем и логином быть не должно,
+//    папка приводится к написанию хранилища
+
+func (pm *PasswordManager) SaveEntry(p Password) error {
+	// 1
+	if err := validateEntry(&p); err != nil {
+		return err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// 2
+	if err := pm.passInit(); err != nil {
+		return err
+	}
+	if p.ID == "" {
+		p.ID = newEntryID()
+	}
+	if _, ok := pm.passwords[p.ID]; ok || pm.accountTakenLocked(p.Name, p.Username, "") {
+		return ErrPassExists
+	}
+	now := time.Now()
+	p.CreatedAt, p.LastModified = now, now
+	p.Category = pm.canonicalFolderLocked(p.Category)
+	if err := pm.auditLocked(auditEntry(AuditAdd, p, "")); err != nil {
+		return err
+	}
+	pm.passwords[p.ID] = p
+
+	return nil
+}
+
+func (pm *PasswordManager) GetPasswordsByKind(kind string) []Password {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	res := make([]Password, 0, len(pm.passwords))
+	for _, p := range pm.passwords {
+		if p.EntryKind() == kind {
+			res = append(res, p)
+		}
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestCardValidators(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize func(string) (string, error)
+		in        string
+		want      string
+		wantErr   bool
+	}{
+		{"number with spaces", normalizeCardNumber, "4111 1111 1111 1111", "4111111111111111", false},
+		{"number with dashes", normalizeCardNumber, "5500-0000-0000-0004", "5500000000000004", false},
+		{"number checksum", normalizeCardNumber, "4111 1111 1111 1112", "", true},
+		{"number too short", normalizeCardNumber, "4111 1111", "", true},
+		{"number letters", normalizeCardNumber, "4111 1111 1111 111a", "", true},
+		{"expiry MM/YY", normalizeCardExpiry, "03/29", "03/29", false},
+		{"expiry M/YY", normalizeCardExpiry, "3/29", "03/29", false},
+		{"expiry MM/YYYY", normalizeCardExpiry, "12/2030", "12/30", false},
+		{"expiry month 13", normalizeCardExpiry, "13/29", "", true},
+		{"expiry no slash", normalizeCardExpiry, "0329", "", true},
+		{"cvv 3 digits", normalizeCVV, "123", "123", false},
+		{"cvv 4 digits", normalizeCVV, "1234", "1234", false},
+		{"cvv 2 digits", normalizeCVV, "12", "", true},
+		{"cvv 5 digits", normalizeCVV, "12345", "", true},
+		{"cvv letters", normalizeCVV, "12a", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.normalize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	for number, want := range map[string]bool{
+		"4111111111111111": true,
+		"378282246310005":  true,
+		"79927398713":      true,
+		"79927398710":      false,
+		"4111111111111121": false,
+	} {
+		if got := luhnValid(number); got != want {
+			t.Errorf("luhnValid(%s) = %v, want %v", number, got, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 )
@@ -29,28 +30,43 @@ import (
 // 22. Main()
 
 func main() {
+	// Настройки: файл, переменные окружения PM_* и флаги (--vault, --min-password-length, ...)
+	configFlags := registerConfigFlags(flag.CommandLine)
+	flag.Parse()
 
-	clearScreen()
-	pm := NewPasswordManager("ne_password.dat")
+	config, configPath, err := configFlags.load()
+	if err != nil {
+		showError(fmt.Sprintf("Invalid configuration: %v", err))
+		os.Exit(1)
+	}
+	appConfig = config
 
-	fmt.Println("=== Password Manager Initialization ===")
-	fmt.Print("Enter master password: ")
-	masterPassword, err := readPassword()
+	reg, err := LoadVaultRegistry()
 	if err != nil {
-		showError(fmt.Sprintf("Error reading master password: %v", err))
-		waitForEnter()
-		return
+		showError(fmt.Sprintf("Cannot read vault registry: %v", err))
+		os.Exit(1)
 	}
-	clearScreen()
-	if err := pm.SetMasterPassword(masterPassword); err != nil {
-		showError(fmt.Sprintf("Error setting master password: %v", err))
-		waitForEnter()
+
+	// Подкоманды (vaults, config) выполняются без интерактивного меню
+	if flag.NArg() > 0 {
+		if err := runCommand(reg, configPath, flag.Args()); err != nil {
+			showError(err.Error())
+			os.Exit(1)
+		}
 		return
 	}
 
-	// Пытаемся загрузить существующие данные
-	if err := pm.LoadFromFile(); err != nil && !os.IsNotExist(err) {
-		showError(fmt.Sprintf("Error loading data: %v", err))
+	sess, err := openVaultSession(reg, appConfig.Vault)
+	if err != nil {
+		showError(fmt.Sprintf("Cannot open vault: %v", err))
+		os.Exit(1)
+	}
+	defer func() { sess.Close() }()
+
+	clearScreen()
+	fmt.Println("=== Password Manager Initialization ===")
+	if err := unlockVaultSession(sess); err != nil {
+		showError(fmt.Sprintf("Error opening vault: %v", err))
 		waitForEnter()
 		return
 	}
@@ -59,7 +75,8 @@ func main() {
 	waitForEnter()
 
 	for {
-		ShowMainMenu()
+		pm := sess.PM
+		ShowMainMenu(sess.Name)
 		var err error
 
 		choice, err := ReadUserInput("Enter your choice: ")
@@ -83,6 +100,14 @@ func main() {
 			err = HandlePasswordStats(pm)
 		case "9":
 			err = HandlePasswordDuplicate(pm)
+		case "i":
+			err = HandlePasswordImport(pm)
+		case "e":
+			err = HandlePasswordExport(pm)
+		case "t":
+			err = HandleInteractiveMode(pm)
+		case "v":
+			sess, err = HandleVaultSwitch(reg, sess)
 		case "0":
 			clearScreen()
 			fmt.Println("=== Saving and Exiting ===")
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+// Слияние двух версий хранилища по записям (записи сопоставляются по ID).
+//
+// Если известна общая версия (base), слияние трёхстороннее: изменение только одной
+// стороны принимается автоматически, конфликт - запись изменена или удалена на обеих сторонах по-разному.
+// Без общей версии более новая запись (LastModified) заменяет старую, а конфликтом
+// считаются только разные записи с одинаковым временем изменения.
+//
+// Записи, добавленные на обеих сторонах независимо, имеют разные ID. Такие записи
+// сопоставляются по имени и логину: одинаковые сливаются в одну, разные - конфликт,
+// а не две записи одного аккаунта
+
+// Запись, которую нельзя слить автоматически. nil - запись удалена на этой стороне
+type MergeConflict struct {
+	ID string
+	// Имя записи для вывода
+	Name   string
+	Ours   *Password
+	Theirs *Password
+}
+
+// Изменение нашего хранилища в результате слияния
+type MergeChange struct {
+	Op   string // add, update, remove
+	Name string
+}
+
+type MergeResult struct {
+	// Записи, слитые автоматически. Конфликтные записи остаются в нашей версии
+	Merged map[string]Password
+	// Что пришло из другой версии
+	Changes []MergeChange
+	// Записи, где наша версия новее и осталась без изменений
+	KeptOurs []string
+	// Конфликты для ручного разрешения
+	Conflicts []MergeConflict
+}
+
+// Алгоритм работы функции:
+//
+// 1. Записи, которые есть только у одной стороны и которых нет в общей версии,
+//    сопоставить по имени и логину; запись другой стороны получает наш ID
+//
+// Для каждой записи из объединения версий:
+//
+// 2. Обе стороны одинаковы - оставить
+// 3. Сопоставленные по имени и логину записи различаются - конфликт
+// 4. С общей версией: изменилась только одна сторона - взять её, обе - конфликт
+// 5. Без общей версии: запись есть только у одной стороны - оставить её,
+//    записи различаются - взять более новую, при равном времени изменения - конфликт
+
+func mergeEntries(base, ours, theirs map[string]Password) MergeResult {
+	res := MergeResult{Merged: make(map[string]Password)}
+
+	// 1
+	theirs, matched := matchAccounts(base, ours, theirs)
+
+	// ID -> имя записи для вывода (наша версия, иначе другая, иначе общая)
+	names := map[string]string{}
+	for _, m := range []map[string]Password{base, theirs, ours} {
+		for id, p := range m {
+			names[id] = p.Name
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for id := range names {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if names[sorted[i]] != names[sorted[j]] {
+			return names[sorted[i]] < names[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	for _, id := range sorted {
+		o, inOurs := ours[id]
+		t, inTheirs := theirs[id]
+		name := names[id]
+
+		// 2
+		if sameEntry(o, inOurs, t, inTheirs) {
+			if inOurs {
+				res.Merged[id] = o
+			}
+			continue
+		}
+
+		// 3
+		if matched[id] {
+			res.conflict(id, name, o, inOurs, t, inTheirs)
+			continue
+		}
+
+		// 4
+		if base != nil {
+			b, inBase := base[id]
+			switch {
+			case sameEntry(o, inOurs, b, inBase):
+				res.take(id, name, o, inOurs, t, inTheirs)
+			case sameEntry(t, inTheirs, b, inBase):
+				if inOurs {
+					res.Merged[id] = o
+				}
+			default:
+				res.conflict(id, name, o, inOurs, t, inTheirs)
+			}
+			continue
+		}
+
+		// 5
+		switch {
+		case !inTheirs:
+			res.Merged[id] = o
+		case !inOurs, t.LastModified.After(o.LastModified):
+			res.take(id, name, o, inOurs, t, inTheirs)
+		case o.LastModified.After(t.LastModified):
+			res.Merged[id] = o
+			res.KeptOurs = append(res.KeptOurs, name)
+		default:
+			res.conflict(id, name, o, inOurs, t, inTheirs)
+		}
+	}
+
+	return res
+}
+
+// Алгоритм работы функции:
+//
+// 1. Собрать аккаунты (имя и логин) наших записей, которых нет ни у другой стороны,
+//    ни в общей версии - их добавили у нас
+// 2. Такие же записи другой стороны с совпадающим аккаунтом перенести под наш ID
+// 3. Вернуть копию записей другой стороны и наши ID сопоставленных записей
+
+func matchAccounts(base, ours, theirs map[string]Password) (map[string]Password, map[string]bool) {
+	added := func(id string, other map[string]Password) bool {
+		_, inOther := other[id]
+		_, inBase := base[id]
+		return !inOther && !inBase
+	}
+
+	// 1
+	accounts := map[string]string{}
+	for _, id := range slices.Sorted(maps.Keys(ours)) {
+		p := ours[id]
+		key := accountKey(p.Name, p.Username)
+		if _, ok := accounts[key]; !ok && added(id, theirs) {
+			accounts[key] = id
+		}
+	}
+
+	// 2
+	var res map[string]Password
+	matched := map[string]bool{}
+	for _, id := range slices.Sorted(maps.Keys(theirs)) {
+		t := theirs[id]
+		key := accountKey(t.Name, t.Username)
+		ourID, ok := accounts[key]
+		if !ok || !added(id, ours) {
+			continue
+		}
+		if res == nil {
+			res = maps.Clone(theirs)
+		}
+		delete(accounts, key)
+		delete(res, id)
+		t.ID = ourID
+		res[ourID] = t
+		matched[ourID] = true
+	}
+
+	// 3
+	if res == nil {
+		return theirs, matched
+	}
+	return res, matched
+}
+
+func sameEntry(a Password, inA bool, b Password, inB bool) bool {
+	return inA == inB && (!inA || samePassword(a, b))
+}
+
+// Принять версию другой стороны
+func (r *MergeResult) take(id, name string, o Password, inOurs bool, t Password, inTheirs bool) {
+	switch {
+	case inTheirs && !inOurs:
+		r.Changes = append(r.Changes, MergeChange{Op: "add", Name: name})
+	case inTheirs:
+		r.Changes = append(r.Changes, MergeChange{Op: "update", Name: name})
+	default:
+		r.Changes = append(r.Changes, MergeChange{Op: "remove", Name: name})
+	}
+
+	if inTheirs {
+		r.Merged[id] = t
+	} else {
+		delete(r.Merged, id)
+	}
+}
+
+// Отложить запись до ручного разрешения, пока оставив нашу версию
+func (r *MergeResult) conflict(id, name string, o Password, inOurs bool, t Password, inTheirs bool) {
+	c := MergeConflict{ID: id, Name: name}
+	if inOurs {
+		c.Ours = &o
+		r.Merged[id] = o
+	}
+	if inTheirs {
+		c.Theirs = &t
+	}
+	r.Conflicts = append(r.Conflicts, c)
+}
+
+// Способ разрешения конфликта
+type MergeResolution int
+
+const (
+	ResolveOurs MergeResolution = iota
+	ResolveTheirs
+	// Оставить обе записи: другая версия сохраняется с новым ID под именем "name (2)"
+	ResolveBoth
+	// Взять запись с более поздним LastModified; удаление проигрывает изменению
+	ResolveNewest
+)
+
+// Алгоритм работы функции:
+//
+// 1. Наша версия или удаление - уже в Merged, для удаления убрать запись
+// 2. Другая версия заменяет нашу
+// 3. Обе версии: другая добавляется с новым ID под свободным именем
+
+func (r *MergeResult) Resolve(c MergeConflict, how MergeResolution) {
+	if how == ResolveNewest {
+		how = ResolveOurs
+		if c.Ours == nil || (c.Theirs != nil && c.Theirs.LastModified.After(c.Ours.LastModified)) {
+			how = ResolveTheirs
+		}
+	}
+
+	switch how {
+	// 1
+	case ResolveOurs:
+		if c.Ours == nil {
+			delete(r.Merged, c.ID)
+		}
+
+	// 2
+	case ResolveTheirs:
+		if c.Theirs == nil {
+			delete(r.Merged, c.ID)
+			r.Changes = append(r.Changes, MergeChange{Op: "remove", Name: c.Name})
+		} else {
+			op := "update"
+			if c.Ours == nil {
+				op = "add"
+			}
+			r.Merged[c.ID] = *c.Theirs
+			r.Changes = append(r.Changes, MergeChange{Op: op, Name: c.Name})
+		}
+
+	// 3
+	case ResolveBoth:
+		if c.Ours == nil {
+			delete(r.Merged, c.ID)
+		}
+		if c.Theirs != nil {
+			taken := make(map[string]bool, len(r.Merged))
+			for _, p := range r.Merged {
+				taken[p.Name] = true
+			}
+			p := *c.Theirs
+			if c.Ours != nil {
+				p.ID = newEntryID()
+			}
+			if taken[p.Name] {
+				p.Name = uniqueName(p.Name, func(n string) bool { return taken[n] })
+			}
+			r.Merged[p.ID] = p
+			r.Changes = append(r.Changes, MergeChange{Op: "add", Name: p.Name})
+		}
+	}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что менеджер инициализирован
+// 2. Слить текущие записи с записями другой версии
+
+func (pm *PasswordManager) MergeWith(base, theirs map[string]Password) (MergeResult, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	// 1
+	if err := pm.passInit(); err != nil {
+		return MergeResult{}, err
+	}
+
+	// 2
+	return mergeEntries(base, pm.passwords, theirs), nil
+}
+
+// Изменения, которые результат слияния внесёт в текущие записи. Отчёт MergeResult.Changes
+// описывает только принятое из другой версии, поэтому применять слияние нужно по этой разнице
+func (pm *PasswordManager) MergeDiff(res MergeResult) []entryChange {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return diffEntries(pm.passwords, res.Merged)
+}
+
+// Заменить записи менеджера результатом слияния
+func (pm *PasswordManager) ApplyMerge(res MergeResult) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := pm.passInit(); err != nil {
+		return err
+	}
+
+	if err := pm.auditChangesLocked(pm.passwords, res.Merged, "merge"); err != nil {
+		return err
+	}
+	pm.passwords = copyPasswords(res.Merged)
+	return nil
+}
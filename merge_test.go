@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func mergeEntry(id, value string, modified time.Time) Password {
+	return Password{ID: id, Name: id, Value: value, LastModified: modified}
+}
+
+func TestMergeEntries(t *testing.T) {
+	old, now := time.Unix(1000, 0), time.Unix(2000, 0)
+	base := map[string]Password{
+		"a": mergeEntry("a", "v1", old),
+		"b": mergeEntry("b", "v1", old),
+		"c": mergeEntry("c", "v1", old),
+		"d": mergeEntry("d", "v1", old),
+	}
+	ours := map[string]Password{
+		"a": mergeEntry("a", "v1", old),   // изменилась только другая сторона
+		"b": mergeEntry("b", "ours", now), // изменились обе стороны - конфликт
+		// "c" удалена у нас, у другой стороны не менялась
+		// "d" удалена у нас, у другой стороны изменилась - конфликт
+	}
+	theirs := map[string]Password{
+		"a": mergeEntry("a", "theirs", now),
+		"b": mergeEntry("b", "theirs", now),
+		"c": mergeEntry("c", "v1", old),
+		"d": mergeEntry("d", "theirs", now),
+		"e": mergeEntry("e", "new", now), // добавлена другой стороной
+	}
+
+	res := mergeEntries(base, ours, theirs)
+	if got := slices.Sorted(maps.Keys(res.Merged)); !slices.Equal(got, []string{"a", "b", "e"}) {
+		t.Fatalf("merged %v", got)
+	}
+	if res.Merged["a"].Value != "theirs" || res.Merged["b"].Value != "ours" {
+		t.Fatalf("merged a=%q b=%q", res.Merged["a"].Value, res.Merged["b"].Value)
+	}
+	if len(res.Conflicts) != 2 || res.Conflicts[0].ID != "b" || res.Conflicts[1].ID != "d" || res.Conflicts[1].Ours != nil {
+		t.Fatalf("conflicts %+v", res.Conflicts)
+	}
+	if want := []MergeChange{{Op: "update", Name: "a"}, {Op: "add", Name: "e"}}; !slices.Equal(res.Changes, want) {
+		t.Fatalf("changes %v, want %v", res.Changes, want)
+	}
+}
+
+// Без общей версии побеждает более новая запись, при равном времени - конфликт
+func TestMergeEntriesTwoWay(t *testing.T) {
+	old, now := time.Unix(1000, 0), time.Unix(2000, 0)
+	ours := map[string]Password{
+		"a": mergeEntry("a", "ours", now),
+		"b": mergeEntry("b", "ours", old),
+		"c": mergeEntry("c", "ours", now),
+	}
+	theirs := map[string]Password{
+		"a": mergeEntry("a", "theirs", old),
+		"b": mergeEntry("b", "theirs", now),
+		"c": mergeEntry("c", "theirs", now),
+	}
+
+	res := mergeEntries(nil, ours, theirs)
+	if res.Merged["a"].Value != "ours" || res.Merged["b"].Value != "theirs" {
+		t.Fatalf("merged %+v", res.Merged)
+	}
+	if !slices.Equal(res.KeptOurs, []string{"a"}) || len(res.Conflicts) != 1 || res.Conflicts[0].ID != "c" {
+		t.Fatalf("kept %v, conflicts %+v", res.KeptOurs, res.Conflicts)
+	}
+}
+
+func TestMergeResolve(t *testing.T) {
+	old, now := time.Unix(1000, 0), time.Unix(2000, 0)
+	ours := map[string]Password{"a": mergeEntry("a", "ours", old)}
+	theirs := map[string]Password{"a": mergeEntry("a", "theirs", now)}
+
+	for _, tc := range []struct {
+		how  MergeResolution
+		want []string
+	}{
+		{ResolveOurs, []string{"ours"}},
+		{ResolveTheirs, []string{"theirs"}},
+		{ResolveNewest, []string{"theirs"}},
+		{ResolveBoth, []string{"ours", "theirs"}},
+	} {
+		res := mergeEntries(map[string]Password{"a": mergeEntry("a", "v1", old)}, ours, theirs)
+		res.Resolve(res.Conflicts[0], tc.how)
+
+		var values []string
+		names := map[string]bool{}
+		for _, p := range res.Merged {
+			values = append(values, p.Value)
+			names[p.Name] = true
+		}
+		slices.Sort(values)
+		if !slices.Equal(values, tc.want) || len(names) != len(values) {
+			t.Errorf("resolution %d: merged %+v", tc.how, res.Merged)
+		}
+	}
+}
+
+// Наша версия удалила запись, другая её изменила: "ours" оставляет удаление,
+// "theirs" возвращает запись - слияние применяется по разнице с текущими записями
+func TestMergeDiffOurDeletion(t *testing.T) {
+	pm := NewPasswordManagerWithStore(newMemoryStore())
+	if err := pm.SetMasterPassword("masterpass1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SavePassword("github", "Secret#Pass1", ""); err != nil {
+		t.Fatal(err)
+	}
+	base := copyPasswords(pm.passwords)
+	theirs := copyPasswords(pm.passwords)
+	for id, p := range theirs {
+		p.Value, p.LastModified = "Secret#Pass2", time.Now().Add(time.Hour)
+		theirs[id] = p
+	}
+	if err := pm.DeletePassword("github"); err != nil {
+		t.Fatal(err)
+	}
+
+	for how, want := range map[MergeResolution]int{ResolveOurs: 0, ResolveTheirs: 1, ResolveNewest: 1} {
+		res, err := pm.MergeWith(base, theirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Conflicts) != 1 {
+			t.Fatalf("conflicts %+v", res.Conflicts)
+		}
+		res.Resolve(res.Conflicts[0], how)
+		if diff := pm.MergeDiff(res); len(diff) != want {
+			t.Errorf("resolution %d: diff %v, want %d change(s)", how, diff, want)
+		}
+	}
+}
+
+// Записи одного аккаунта, добавленные в обеих копиях с разными ID, сопоставляются
+// по имени и логину: одинаковые сливаются, разные дают конфликт
+func TestMergeEntriesMatchByAccount(t *testing.T) {
+	now := time.Unix(2000, 0)
+	ours := map[string]Password{
+		"o1": {ID: "o1", Name: "github", Username: "alice", Value: "ours", LastModified: now},
+		"o2": {ID: "o2", Name: "gitlab", Username: "alice", Value: "same", LastModified: now},
+	}
+	theirs := map[string]Password{
+		"t1": {ID: "t1", Name: "github", Username: "Alice", Value: "theirs", LastModified: now.Add(time.Hour)},
+		"t2": {ID: "t2", Name: "gitlab", Username: "alice", Value: "same", LastModified: now},
+		"t3": {ID: "t3", Name: "github", Username: "bob", Value: "other", LastModified: now},
+	}
+
+	for _, base := range []map[string]Password{nil, {}} {
+		res := mergeEntries(base, ours, theirs)
+		if got := slices.Sorted(maps.Keys(res.Merged)); !slices.Equal(got, []string{"o1", "o2", "t3"}) {
+			t.Fatalf("base %v: merged %v", base != nil, got)
+		}
+		if len(res.Conflicts) != 1 {
+			t.Fatalf("base %v: conflicts %+v", base != nil, res.Conflicts)
+		}
+		c := res.Conflicts[0]
+		if c.ID != "o1" || c.Ours == nil || c.Theirs == nil || c.Theirs.Value != "theirs" || c.Theirs.ID != "o1" {
+			t.Fatalf("base %v: conflict %+v", base != nil, c)
+		}
+
+		res.Resolve(c, ResolveTheirs)
+		if p := res.Merged["o1"]; p.Value != "theirs" || p.ID != "o1" {
+			t.Errorf("base %v: resolved to %+v", base != nil, p)
+		}
+	}
+}
+
+// Общая версия открывается ключом любой из копий без запроса пароля
+func TestLoadBaseVaultKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "base.dat")
+	otherKey := bytes.Repeat([]byte{7}, len(testKey))
+	want := map[string]Password{"a": mergeEntry("a", "v1", time.Unix(1000, 0))}
+	if err := newFileStore(path).Save(otherKey, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadBaseVault(path, testKey, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameEntries(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := loadBaseVault(filepath.Join(t.TempDir(), "missing.dat"), testKey); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing base: got %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Хост native messaging для расширения браузера (Chrome, Firefox).
+//
+// Браузер запускает программу и обменивается с ней сообщениями через stdin/stdout:
+// каждое сообщение - 4 байта длины (порядок байтов платформы) и JSON.
+//
+//	{"id": 1, "action": "status"}
+//	{"id": 2, "action": "unlock", "password": "..."}
+//	{"id": 3, "action": "lookup", "url": "https://github.com/login"}
+//	{"id": 4, "action": "save", "url": "...", "username": "...", "password": "..."}
+//	{"id": 5, "action": "lock"}
+//
+// Ответ повторяет id запроса: {"id": 3, "ok": true, "credentials": [...]}, при ошибке -
+// {"id": 3, "ok": false, "code": "vault_closed", "error": "vault is not unlocked"}.
+// Пока хранилище не разблокировано, пароли не выдаются, а файл хранилища не блокируется
+type nativeHost struct {
+	reg  *VaultRegistry
+	sess *vaultSession
+}
+
+type nativeRequest struct {
+	ID       json.RawMessage `json:"id,omitempty"`
+	Action   string          `json:"action"`
+	URL      string          `json:"url,omitempty"`
+	Username string          `json:"username,omitempty"`
+	Password string          `json:"password,omitempty"`
+	// Для save: имя и категория новой записи (по умолчанию - домен и "web")
+	Name     string `json:"name,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+type nativeResponse struct {
+	ID          json.RawMessage    `json:"id,omitempty"`
+	OK          bool               `json:"ok"`
+	Code        string             `json:"code,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Vault       string             `json:"vault,omitempty"`
+	Unlocked    *bool              `json:"unlocked,omitempty"`
+	Credentials []nativeCredential `json:"credentials,omitzero"`
+	// Для save: имя записи и что с ней произошло (added, updated, unchanged)
+	Saved  string `json:"saved,omitempty"`
+	Result string `json:"result,omitempty"`
+}
+
+type nativeCredential struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	URL      string `json:"url"`
+}
+
+const (
+	nativeHostName = "com.passwordmanager.native"
+	// Ограничение Chrome на сообщение от хоста к расширению - 1 МБ
+	nativeMaxMessage      = 1 << 20
+	nativeDefaultCategory = "web"
+)
+
+// Запуск браузером: Chrome передаёт origin расширения, Firefox - путь к манифесту и id расширения
+func isNativeMessagingLaunch(args []string) bool {
+	return strings.HasPrefix(args[0], "chrome-extension://") ||
+		(len(args) == 2 && strings.HasSuffix(args[0], ".json"))
+}
+
+// Алгоритм работы функции:
+//
+// 1. Читать сообщения, пока браузер не закроет stdin
+// 2. Сообщение с неверным JSON получает ответ с ошибкой, обмен продолжается
+// 3. Выполнить действие и отправить ответ с тем же id
+// 4. При завершении закрыть хранилище
+
+func runNativeHost(reg *VaultRegistry, r io.Reader, w io.Writer) error {
+	h := &nativeHost{reg: reg}
+	// 4
+	defer h.lock()
+
+	for {
+		// 1
+		msg, err := readNativeMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// 2
+		var req nativeRequest
+		resp := nativeResponse{}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp = nativeError(fmt.Errorf("%w: %v", ErrBadRequest, err))
+		} else {
+			// 3
+			resp = h.handle(req)
+		}
+		resp.ID = req.ID
+
+		if err := writeNativeMessage(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *nativeHost) handle(req nativeRequest) nativeResponse {
+	var resp nativeResponse
+	var err error
+
+	switch req.Action {
+	case "status":
+		resp = h.status()
+	case "unlock":
+		if err = h.unlock(req.Password); err == nil {
+			resp = h.status()
+		}
+	case "lock":
+		h.lock()
+		resp = h.status()
+	case "lookup":
+		resp.Credentials, err = h.lookup(req.URL)
+	case "save":
+		resp.Saved, resp.Result, err = h.save(req)
+	default:
+		err = fmt.Errorf("%w: unknown action %q", ErrBadRequest, req.Action)
+	}
+
+	if err != nil {
+		return nativeError(err)
+	}
+	resp.OK = true
+	return resp
+}
+
+func (h *nativeHost) status() nativeResponse {
+	unlocked := h.sess != nil
+	resp := nativeResponse{Unlocked: &unlocked}
+	if entry, err := h.reg.Resolve(appConfig.Vault); err == nil {
+		resp.Vault = entry.Name
+	}
+	return resp
+}
+
+// Алгоритм работы функции:
+//
+// 1. Уже разблокированное хранилище не открывать повторно
+// 2. Открыть и заблокировать хранилище; создавать новое из браузера нельзя
+// 3. Загрузить записи с переданным мастер-паролем
+
+func (h *nativeHost) unlock(masterPassword string) error {
+	// 1
+	if h.sess != nil {
+		return nil
+	}
+
+	// 2
+	sess, err := openVaultSession(h.reg, appConfig.Vault)
+	if err != nil {
+		return err
+	}
+	info, err := sess.Store.Stat()
+	if err == nil && !info.Exists {
+		err = fmt.Errorf("%w: %s", ErrVaultNotFound, info.URI)
+	}
+
+	// 3
+	if err == nil {
+		err = sess.Open(masterPassword)
+	}
+	if err != nil {
+		sess.Close()
+		return err
+	}
+
+	h.sess = sess
+	return nil
+}
+
+func (h *nativeHost) lock() {
+	if h.sess != nil {
+		h.sess.Close()
+		h.sess = nil
+	}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Без разблокированного хранилища ничего не выдавать
+// 2. Найти записи login, у которых origin адреса входа совпадает с origin страницы
+// 3. Прочитать найденные записи через GetPassword
+
+func (h *nativeHost) lookup(pageURL string) ([]nativeCredential, error) {
+	// 1
+	if h.sess == nil {
+		return nil, ErrVaultClosed
+	}
+	origin, ok := urlOrigin(pageURL)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid url %q", ErrBadRequest, pageURL)
+	}
+
+	// 2
+	var found []Password
+	for _, p := range h.sess.PM.ListPasswords() {
+		if o, ok := urlOrigin(p.URL); ok && o == origin && p.isLogin() {
+			found = append(found, p)
+		}
+	}
+	sortEntries(found)
+
+	// 3
+	creds := []nativeCredential{}
+	for _, f := range found {
+		p, err := h.sess.PM.GetPassword(f.ID)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, nativeCredential{ID: p.ID, Name: p.Name, Username: p.Username, Password: p.Value, URL: p.URL})
+	}
+	return creds, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что хранилище разблокировано и запрос полный
+// 2. Запись для того же origin и логина есть - обновить пароль, если он изменился
+// 3. Иначе создать запись: имя - домен страницы (или из запроса). Аккаунты с другим логином
+//    получают то же имя; при совпадении имени и логина - "name (2)"
+// 4. Сохранить хранилище; если записать не удалось, откатить изменения в памяти к сохранённой версии
+
+func (h *nativeHost) save(req nativeRequest) (string, string, error) {
+	// 1
+	if h.sess == nil {
+		return "", "", ErrVaultClosed
+	}
+	origin, ok := urlOrigin(req.URL)
+	if !ok || req.Password == "" {
+		return "", "", fmt.Errorf("%w: url and password are required", ErrBadRequest)
+	}
+	pm := h.sess.PM
+
+	// 2
+	id, name, result := "", "", ""
+	taken := make(map[string]bool)
+	for _, p := range pm.ListPasswords() {
+		taken[accountKey(p.Name, p.Username)] = true
+		if o, ok := urlOrigin(p.URL); ok && o == origin && p.Username == req.Username && p.isLogin() {
+			id, name = p.ID, p.Name
+			result = "unchanged"
+			if p.Value != req.Password {
+				result = "updated"
+			}
+		}
+	}
+	if result == "updated" {
+		if err := pm.UpdatePassword(id, req.Password); err != nil {
+			return "", "", err
+		}
+	}
+
+	// 3
+	if name == "" {
+		if err := pm.CheckPasswordStrength(req.Password); err != nil {
+			return "", "", ErrPassWeak
+		}
+		name = req.Name
+		if name == "" {
+			name = nameFromURL(origin)
+		}
+		if taken[accountKey(name, req.Username)] {
+			name = uniqueName(name, func(n string) bool { return taken[accountKey(n, req.Username)] })
+		}
+		category := req.Category
+		if category == "" {
+			category = nativeDefaultCategory
+		}
+		entry := Password{Name: name, Value: req.Password, Category: category, Username: req.Username, URL: req.URL}
+		if err := pm.SaveEntry(entry); err != nil {
+			return "", "", err
+		}
+		result = "added"
+	}
+
+	// 4
+	if result != "unchanged" {
+		if err := pm.SaveToFile(); err != nil {
+			pm.LoadFromFile()
+			return "", "", err
+		}
+	}
+	return name, result, nil
+}
+
+func nativeError(err error) nativeResponse {
+	_, code := errorCode(err)
+	return nativeResponse{Code: code, Error: err.Error()}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Адрес без схемы считается https
+// 2. Схема и хост приводятся к нижнему регистру, порт по умолчанию отбрасывается
+// 3. Вернуть origin вида scheme://host[:port]
+
+func urlOrigin(raw string) (string, bool) {
+	// 1
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+
+	// 2
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		port = ""
+	}
+
+	// 3
+	if port != "" {
+		return scheme + "://" + net.JoinHostPort(host, port), true
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host, true
+}
+
+func readNativeMessage(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.NativeEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > nativeMaxMessage {
+		return nil, fmt.Errorf("native message too large: %d bytes", size)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeNativeMessage(w io.Writer, v any) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(msg) > nativeMaxMessage {
+		return fmt.Errorf("native message too large: %d bytes", len(msg))
+	}
+
+	if err := binary.Write(w, binary.NativeEndian, uint32(len(msg))); err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	return err
+}
+
+// Манифест хоста для регистрации в браузере
+func nativeHostManifest(browser, extensionID string) ([]byte, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := map[string]any{
+		"name":        nativeHostName,
+		"description": "PasswordManager autofill",
+		"path":        exe,
+		"type":        "stdio",
+	}
+	switch browser {
+	case "chrome", "chromium":
+		manifest["allowed_origins"] = []string{"chrome-extension://" + extensionID + "/"}
+	case "firefox":
+		manifest["allowed_extensions"] = []string{extensionID}
+	default:
+		return nil, fmt.Errorf("unknown browser %q (chrome, firefox)", browser)
+	}
+
+	return json.MarshalIndent(manifest, "", "  ")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestNativeMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeNativeMessage(&buf, nativeRequest{Action: "status"}); err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.NativeEndian.Uint32(buf.Bytes()); int(size) != buf.Len()-4 {
+		t.Fatalf("length prefix %d, message %d bytes", size, buf.Len()-4)
+	}
+	msg, err := readNativeMessage(&buf)
+	if err != nil || string(msg) != `{"action":"status"}` {
+		t.Fatalf("got %q, %v", msg, err)
+	}
+	if _, err := readNativeMessage(&buf); !errors.Is(err, io.EOF) {
+		t.Fatalf("empty input: got %v, want EOF", err)
+	}
+
+	// Оборванное сообщение и слишком большая длина
+	binary.Write(&buf, binary.NativeEndian, uint32(10))
+	buf.WriteString("{}")
+	if _, err := readNativeMessage(&buf); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated: got %v", err)
+	}
+	binary.Write(&buf, binary.NativeEndian, uint32(nativeMaxMessage+1))
+	if _, err := readNativeMessage(&buf); err == nil {
+		t.Fatal("oversized message accepted")
+	}
+}
+
+// Драйвер вместо браузера: записывает запросы в stdin хоста и читает ответы из stdout
+func driveNativeHost(t *testing.T, requests ...string) []nativeResponse {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, req := range requests {
+		binary.Write(&in, binary.NativeEndian, uint32(len(req)))
+		in.WriteString(req)
+	}
+	if err := runNativeHost(&VaultRegistry{}, &in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []nativeResponse
+	for out.Len() > 0 {
+		msg, err := readNativeMessage(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp nativeResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != len(requests) {
+		t.Fatalf("%d responses to %d requests", len(responses), len(requests))
+	}
+	return responses
+}
+
+func TestNativeHost(t *testing.T) {
+	testHome(t)
+	path := filepath.Join(t.TempDir(), "main.dat")
+	pm := NewPasswordManagerWithStore(newFileStore(path))
+	if err := pm.SetMasterPassword("masterpass1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SaveEntry(Password{Name: "github", Username: "alice", URL: "https://github.com/login", Value: "Secret#Pass1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer func(vault string) { appConfig.Vault = vault }(appConfig.Vault)
+	appConfig.Vault = path
+
+	resp := driveNativeHost(t,
+		`{"id":1,"action":"lookup","url":"https://github.com/"}`,
+		`{"id":2,"action":"unlock","password":"wrongpass1"}`,
+		`not json`,
+		`{"id":4,"action":"unlock","password":"masterpass1"}`,
+		`{"id":5,"action":"lookup","url":"https://GitHub.com:443/session"}`,
+		`{"id":6,"action":"lookup","url":"https://gitlab.com/"}`,
+		`{"id":7,"action":"save","url":"https://gitlab.com/users/sign_in","username":"alice","password":"Other#Pass2"}`,
+		`{"id":8,"action":"save","url":"https://gitlab.com/","username":"alice","password":"Other#Pass2"}`,
+		`{"id":9,"action":"lock"}`,
+		`{"id":10,"action":"lookup","url":"https://github.com/"}`,
+	)
+
+	if resp[0].OK || resp[0].Code != "vault_closed" || string(resp[0].ID) != "1" {
+		t.Errorf("lookup before unlock: %+v", resp[0])
+	}
+	if resp[1].OK || resp[2].OK || resp[2].Code != "bad_request" {
+		t.Errorf("wrong password / bad json: %+v %+v", resp[1], resp[2])
+	}
+	if !resp[3].OK || resp[3].Unlocked == nil || !*resp[3].Unlocked {
+		t.Errorf("unlock: %+v", resp[3])
+	}
+	if c := resp[4].Credentials; len(c) != 1 || c[0].Username != "alice" || c[0].Password != "Secret#Pass1" {
+		t.Errorf("lookup: %+v", resp[4])
+	}
+	if !resp[5].OK || len(resp[5].Credentials) != 0 {
+		t.Errorf("lookup of another origin: %+v", resp[5])
+	}
+	if resp[6].Result != "added" || resp[6].Saved != "gitlab.com" || resp[7].Result != "unchanged" {
+		t.Errorf("save: %+v %+v", resp[6], resp[7])
+	}
+	if resp[9].OK || resp[9].Code != "vault_closed" {
+		t.Errorf("lookup after lock: %+v", resp[9])
+	}
+}
+
+// Хранилище, запись в которое всегда завершается ошибкой
+type failingStore struct {
+	*memoryStore
+}
+
+func (s failingStore) Save(key []byte, passwords map[string]Password) error {
+	return errors.New("read-only vault")
+}
+
+// Если хранилище не записалось, новая запись не остаётся в памяти
+func TestNativeSaveRollback(t *testing.T) {
+	store := newMemoryStore()
+	store.Save(nil, map[string]Password{})
+	pm := NewPasswordManagerWithStore(failingStore{store})
+	if err := pm.SetMasterPassword("masterpass1"); err != nil {
+		t.Fatal(err)
+	}
+	h := &nativeHost{sess: &vaultSession{PM: pm}}
+
+	if _, _, err := h.save(nativeRequest{URL: "https://gitlab.com", Username: "alice", Password: "Other#Pass2"}); err == nil {
+		t.Fatal("save to a failing store succeeded")
+	}
+	if entries := pm.ListPasswords(); len(entries) != 0 {
+		t.Fatalf("entries left in memory: %+v", entries)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"fmt"
+	"maps"
 	"math/big"
 	"strings"
 	"sync"
@@ -10,12 +11,28 @@ import (
 )
 
 type Password struct {
-	// Название сервиса или сайта
+	// Постоянный идентификатор записи (UUID), ключ записи в хранилище
+	ID string `json:"id"`
+	// Название сервиса или сайта; может повторяться у разных аккаунтов одного сервиса
 	Name string `json:"name"`
-	// Значение пароля
+	// Значение пароля или основное значение записи другого типа (номер карты, закрытый ключ SSH)
 	Value string `json:"value"`
+	// Тип записи (login, note, card, identity, api-key, ssh-key); пусто - login
+	Kind string `json:"kind,omitempty"`
+	// Поля, зависящие от типа записи: срок действия карты, имя владельца и т.п.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Имя пользователя (логин) на сервисе
+	Username string `json:"username,omitempty"`
+	// Адрес страницы входа
+	URL string `json:"url,omitempty"`
+	// Произвольные заметки
+	Notes string `json:"notes,omitempty"`
 	// Категория для группировки("social", "work", "finance")
 	Category string `json:"category"`
+	// Произвольные метки для фильтрации ("2fa", "shared")
+	Tags []string `json:"tags,omitempty"`
+	// Вложенные файлы: коды восстановления, сертификаты, файлы ключей
+	Attachments []Attachment `json:"attachments,omitempty"`
 	// Дата создания записи
 	CreatedAt time.Time `json:"created_at"`
 	// Дата последнего изменения
@@ -25,6 +42,7 @@ type Password struct {
 func NewPassword(name, value, category string) *Password {
 	now := time.Now()
 	return &Password{
+		ID:           newEntryID(),
 		Name:         name,
 		Value:        value,
 		Category:     category,
@@ -34,48 +52,55 @@ func NewPassword(name, value, category string) *Password {
 }
 
 type PasswordManager struct {
-	// Хранилище паролей, где ключ - название сервиса
+	// Хранилище паролей, где ключ - ID записи
 	passwords map[string]Password `json:"passwords"`
 	// Главный ключ шифрования, используется для защиты всех паролей
 	masterKey []byte `json:"-"`
-	// Путь к файлу для хранения зашифрованных данных
-	filePath string `json:"-"`
+	// Хранилище зашифрованных данных (файл, каталог, память)
+	store VaultStore `json:"-"`
 	// Флаг, показывающий установлен ли мастер-пароль
 	isInitialized bool `json:"-"`
+	// Служебные записи из данных хранилища (якоря журналов аудита); в passwords их нет
+	meta map[string]Password
+	// Журнал аудита хранилища; nil - операции не записываются
+	audit *AuditLog
+	// Источник операций для журнала; пусто - auditSource
+	auditSource string
 	// (ОТ себя) добавил mutex
 	mu sync.RWMutex
 }
 
 func NewPasswordManager(filePath string) *PasswordManager {
+	return NewPasswordManagerWithStore(newFileStore(filePath))
+}
+
+func NewPasswordManagerWithStore(store VaultStore) *PasswordManager {
 	return &PasswordManager{
 		passwords:     make(map[string]Password),
 		masterKey:     make([]byte, 0),
-		filePath:      filePath,
+		store:         store,
 		isInitialized: false,
 	}
 }
 
-const (
-	MinPasswordLength = 8
-	MasterKeySize     = 32
-)
+const MasterKeySize = 32
 
 // Алгоритм работы функции:
 //
-//	1.Проверить, что длина пароля не меньше 8 символов
-//	2.Определить набор допустимых символов (буквы, цифры, специальные символы)
+//	1.Проверить, что длина пароля не меньше минимальной из настроек
+//	2.Взять набор допустимых символов из настроек генератора
 //	3.Использовать crypto/rand для генерации случайных байтов
 //	4.Преобразовать случайные байты в символы из допустимого набора
 //	5.Вернуть сгенерированный пароль или ошибку
 
 func (pm *PasswordManager) GeneratePassword(length int) (string, error) {
 	// 1
-	if length < MinPasswordLength {
-		return "", fmt.Errorf("password length must be at least 8, got %d", length)
+	if length < appConfig.MinPasswordLength {
+		return "", fmt.Errorf("password length must be at least %d, got %d", appConfig.MinPasswordLength, length)
 	}
 
 	// 2
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*-_+=."
+	charset := appConfig.Generator.Charset
 
 	// 3
 	pass := make([]byte, length)
@@ -95,9 +120,9 @@ func (pm *PasswordManager) GeneratePassword(length int) (string, error) {
 // Алгоритм работы функции:
 //
 // 1.Проверить, что менеджер паролей инициализирован (isInitialized == true)
-// 2.Убедиться, что пароль с таким именем ещё не существует в хранилище
+// 2.Убедиться, что записи с таким именем без логина ещё нет в хранилище
 // 3.Создать новую запись пароля с помощью функции NewPassword
-// 4.Сохранить пароль в map хранилища
+// 4.Сохранить пароль в map хранилища по ID
 // 5.Вернуть ошибку, если что-то пошло не так
 
 func (pm *PasswordManager) SavePassword(name, value, category string) error {
@@ -111,15 +136,18 @@ func (pm *PasswordManager) SavePassword(name, value, category string) error {
 	}
 
 	// 2
-	if _, ok := pm.passwords[name]; ok {
+	if pm.accountTakenLocked(name, "", "") {
 		return ErrPassExists
 	}
 
 	// 3
-	pass := NewPassword(name, value, category)
+	pass := NewPassword(name, value, pm.canonicalFolderLocked(category))
 
 	// 4
-	pm.passwords[name] = *pass
+	if err := pm.auditLocked(auditEntry(AuditAdd, *pass, "")); err != nil {
+		return err
+	}
+	pm.passwords[pass.ID] = *pass
 
 	// 5
 	return nil
@@ -128,8 +156,9 @@ func (pm *PasswordManager) SavePassword(name, value, category string) error {
 //Алгоритм работы функции:
 //
 //1.Проверить, что менеджер паролей инициализирован
-//2.Найти пароль в хранилище по имени
-//3.Вернуть найденный пароль или ошибку, если пароль не найден
+//2.Найти пароль в хранилище по ID или имени
+//3.Записать чтение в журнал аудита и вернуть пароль или ошибку, если пароль не найден
+//  или имя неоднозначно
 
 func (pm *PasswordManager) GetPassword(name string) (Password, error) {
 	pm.mu.RLock()
@@ -141,11 +170,16 @@ func (pm *PasswordManager) GetPassword(name string) (Password, error) {
 	}
 
 	// 2
-	if _, ok := pm.passwords[name]; ok {
-		return pm.passwords[name], nil
+	id, err := pm.lookupLocked(name)
+	if err != nil {
+		// 3
+		return Password{}, err
 	}
-	// 3
-	return Password{}, ErrPassNotFound
+	p := pm.passwords[id]
+	if err := pm.auditLocked(auditEntry(AuditGet, p, "")); err != nil {
+		return Password{}, err
+	}
+	return p, nil
 }
 
 //Алгоритм работы функции:
@@ -173,10 +207,8 @@ func (pm *PasswordManager) ListPasswords() []Password {
 
 //Алгоритм работы функции:
 //
-//Проверить длину мастер-пароля (минимум 8 символов)
-//Создать байтовый слайс размером 32 байта
-//Скопировать байты мастер-пароля в этот слайс
-//Сохранить полученный слайс в поле masterKey
+//Получить ключ из мастер-пароля
+//Сохранить ключ в поле masterKey
 //Установить флаг isInitialized в true
 
 func (pm *PasswordManager) SetMasterPassword(masterPassword string) error {
@@ -184,35 +216,51 @@ func (pm *PasswordManager) SetMasterPassword(masterPassword string) error {
 	defer pm.mu.Unlock()
 
 	// 1
-	if len(masterPassword) < MinPasswordLength {
-		return ErrPassWeak
+	key, err := masterKeyFromPassword(masterPassword)
+	if err != nil {
+		return err
 	}
 
 	// 2
-	contByte := make([]byte, MasterKeySize)
+	pm.masterKey = key
 
 	// 3
-	copy(contByte, masterPassword)
-
-	// 4
-	pm.masterKey = contByte
-
-	// 5
 	pm.isInitialized = true
 
 	return nil
 }
 
+//Алгоритм работы функции:
+//
+//Проверить длину мастер-пароля (минимум min_password_length символов)
+//Создать байтовый слайс размером 32 байта
+//Скопировать байты мастер-пароля в этот слайс
+
+func masterKeyFromPassword(masterPassword string) ([]byte, error) {
+	// 1
+	if len(masterPassword) < appConfig.MinPasswordLength {
+		return nil, ErrPassWeak
+	}
+
+	// 2
+	contByte := make([]byte, MasterKeySize)
+
+	// 3
+	copy(contByte, masterPassword)
+
+	return contByte, nil
+}
+
 // Алгоритм работы функции:
 //
-// 1. Проверить минимальную длину пароля (не менее 8 символов)
+// 1. Проверить минимальную длину пароля (не менее min_password_length символов)
 // 2. Проверить наличие символов разных категорий:
 // 3. Убедиться, что пароль содержит символы всех категорий
 // 4. Вернуть ошибку, если какое-либо требование не выполнено
 
 func (pm *PasswordManager) CheckPasswordStrength(password string) error {
 	// 1
-	if len(password) < MinPasswordLength {
+	if len(password) < appConfig.MinPasswordLength {
 		return ErrPassWeak
 	}
 
@@ -248,8 +296,8 @@ func (pm *PasswordManager) CheckPasswordStrength(password string) error {
 //
 // 1. Создать карту для хранения дубликатов, где:
 //		ключ - значение пароля
-//		значение - список имён сервисов, использующих этот пароль
-// 2. Перебрать все пары паролей в хранилище
+//		значение - список ID записей, использующих этот пароль (имена записей могут повторяться)
+// 2. Перебрать все пароли в хранилище (записи типа login)
 // 3. Если значения паролей совпадают, добавить их в карту дубликатов
 // 4. Вернуть найденные дубликаты
 
@@ -260,13 +308,16 @@ func (pm *PasswordManager) FindDuplicatePasswords() map[string][]string {
 	// 1
 	// результирующая map
 	res := make(map[string][]string)
-	// для группировки сервисов по паролям
+	// для группировки записей по паролям
 	dblPass := make(map[string][]string)
 
 	// 2
-	for k, v := range pm.passwords {
+	for _, v := range pm.passwords {
+		if !v.isLogin() {
+			continue
+		}
 		// берем значение пароля как ключ и добавляем в промежуточную map
-		dblPass[v.Value] = append(dblPass[v.Value], k)
+		dblPass[v.Value] = append(dblPass[v.Value], v.ID)
 	}
 
 	// 3
@@ -282,54 +333,116 @@ func (pm *PasswordManager) FindDuplicatePasswords() map[string][]string {
 	return res
 }
 
+// Изменение записи по полям: nil (или отсутствие ключа в Fields) - поле не меняется
+type EntryPatch struct {
+	Name     *string
+	Category *string
+	Value    *string
+	Tags     *[]string
+	// Остальные поля по ключам схемы типа (username, url, expiry и т.п.); "" очищает поле
+	Fields map[string]string
+}
+
 // Алгоритм работы функции:
 //
-// 1. Проверить, что менеджер инициализирован
-// 2. Найти пароль в хранилище по имени
-// 3. Проверить надёжность нового пароля через CheckPasswordStrength
-// 4. Обновить значение пароля
-// 5. Обновить время последнего изменения
-// 6. Сохранить обновлённую запись в хранилище
-
-func (pm *PasswordManager) UpdatePassword(name, newValue string) error {
+// 1. Проверить, что менеджер инициализирован, и найти запись по ID или имени
+// 2. Применить изменения к копии записи; имя не может быть пустым,
+//    папка приводится к написанию хранилища
+// 3. Новый пароль записи login проверить через CheckPasswordStrength
+// 4. Проверить поля по схеме типа и что аккаунт с таким именем и логином ещё не занят
+// 5. Если ничего не изменилось - вернуть запись как есть, не трогая время изменения
+// 6. Записать в журнал аудита изменённые поля и сохранить запись с прежними ID
+//    и датой создания и новым временем изменения
+
+func (pm *PasswordManager) EditEntry(ref string, patch EntryPatch) (Password, bool, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
 	// 1
 	if err := pm.passInit(); err != nil {
-		return err
+		return Password{}, false, err
+	}
+	id, err := pm.lookupLocked(ref)
+	if err != nil {
+		return Password{}, false, err
 	}
+	old := pm.passwords[id]
 
 	// 2
-	if _, ok := pm.passwords[name]; !ok {
-		return ErrPassNotFound
+	p := old
+	p.Fields = maps.Clone(old.Fields)
+	if patch.Name != nil {
+		p.Name = strings.TrimSpace(*patch.Name)
+		if p.Name == "" {
+			return Password{}, false, fmt.Errorf("%w: name is required", ErrFieldInvalid)
+		}
+	}
+	if patch.Category != nil {
+		p.Category = pm.canonicalFolderLocked(*patch.Category)
+	}
+	if patch.Tags != nil {
+		p.Tags = *patch.Tags
+	}
+	for key, value := range patch.Fields {
+		p.SetField(key, value)
+	}
+	if patch.Value != nil {
+		p.Value = *patch.Value
 	}
 
 	// 3
-	if err := pm.CheckPasswordStrength(newValue); err != nil {
-		return ErrPassWeak
+	if p.isLogin() && p.Value != old.Value {
+		if err := pm.CheckPasswordStrength(p.Value); err != nil {
+			return Password{}, false, ErrPassWeak
+		}
 	}
 
 	// 4
-	// получаем копию структуры Password
-	p := pm.passwords[name]
-	p.Value = newValue
+	if err := validateEntry(&p); err != nil {
+		return Password{}, false, err
+	}
+	if pm.accountTakenLocked(p.Name, p.Username, id) {
+		return Password{}, false, ErrPassExists
+	}
 
 	// 5
+	if samePassword(old, p) {
+		return old, false, nil
+	}
+
+	// 6
+	if err := pm.auditLocked(auditEntry(AuditUpdate, p, changedFields(old, p))); err != nil {
+		return Password{}, false, err
+	}
 	p.LastModified = time.Now()
+	pm.passwords[id] = p
 
-	// Записываем изменения в структуру Password
-	pm.passwords[name] = p
+	return p, true, nil
+}
 
-	// 6
-	return nil
+// Новое значение пароля записи; пароль записи login проверяется на надёжность
+func (pm *PasswordManager) UpdatePassword(name, newValue string) error {
+	_, _, err := pm.EditEntry(name, EntryPatch{Value: &newValue})
+	return err
+}
+
+// Замена тегов записи
+func (pm *PasswordManager) SetTags(name string, tags []string) error {
+	_, _, err := pm.EditEntry(name, EntryPatch{Tags: &tags})
+	return err
+}
+
+// Замена логина и адреса страницы входа
+func (pm *PasswordManager) SetLogin(name, username, loginURL string) error {
+	_, _, err := pm.EditEntry(name, EntryPatch{Fields: map[string]string{fieldUsername: username, fieldURL: loginURL}})
+	return err
 }
 
 //Алгоритм работы функции:
 //
 //Проверить, что менеджер инициализирован
 //Проверить существование пароля в хранилище
-//Удалить запись из map хранилища
+//Записать удаление в журнал аудита и удалить запись из map хранилища
 //Вернуть ошибку, если что-то пошло не так
 
 func (pm *PasswordManager) DeletePassword(name string) error {
@@ -342,12 +455,16 @@ func (pm *PasswordManager) DeletePassword(name string) error {
 	}
 
 	// 2
-	if _, ok := pm.passwords[name]; !ok {
-		return ErrPassNotFound
+	id, err := pm.lookupLocked(name)
+	if err != nil {
+		return err
 	}
 
 	// 3
-	delete(pm.passwords, name)
+	if err := pm.auditLocked(auditEntry(AuditDelete, pm.passwords[id], "")); err != nil {
+		return err
+	}
+	delete(pm.passwords, id)
 
 	// 4
 	return nil
@@ -376,8 +493,9 @@ func (pm *PasswordManager) GetPasswordStats() map[string]interface{} {
 	// 2
 	countPass := len(pm.passwords)
 
+	spell := pm.folderSpellingsLocked("")
 	for _, v := range pm.passwords {
-		countCat[v.Category]++
+		countCat[spell.canonical(v.Category)]++
 	}
 
 	// 3
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Запись с известным ID и датами в прошлом, чтобы изменения времени были видны
+func editSample(t *testing.T, pm *PasswordManager, p Password) Password {
+	t.Helper()
+	p.ID = newEntryID()
+	if err := pm.SaveEntry(p); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	p = pm.passwords[p.ID]
+	p.CreatedAt, p.LastModified = past, past
+	pm.passwords[p.ID] = p
+	return p
+}
+
+// Переименование в уже занятую пару имя и логин отклоняется, с другим логином - разрешено
+func TestEditEntryRenameConflict(t *testing.T) {
+	pm := testManager(t)
+	editSample(t, pm, Password{Name: "github", Username: "alice", Value: "Secret#Pass1"})
+	work := editSample(t, pm, Password{Name: "github-work", Username: "alice", Value: "Secret#Pass2"})
+	other := editSample(t, pm, Password{Name: "gitlab", Username: "bob", Value: "Secret#Pass3"})
+
+	name := "github"
+	if _, _, err := pm.EditEntry(work.ID, EntryPatch{Name: &name}); !errors.Is(err, ErrPassExists) {
+		t.Errorf("rename onto github/alice: got %v, want ErrPassExists", err)
+	}
+	if got := pm.passwords[work.ID].Name; got != "github-work" {
+		t.Errorf("rejected rename changed the name to %q", got)
+	}
+	if _, _, err := pm.EditEntry(other.ID, EntryPatch{Name: &name}); err != nil {
+		t.Errorf("rename onto github/bob: %v", err)
+	}
+}
+
+// Изменение сохраняет ID и дату создания, пустое изменение не трогает время изменения
+func TestEditEntryTimestamps(t *testing.T) {
+	pm := testManager(t)
+	p := editSample(t, pm, Password{Name: "github", Value: "Secret#Pass1", Tags: []string{"dev"}})
+
+	tags := []string{"dev"}
+	got, changed, err := pm.EditEntry(p.ID, EntryPatch{Tags: &tags, Value: &p.Value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || !got.LastModified.Equal(p.LastModified) || !pm.passwords[p.ID].LastModified.Equal(p.LastModified) {
+		t.Errorf("no-op patch: changed=%v, last modified %v, want %v", changed, got.LastModified, p.LastModified)
+	}
+
+	tags = []string{"dev", "2fa"}
+	got, changed, err = pm.EditEntry(p.ID, EntryPatch{Tags: &tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || got.ID != p.ID || !got.CreatedAt.Equal(p.CreatedAt) {
+		t.Errorf("patch: changed=%v, id %q, created %v, want %q and %v", changed, got.ID, got.CreatedAt, p.ID, p.CreatedAt)
+	}
+	if !got.LastModified.After(p.LastModified) {
+		t.Errorf("patch: last modified %v not after %v", got.LastModified, p.LastModified)
+	}
+}
+
+// Надёжность проверяется только при смене пароля записи login: старый слабый пароль
+// не мешает менять другие поля, а значения других типов не проверяются
+func TestEditEntryStrengthCheck(t *testing.T) {
+	pm := testManager(t)
+	legacy := editSample(t, pm, Password{Name: "legacy", Value: "weak"})
+	note := editSample(t, pm, Password{Name: "wifi", Kind: KindNote, Value: "router in the hall"})
+
+	tags := []string{"old"}
+	if _, _, err := pm.EditEntry(legacy.ID, EntryPatch{Tags: &tags}); err != nil {
+		t.Errorf("tags on weak login: %v", err)
+	}
+	weak := "weaker"
+	if _, _, err := pm.EditEntry(legacy.ID, EntryPatch{Value: &weak}); !errors.Is(err, ErrPassWeak) {
+		t.Errorf("weak login value: got %v, want ErrPassWeak", err)
+	}
+	strong := "Strong#Pass1"
+	if _, _, err := pm.EditEntry(legacy.ID, EntryPatch{Value: &strong}); err != nil {
+		t.Errorf("strong login value: %v", err)
+	}
+	text := "moved to the attic"
+	if _, _, err := pm.EditEntry(note.ID, EntryPatch{Value: &text}); err != nil {
+		t.Errorf("note value: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Запуск программы с секретами в переменных окружения:
+//
+//	PasswordManager run --env DB_PASS=prod-db --env DB_USER=prod-db#username -- ./migrate.sh
+//
+// Ссылка на секрет - имя записи, по умолчанию берётся пароль; суффикс #username,
+// #url, #notes или имя поля типа записи (#cvv, #key_id) выбирает другое поле.
+// Хранилище закрывается до запуска программы, а значения секретов, попавшие
+// в её stdout или stderr, заменяются на secretMask
+const secretMask = "*****"
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Поля записи, доступные по ссылке ENTRY#field
+var secretRefFields = map[string]func(Password) string{
+	"password": func(p Password) string { return p.Value },
+	"username": func(p Password) string { return p.Username },
+	"url":      func(p Password) string { return p.URL },
+	"notes":    func(p Password) string { return p.Notes },
+}
+
+// Алгоритм работы функции:
+//
+// 1. Запись с полным именем ссылки - её пароль (имя записи может содержать "#")
+// 2. Иначе разделить ссылку по последнему "#" на имя записи и поле
+// 3. Вернуть значение поля
+
+func resolveSecretRef(pm *PasswordManager, ref string) (string, error) {
+	// 1
+	p, err := pm.GetPassword(ref)
+	if err == nil {
+		return p.Value, nil
+	}
+
+	// 2
+	i := strings.LastIndex(ref, "#")
+	if i < 0 {
+		return "", fmt.Errorf("%w: %s", err, ref)
+	}
+
+	// 3
+	return lookupSecret(pm, ref[:i], ref[i+1:])
+}
+
+// Значение поля записи: password, username, url, notes или поле типа записи (cvv, key_id...)
+func lookupSecret(pm *PasswordManager, name, field string) (string, error) {
+	p, err := pm.GetPassword(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, name)
+	}
+	if get, ok := secretRefFields[field]; ok {
+		return get(p), nil
+	}
+	if value, ok := p.Fields[field]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown field %q of %q (password, username, url, notes)", field, name)
+}
+
+// Разбор --env VAR=ENTRY
+func parseEnvRef(s string) (string, string, error) {
+	name, ref, ok := strings.Cut(s, "=")
+	if !ok || ref == "" {
+		return "", "", fmt.Errorf("invalid --env %q, expected VAR=ENTRY", s)
+	}
+	if !envNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid environment variable name %q", name)
+	}
+	return name, ref, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Добавить секреты к окружению текущего процесса
+// 2. Вывод программы пропустить через маскирующие писатели
+// 3. Запустить программу и пересылать ей SIGINT, SIGTERM, SIGHUP и SIGQUIT
+// 4. Дождаться завершения и дописать остаток вывода
+// 5. Вернуть код завершения программы (128 + номер сигнала, если её убил сигнал)
+
+func runWithSecrets(command []string, env map[string]string) (int, error) {
+	// 1
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = os.Environ()
+	secrets := make([]string, 0, len(env))
+	for name, value := range env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+		secrets = append(secrets, value)
+	}
+
+	// 2
+	stdout := newMaskWriter(os.Stdout, secrets)
+	stderr := newMaskWriter(os.Stderr, secrets)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// 3
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// 4
+	err := cmd.Wait()
+	stdout.Flush()
+	stderr.Flush()
+
+	// 5
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// Писатель, заменяющий секреты на secretMask. Секрет может прийти по частям в разных
+// вызовах Write, поэтому хвост, с которого может начинаться секрет, придерживается
+// до следующей записи или до Flush
+type maskWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets [][]byte
+	buf     []byte
+}
+
+func newMaskWriter(w io.Writer, secrets []string) *maskWriter {
+	m := &maskWriter{w: w}
+	for _, s := range secrets {
+		if s != "" {
+			m.secrets = append(m.secrets, []byte(s))
+		}
+	}
+	// Длинные секреты проверяются первыми, чтобы секрет, содержащий другой, был скрыт целиком
+	sort.Slice(m.secrets, func(i, j int) bool { return len(m.secrets[i]) > len(m.secrets[j]) })
+	return m
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buf = append(m.buf, p...)
+	if err := m.flushLocked(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Вывести придержанный остаток
+func (m *maskWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.flushLocked(true)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Идти по буферу; в каждой позиции проверять секреты от длинного к короткому
+// 2. Секрет целиком - вывести secretMask вместо него
+// 3. Буфер кончается на начале секрета - остановиться и придержать хвост (кроме Flush):
+//    более длинный секрет может начинаться с более короткого, поэтому короткий
+//    не заменяется, пока не ясно, не продолжится ли длинный
+// 4. Вывести обработанную часть, необработанную оставить в буфере
+
+func (m *maskWriter) flushLocked(final bool) error {
+	var out []byte
+	i := 0
+
+	// 1
+scan:
+	for i < len(m.buf) {
+		rest := m.buf[i:]
+		for _, s := range m.secrets {
+			switch {
+			// 2
+			case bytes.HasPrefix(rest, s):
+				out = append(out, secretMask...)
+				i += len(s)
+				continue scan
+			// 3
+			case !final && bytes.HasPrefix(s, rest):
+				break scan
+			}
+		}
+		out = append(out, m.buf[i])
+		i++
+	}
+
+	// 4
+	m.buf = append(m.buf[:0], m.buf[i:]...)
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := m.w.Write(out)
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Секрет, разрезанный между вызовами Write в любом месте, всё равно скрывается
+func TestMaskWriterSplitWrites(t *testing.T) {
+	secrets := []string{"hunter2", "hunter2-long", "line1\nline2"}
+	input := "token=hunter2 and hunter2-long\nkey:\nline1\nline2\nhunte" + "r2\nend hunter"
+	want := input
+	for _, s := range []string{"hunter2-long", "hunter2", "line1\nline2"} {
+		want = strings.ReplaceAll(want, s, secretMask)
+	}
+
+	for i := 0; i <= len(input); i++ {
+		for j := i; j <= len(input); j++ {
+			var out bytes.Buffer
+			m := newMaskWriter(&out, secrets)
+			for _, part := range []string{input[:i], input[i:j], input[j:]} {
+				if n, err := m.Write([]byte(part)); err != nil || n != len(part) {
+					t.Fatalf("write %q: %d, %v", part, n, err)
+				}
+			}
+			if err := m.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != want {
+				t.Fatalf("split at %d, %d:\ngot  %q\nwant %q", i, j, out.String(), want)
+			}
+		}
+	}
+}
+
+// Придерживается только хвост, с которого может начаться секрет; остальное выводится сразу
+func TestMaskWriterLineBuffering(t *testing.T) {
+	var out bytes.Buffer
+	m := newMaskWriter(&out, []string{"hunter2"})
+	m.Write([]byte("password: hunter2\nnext line hun"))
+	if got := out.String(); got != "password: *****\nnext line " {
+		t.Fatalf("before flush: %q", got)
+	}
+	m.Write([]byte("ter3\n"))
+	m.Flush()
+	if got := out.String(); got != "password: *****\nnext line hunter3\n" {
+		t.Fatalf("after flush: %q", got)
+	}
+}
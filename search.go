@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Режимы поиска записей
+type SearchMode int
+
+const (
+	// Подстрока без учёта регистра
+	SearchSubstring SearchMode = iota
+	// Нечёткий поиск в стиле fzf: символы запроса должны встречаться по порядку
+	SearchFuzzy
+	// Регулярное выражение
+	SearchRegex
+)
+
+// Префиксы запроса для выбора режима (как в fzf: 'text - точное совпадение)
+const (
+	searchExactPrefix = "'"
+	searchRegexPrefix = "/"
+)
+
+type SearchResult struct {
+	// Найденная запись
+	Password Password
+	// Оценка совпадения, чем больше - тем выше в списке
+	Score int
+	// Поле, по которому найдено лучшее совпадение
+	Field string
+}
+
+// Описание поля записи, по которому выполняется поиск.
+// Чтобы искать по новому полю, достаточно добавить его в searchFields
+type searchField struct {
+	name string
+	// Множитель оценки: совпадение по имени важнее совпадения по категории
+	weight int
+	value  func(p Password) string
+}
+
+var searchFields = []searchField{
+	{name: "name", weight: 2, value: func(p Password) string { return p.Name }},
+	{name: "category", weight: 1, value: func(p Password) string { return p.Category }},
+	{name: "tags", weight: 1, value: func(p Password) string { return strings.Join(p.Tags, " ") }},
+	{name: "kind", weight: 1, value: func(p Password) string { return p.EntryKind() }},
+	{name: "attachments", weight: 1, value: func(p Password) string { return attachmentNames(p) }},
+}
+
+// Сопоставитель строки с запросом. Возвращает оценку и признак совпадения
+type matcher interface {
+	match(text string) (int, bool)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Определить режим по префиксу запроса (' - подстрока, / - регулярное выражение)
+// 2. Без префикса использовать нечёткий поиск
+// 3. Вернуть режим и запрос без префикса
+
+func ParseSearchQuery(query string) (SearchMode, string) {
+	// 1
+	switch {
+	case strings.HasPrefix(query, searchExactPrefix):
+		return SearchSubstring, strings.TrimPrefix(query, searchExactPrefix)
+	case strings.HasPrefix(query, searchRegexPrefix):
+		return SearchRegex, strings.TrimPrefix(query, searchRegexPrefix)
+	}
+
+	// 2, 3
+	return SearchFuzzy, query
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что менеджер инициализирован
+// 2. Построить сопоставитель для выбранного режима
+// 3. Проверить каждое поле каждой записи и взять лучшую оценку; отрицательные оценки
+//    считаются нулевыми, чтобы вес поля поднимал оценку, а не опускал её
+// 4. Отсортировать результаты по убыванию оценки, при равенстве - по имени
+
+func (pm *PasswordManager) Search(query string, mode SearchMode) ([]SearchResult, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	// 1
+	if err := pm.passInit(); err != nil {
+		return nil, err
+	}
+
+	// 2
+	m, err := newMatcher(query, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3
+	res := make([]SearchResult, 0)
+	for _, p := range pm.passwords {
+		best := SearchResult{Password: p}
+		found := false
+		for _, f := range searchFields {
+			score, ok := m.match(f.value(p))
+			if !ok {
+				continue
+			}
+			// Совпадение далеко от начала длинного поля или с большими пропусками может
+			// дать отрицательную оценку; множитель поля не должен опускать её ещё ниже
+			score = max(score, 0) * f.weight
+			if !found || score > best.Score {
+				best.Score = score
+				best.Field = f.name
+				found = true
+			}
+		}
+		if found {
+			res = append(res, best)
+		}
+	}
+
+	// 4
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Password.Name < res[j].Password.Name
+	})
+
+	return res, nil
+}
+
+func newMatcher(query string, mode SearchMode) (matcher, error) {
+	switch mode {
+	case SearchSubstring:
+		return substringMatcher{query: strings.ToLower(query)}, nil
+	case SearchFuzzy:
+		return fuzzyMatcher{query: []rune(strings.ToLower(query))}, nil
+	case SearchRegex:
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return regexMatcher{re: re}, nil
+	}
+
+	return nil, fmt.Errorf("unknown search mode: %d", mode)
+}
+
+type substringMatcher struct {
+	query string
+}
+
+// Совпадение в начале строки и полное совпадение ценятся выше
+func (m substringMatcher) match(text string) (int, bool) {
+	lower := strings.ToLower(text)
+	idx := strings.Index(lower, m.query)
+	if idx < 0 {
+		return 0, false
+	}
+
+	score := 100 - idx
+	if idx == 0 {
+		score += 50
+	}
+	if len(lower) == len(m.query) {
+		score += 100
+	}
+
+	return score, true
+}
+
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexMatcher) match(text string) (int, bool) {
+	loc := m.re.FindStringIndex(text)
+	if loc == nil {
+		return 0, false
+	}
+
+	// Чем раньше и длиннее совпадение, тем выше оценка
+	return 100 - loc[0] + (loc[1] - loc[0]), true
+}
+
+type fuzzyMatcher struct {
+	query []rune
+}
+
+// Оценки нечёткого поиска в духе fzf
+const (
+	fuzzyScoreMatch       = 16
+	fuzzyBonusConsecutive = 8
+	fuzzyBonusBoundary    = 10
+	fuzzyBonusFirstChar   = 12
+	fuzzyPenaltyGap       = 1
+)
+
+// Алгоритм работы функции:
+//
+// 1. Пройти по тексту, сопоставляя символы запроса по порядку
+// 2. За каждый совпавший символ начислить очки
+// 3. Добавить бонусы за подряд идущие символы и начало слова
+// 4. Вычесть штраф за пропущенные символы между совпадениями
+// 5. Если не все символы запроса найдены - совпадения нет
+
+func (m fuzzyMatcher) match(text string) (int, bool) {
+	if len(m.query) == 0 {
+		return 0, true
+	}
+
+	runes := []rune(strings.ToLower(text))
+	score := 0
+	qi := 0
+	lastMatch := -1
+
+	// 1
+	for i, r := range runes {
+		if qi == len(m.query) {
+			break
+		}
+		if r != m.query[qi] {
+			continue
+		}
+
+		// 2
+		score += fuzzyScoreMatch
+
+		// 3
+		switch {
+		case i == 0:
+			score += fuzzyBonusFirstChar
+		case isWordBoundary(runes[i-1]):
+			score += fuzzyBonusBoundary
+		}
+		if lastMatch >= 0 && i == lastMatch+1 {
+			score += fuzzyBonusConsecutive
+		}
+
+		// 4
+		if lastMatch >= 0 {
+			score -= (i - lastMatch - 1) * fuzzyPenaltyGap
+		}
+
+		lastMatch = i
+		qi++
+	}
+
+	// 5
+	if qi < len(m.query) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+func isWordBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
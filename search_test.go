@@ -0,0 +1,93 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		mode  SearchMode
+		want  string
+	}{
+		{"gthb", SearchFuzzy, "gthb"},
+		{"'github", SearchSubstring, "github"},
+		{"/^git(hub|lab)$", SearchRegex, "^git(hub|lab)$"},
+		{"", SearchFuzzy, ""},
+		{"a'b", SearchFuzzy, "a'b"},
+	}
+	for _, tt := range tests {
+		mode, query := ParseSearchQuery(tt.query)
+		if mode != tt.mode || query != tt.want {
+			t.Errorf("ParseSearchQuery(%q) = %d, %q; want %d, %q", tt.query, mode, query, tt.mode, tt.want)
+		}
+	}
+}
+
+func searchNames(t *testing.T, pm *PasswordManager, query string) []string {
+	t.Helper()
+	mode, query := ParseSearchQuery(query)
+	res, err := pm.Search(query, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(res))
+	for i, r := range res {
+		names[i] = r.Password.Name
+	}
+	return names
+}
+
+// Полное совпадение имени выше совпадения в начале, то - выше совпадения в середине;
+// совпадение по имени весит больше совпадения по папке
+func TestSearchRanking(t *testing.T) {
+	pm := testManager(t)
+	for name, category := range map[string]string{
+		"my github":   "personal",
+		"github-work": "work",
+		"bank":        "github",
+		"github":      "dev",
+		"gitlab":      "dev",
+	} {
+		if err := pm.SavePassword(name, "Secret#Pass1", category); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"github", "github-work", "bank", "my github"}
+	if got := searchNames(t, pm, "'github"); !slices.Equal(got, want) {
+		t.Errorf("substring: got %q, want %q", got, want)
+	}
+	if got := searchNames(t, pm, "/^git(hub|lab)$"); !slices.Equal(got, []string{"github", "gitlab", "bank"}) {
+		t.Errorf("regex: got %q", got)
+	}
+	if got := searchNames(t, pm, "gthb"); len(got) == 0 || got[0] != "github" {
+		t.Errorf("fuzzy: got %q, want github first", got)
+	}
+}
+
+// Отрицательная оценка далёкого совпадения не опускается весом поля ниже нуля
+func TestSearchScoreNotNegative(t *testing.T) {
+	pm := testManager(t)
+	long := "a" + strings.Repeat("x", 300) + "b"
+	if err := pm.SavePassword(long, "Secret#Pass1", "misc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SavePassword("prefix"+strings.Repeat("y", 300)+"ab", "Secret#Pass1", "misc"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []SearchMode{SearchFuzzy, SearchSubstring, SearchRegex} {
+		res, err := pm.Search("ab", mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range res {
+			if r.Score < 0 {
+				t.Errorf("mode %d: %.10s... scored %d", mode, r.Password.Name, r.Score)
+			}
+		}
+	}
+}
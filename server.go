@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// REST API для локальных инструментов (команда serve). Все ответы - JSON,
+// запросы авторизуются заголовком "Authorization: Bearer pmt_...".
+//
+//	GET    /v1/entries[?category=C]  список записей без паролей
+//	POST   /v1/entries               новая запись {name, value, category, tags, username, url}; пустой value - сгенерировать
+//	GET    /v1/entries/{ref}         запись вместе с паролем; ref - ID или имя записи
+//	PUT    /v1/entries/{ref}         новый пароль и/или теги {value, tags}
+//	DELETE /v1/entries/{ref}
+//	GET    /v1/search?q=QUERY        поиск (fuzzy, 'подстрока, /regex)
+//	POST   /v1/generate              {length} -> {password}
+//	GET    /v1/audit                 статистика, слабые и повторяющиеся пароли
+type apiServer struct {
+	pm     *PasswordManager
+	tokens *TokenStore
+	// Изменения и сохранение хранилища выполняются по одному
+	writeMu sync.Mutex
+
+	logMu     sync.Mutex
+	accessLog io.Writer
+}
+
+// Ответ с ошибкой: {"error": {"code": "not_found", "message": "password not found"}}
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Соответствие ошибок из errors.go кодам HTTP. Неизвестные ошибки - 500
+var apiErrorStatus = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{ErrForbidden, http.StatusForbidden, "forbidden"},
+	{ErrBadRequest, http.StatusBadRequest, "bad_request"},
+	{ErrPassNotFound, http.StatusNotFound, "not_found"},
+	{ErrPassExists, http.StatusConflict, "already_exists"},
+	{ErrEntryAmbiguous, http.StatusConflict, "ambiguous"},
+	{ErrPassWeak, http.StatusUnprocessableEntity, "weak_password"},
+	{ErrFieldInvalid, http.StatusUnprocessableEntity, "invalid_field"},
+	{ErrVaultReadOnly, http.StatusForbidden, "read_only"},
+	{ErrVaultLocked, http.StatusLocked, "vault_locked"},
+	{ErrVaultClosed, http.StatusServiceUnavailable, "vault_closed"},
+	{ErrMasterPassword, http.StatusUnauthorized, "wrong_password"},
+	{ErrVaultNotFound, http.StatusNotFound, "vault_not_found"},
+	{ErrPassManagerNotInit, http.StatusServiceUnavailable, "not_initialized"},
+}
+
+// Запись в ответах API. В списках и поиске пароль не передаётся
+type apiEntry struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Value        string            `json:"value,omitempty"`
+	Kind         string            `json:"kind"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Notes        string            `json:"notes,omitempty"`
+	Category     string            `json:"category"`
+	Tags         []string          `json:"tags,omitempty"`
+	Attachments  []string          `json:"attachments,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	LastModified time.Time         `json:"last_modified"`
+}
+
+type apiTokenKey struct{}
+
+func newAPIServer(pm *PasswordManager, tokens *TokenStore, accessLog io.Writer) *apiServer {
+	return &apiServer{pm: pm, tokens: tokens, accessLog: accessLog}
+}
+
+func (s *apiServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/entries", s.handleList)
+	mux.HandleFunc("POST /v1/entries", s.write(s.handleCreate))
+	mux.HandleFunc("GET /v1/entries/{ref}", s.handleGet)
+	mux.HandleFunc("PUT /v1/entries/{ref}", s.write(s.handleUpdate))
+	mux.HandleFunc("DELETE /v1/entries/{ref}", s.write(s.handleDelete))
+	mux.HandleFunc("GET /v1/search", s.handleSearch)
+	mux.HandleFunc("POST /v1/generate", s.handleGenerate)
+	mux.HandleFunc("GET /v1/audit", s.handleAudit)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, fmt.Errorf("%w: no such endpoint %s %s", ErrBadRequest, r.Method, r.URL.Path))
+	})
+
+	return s.logRequests(s.authenticate(mux))
+}
+
+// Алгоритм работы функции:
+//
+// 1. Взять токен из заголовка Authorization: Bearer
+// 2. Найти его среди выданных токенов
+// 3. Передать токен обработчику через контекст запроса
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 1
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		// 2
+		token, found := s.tokens.Authenticate(strings.TrimSpace(secret))
+		if !ok || !found {
+			writeAPIError(w, ErrUnauthorized)
+			return
+		}
+
+		// 3
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.token = token.Name
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenKey{}, token)))
+	})
+}
+
+// Изменяющие запросы: только для токенов с правом записи, по одному, с сохранением хранилища
+func (s *apiServer) write(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r).ReadOnly {
+			writeAPIError(w, ErrForbidden)
+			return
+		}
+
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+
+		// Изменения выполняются по одному, поэтому источник для журнала аудита
+		// можно задать на весь запрос
+		s.pm.SetAuditSource(auditTokenSource(r))
+		defer s.pm.SetAuditSource("")
+
+		if err := handler(w, r); err != nil {
+			writeAPIError(w, err)
+		}
+	}
+}
+
+// Если хранилище не удалось записать (например, командное хранилище только для чтения),
+// изменения в памяти откатываются к сохранённой версии
+func (s *apiServer) save() error {
+	if err := s.pm.SaveToFile(); err != nil {
+		s.pm.LoadFromFile()
+		return err
+	}
+	return nil
+}
+
+// Источник операций запроса в журнале аудита: api:<имя токена>
+func auditTokenSource(r *http.Request) string {
+	return "api:" + requestToken(r).Name
+}
+
+func requestToken(r *http.Request) APIToken {
+	token, _ := r.Context().Value(apiTokenKey{}).(APIToken)
+	return token
+}
+
+func (s *apiServer) handleList(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	category := r.URL.Query().Get("category")
+	kind := r.URL.Query().Get("kind")
+
+	entries := []apiEntry{}
+	for _, p := range s.pm.ListPasswords() {
+		if token.allows(p.Category) && (category == "" || inFolder(p.Category, category)) && (kind == "" || p.EntryKind() == kind) {
+			entries = append(entries, newAPIEntry(p, false))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Username < entries[j].Username
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+func (s *apiServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	p, err := s.visibleEntry(r)
+	if err == nil {
+		err = s.pm.RecordAudit(AuditEvent{Op: AuditGet, EntryID: p.ID, Entry: p.Name, Source: auditTokenSource(r)})
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIEntry(p, true))
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать запрос и проверить доступ к категории
+// 2. Пустой пароль - сгенерировать, иначе проверить надёжность
+// 3. Добавить запись и сохранить хранилище
+
+func (s *apiServer) handleCreate(w http.ResponseWriter, r *http.Request) error {
+	// 1
+	var req struct {
+		Name     string   `json:"name"`
+		Value    string   `json:"value"`
+		Category string   `json:"category"`
+		Tags     []string `json:"tags"`
+		Username string   `json:"username"`
+		URL      string   `json:"url"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Name == "" || req.Category == "" {
+		return fmt.Errorf("%w: name and category are required", ErrBadRequest)
+	}
+	if !requestToken(r).allows(req.Category) {
+		return ErrForbidden
+	}
+
+	// 2
+	if req.Value == "" {
+		value, err := s.pm.GeneratePassword(appConfig.Generator.Length)
+		if err != nil {
+			return err
+		}
+		req.Value = value
+	} else if err := s.pm.CheckPasswordStrength(req.Value); err != nil {
+		return ErrPassWeak
+	}
+
+	// 3
+	entry := Password{ID: newEntryID(), Name: req.Name, Value: req.Value, Category: req.Category, Tags: req.Tags, Username: req.Username, URL: req.URL}
+	if err := s.pm.SaveEntry(entry); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	// Ответ без GetPassword: созданная запись - не чтение для журнала аудита
+	created := s.pm.FindEntries(entry.ID)
+	if len(created) != 1 {
+		return ErrPassNotFound
+	}
+	writeJSON(w, http.StatusCreated, newAPIEntry(created[0], true))
+	return nil
+}
+
+func (s *apiServer) handleUpdate(w http.ResponseWriter, r *http.Request) error {
+	entry, err := s.visibleEntry(r)
+	if err != nil {
+		return err
+	}
+	id := entry.ID
+
+	var req struct {
+		Name     *string   `json:"name"`
+		Category *string   `json:"category"`
+		Value    string    `json:"value"`
+		Tags     *[]string `json:"tags"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Name == nil && req.Category == nil && req.Value == "" && req.Tags == nil {
+		return fmt.Errorf("%w: nothing to update, set name, category, value or tags", ErrBadRequest)
+	}
+	// Переносить запись можно только в категории, доступные токену
+	if req.Category != nil && !requestToken(r).allows(*req.Category) {
+		return ErrForbidden
+	}
+
+	patch := EntryPatch{Name: req.Name, Category: req.Category, Tags: req.Tags}
+	if req.Value != "" {
+		patch.Value = &req.Value
+	}
+	p, changed, err := s.pm.EditEntry(id, patch)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	writeJSON(w, http.StatusOK, newAPIEntry(p, true))
+	return nil
+}
+
+func (s *apiServer) handleDelete(w http.ResponseWriter, r *http.Request) error {
+	entry, err := s.visibleEntry(r)
+	if err != nil {
+		return err
+	}
+	if err := s.pm.DeletePassword(entry.ID); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *apiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeAPIError(w, fmt.Errorf("%w: query parameter q is required", ErrBadRequest))
+		return
+	}
+
+	mode, q := ParseSearchQuery(query)
+	results, err := s.pm.Search(q, mode)
+	if err != nil {
+		writeAPIError(w, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+
+	type apiResult struct {
+		apiEntry
+		Score int    `json:"score"`
+		Field string `json:"field"`
+	}
+	token := requestToken(r)
+	found := []apiResult{}
+	for _, res := range results {
+		if token.allows(res.Password.Category) {
+			found = append(found, apiResult{newAPIEntry(res.Password, false), res.Score, res.Field})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"results": found})
+}
+
+func (s *apiServer) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Length int `json:"length"`
+	}{Length: appConfig.Generator.Length}
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	password, err := s.pm.GeneratePassword(req.Length)
+	if err != nil {
+		writeAPIError(w, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"password": password})
+}
+
+// Алгоритм работы функции:
+//
+// 1. Оставить только записи, доступные токену
+// 2. Посчитать записи по категориям и найти слабые пароли среди записей login
+// 3. Найти повторяющиеся пароли (в ответе только имена записей, видимость проверяется по ID)
+
+func (s *apiServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	// 1
+	token := requestToken(r)
+	visible := make(map[string]Password)
+	categories := make(map[string]int)
+	weak := []string{}
+
+	// 2
+	for _, p := range s.pm.ListPasswords() {
+		if !token.allows(p.Category) {
+			continue
+		}
+		visible[p.ID] = p
+		categories[s.pm.CanonicalFolder(p.Category)]++
+		if p.isLogin() && s.pm.CheckPasswordStrength(p.Value) != nil {
+			weak = append(weak, p.Name)
+		}
+	}
+	sort.Strings(weak)
+
+	// 3
+	duplicates := [][]string{}
+	for _, ids := range s.pm.FindDuplicatePasswords() {
+		var group []string
+		for _, id := range ids {
+			if p, ok := visible[id]; ok {
+				group = append(group, p.Name)
+			}
+		}
+		if len(group) > 1 {
+			sort.Strings(group)
+			duplicates = append(duplicates, group)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i][0] < duplicates[j][0] })
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"total":      len(visible),
+		"categories": categories,
+		"weak":       weak,
+		"duplicates": duplicates,
+	})
+}
+
+// Запись из пути запроса по ID или имени. Записи чужих категорий для токена не существуют:
+// они не делают имя неоднозначным и не попадают в список вариантов
+func (s *apiServer) visibleEntry(r *http.Request) (Password, error) {
+	ref := r.PathValue("ref")
+	var visible []Password
+	for _, p := range s.pm.FindEntries(ref) {
+		if requestToken(r).allows(p.Category) {
+			visible = append(visible, p)
+		}
+	}
+	switch len(visible) {
+	case 0:
+		return Password{}, ErrPassNotFound
+	case 1:
+		return visible[0], nil
+	}
+	return Password{}, ambiguousEntry(ref, visible)
+}
+
+func newAPIEntry(p Password, withValue bool) apiEntry {
+	e := apiEntry{
+		ID:           p.ID,
+		Name:         p.Name,
+		Kind:         p.EntryKind(),
+		Username:     p.Username,
+		URL:          p.URL,
+		Notes:        p.Notes,
+		Category:     p.Category,
+		Tags:         p.Tags,
+		CreatedAt:    p.CreatedAt,
+		LastModified: p.LastModified,
+	}
+	// Содержимое вложений через API не отдаётся, только имена
+	for _, a := range p.Attachments {
+		e.Attachments = append(e.Attachments, a.Name)
+	}
+	if withValue {
+		e.Value = p.Value
+		e.Fields = p.Fields
+	}
+	return e
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status, code := errorCode(err)
+	writeJSON(w, status, apiErrorBody{Error: apiError{Code: code, Message: err.Error()}})
+}
+
+// Код HTTP и машиночитаемый код ошибки для ответов API и native messaging
+func errorCode(err error) (int, string) {
+	for _, e := range apiErrorStatus {
+		if errors.Is(err, e.err) {
+			return e.status, e.code
+		}
+	}
+	return http.StatusInternalServerError, "internal"
+}
+
+// Запоминает код ответа и токен для журнала доступа
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	token  string
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Журнал доступа: время, адрес, токен, запрос, код ответа, размер и длительность
+func (s *apiServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, token: "-"}
+		next.ServeHTTP(rec, r)
+
+		remote := r.RemoteAddr
+		if remote == "" || remote == "@" {
+			remote = "unix"
+		}
+		s.logMu.Lock()
+		defer s.logMu.Unlock()
+		fmt.Fprintf(s.accessLog, "%s %s %s %q %d %d %s\n", start.Format(time.RFC3339), remote, rec.token,
+			r.Method+" "+r.URL.RequestURI(), rec.status, rec.bytes, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// Алгоритм работы функции:
+//
+// 1. Unix-сокет: удалить оставшийся от прошлого запуска сокет и открыть новый с правами 0600
+// 2. TCP: разрешить только адреса loopback, чтобы API не было доступно по сети
+
+func listenAPI(addr, socket string) (net.Listener, error) {
+	// 1
+	if socket != "" {
+		if st, err := os.Lstat(socket); err == nil && st.Mode()&os.ModeSocket != 0 {
+			os.Remove(socket)
+		}
+		ln, err := net.Listen("unix", socket)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(socket, 0600); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+
+	// 2
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("refusing to listen on %s: only loopback addresses are allowed", addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
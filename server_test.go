@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// Запись с тем же именем из недоступной токену папки не попадает в дубликаты
+func TestAPIAuditDuplicatesByID(t *testing.T) {
+	testHome(t)
+	pm := NewPasswordManagerWithStore(newMemoryStore())
+	if err := pm.SetMasterPassword("masterpass1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []Password{
+		{Name: "github", Username: "work", Category: "Work", Value: "Secret#Pass1"},
+		{Name: "github", Username: "home", Category: "Personal", Value: "Secret#Pass1"},
+		{Name: "gitlab", Username: "work", Category: "Work", Value: "Secret#Pass1"},
+	} {
+		if err := pm.SaveEntry(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tokens := &TokenStore{}
+	secret, err := tokens.Create("work", true, []string{"Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/audit", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	rec := httptest.NewRecorder()
+	newAPIServer(pm, tokens, io.Discard).Handler().ServeHTTP(rec, req)
+
+	var resp struct {
+		Total      int        `json:"total"`
+		Duplicates [][]string `json:"duplicates"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v", rec.Body, err)
+	}
+	if resp.Total != 2 || len(resp.Duplicates) != 1 || !slices.Equal(resp.Duplicates[0], []string{"github", "gitlab"}) {
+		t.Fatalf("total %d, duplicates %v", resp.Total, resp.Duplicates)
+	}
+}
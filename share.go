@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Передача одной записи другому человеку. Запись шифруется случайным ключом, ключ -
+// открытым ключом получателя (как в командных хранилищах), а всё вместе подписывается
+// ключом отправителя. Результат - текстовый блок, который можно переслать любым способом:
+//
+//	-----BEGIN PASSWORDMANAGER SHARE-----
+//	base64(JSON shareEnvelope)
+//	-----END PASSWORDMANAGER SHARE-----
+type shareEnvelope struct {
+	Version    int       `json:"version"`
+	Sender     string    `json:"sender"`
+	SenderName string    `json:"sender_name"`
+	Recipient  string    `json:"recipient"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Нулевое значение - без срока действия
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+	WrappedKey []byte    `json:"wrapped_key"`
+	// [nonce (12)] [AES-256-GCM(JSON записи)]
+	Data      []byte `json:"data"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Расшифрованная запись и сведения об отправителе
+type ReceivedShare struct {
+	Entry      Password
+	Sender     string
+	SenderName string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+const (
+	shareVersion    = 1
+	shareArmorBegin = "-----BEGIN PASSWORDMANAGER SHARE-----"
+	shareArmorEnd   = "-----END PASSWORDMANAGER SHARE-----"
+	shareArmorWidth = 64
+)
+
+// Алгоритм работы функции:
+//
+// 1. Проверить ключ получателя
+// 2. Зашифровать запись случайным ключом, а ключ - для получателя
+// 3. Подписать конверт ключом отправителя
+// 4. Упаковать в текстовый блок
+
+func SealShare(id *Identity, recipient string, entry Password, ttl time.Duration) (string, error) {
+	// 1
+	if _, err := ParsePublicIdentity(recipient); err != nil {
+		return "", err
+	}
+
+	// 2
+	env := shareEnvelope{
+		Version:    shareVersion,
+		Sender:     id.Public(),
+		SenderName: id.Name,
+		Recipient:  recipient,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	if ttl > 0 {
+		env.ExpiresAt = env.CreatedAt.Add(ttl)
+	}
+
+	key := randomBytes(MasterKeySize)
+	var err error
+	if env.WrappedKey, err = wrapDataKey(key, recipient); err != nil {
+		return "", err
+	}
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	if env.Data, err = seal(key, plain, []byte(recipient)); err != nil {
+		return "", err
+	}
+
+	// 3
+	digest, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	env.Signature = ed25519.Sign(id.signing, digest)
+
+	// 4
+	data, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	return armorShare(data), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Распаковать текстовый блок
+// 2. Проверить, что блок адресован этой личности, и подпись отправителя
+// 3. Проверить срок действия
+// 4. Расшифровать ключ и запись
+
+func OpenShare(id *Identity, text string) (ReceivedShare, error) {
+	var res ReceivedShare
+
+	// 1
+	data, err := dearmorShare(text)
+	if err != nil {
+		return res, err
+	}
+	var env shareEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return res, fmt.Errorf("%w: %v", ErrShareInvalid, err)
+	}
+	if env.Version != shareVersion {
+		return res, fmt.Errorf("%w: unsupported version %d", ErrShareInvalid, env.Version)
+	}
+
+	// 2
+	if env.Recipient != id.Public() {
+		return res, fmt.Errorf("%w (addressed to %s)", ErrShareRecipient, fingerprint(env.Recipient))
+	}
+	signature := env.Signature
+	env.Signature = nil
+	digest, err := json.Marshal(env)
+	if err != nil {
+		return res, err
+	}
+	if !verifySignature(env.Sender, digest, signature) {
+		return res, fmt.Errorf("%w: bad signature", ErrShareInvalid)
+	}
+
+	// 3
+	if !env.ExpiresAt.IsZero() && time.Now().After(env.ExpiresAt) {
+		return res, fmt.Errorf("%w on %s", ErrShareExpired, env.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+
+	// 4
+	key, err := unwrapDataKey(id, env.WrappedKey)
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrShareInvalid, err)
+	}
+	plain, err := openSealed(key, env.Data, []byte(env.Recipient))
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrShareInvalid, err)
+	}
+	if err := json.Unmarshal(plain, &res.Entry); err != nil {
+		return res, fmt.Errorf("%w: %v", ErrShareInvalid, err)
+	}
+
+	res.Sender = env.Sender
+	res.SenderName = env.SenderName
+	res.CreatedAt = env.CreatedAt
+	res.ExpiresAt = env.ExpiresAt
+	return res, nil
+}
+
+func armorShare(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var b strings.Builder
+	b.WriteString(shareArmorBegin + "\n")
+	for len(encoded) > shareArmorWidth {
+		b.WriteString(encoded[:shareArmorWidth] + "\n")
+		encoded = encoded[shareArmorWidth:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString(shareArmorEnd + "\n")
+	return b.String()
+}
+
+// Текст между строками BEGIN и END; пробелы и переводы строк внутри игнорируются
+func dearmorShare(text string) ([]byte, error) {
+	_, body, ok := strings.Cut(text, shareArmorBegin)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrShareInvalid, shareArmorBegin)
+	}
+	body, _, ok = strings.Cut(body, shareArmorEnd)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrShareInvalid, shareArmorEnd)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrShareInvalid, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Личность в отдельном домашнем каталоге: у каждого пользователя свой файл личности
+func testIdentity(t *testing.T, name string) *Identity {
+	t.Helper()
+	testHome(t)
+	id, err := CreateIdentity(name, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Изменить конверт передачи, не трогая подпись
+func tamperShare(t *testing.T, text string, edit func(env *shareEnvelope)) string {
+	t.Helper()
+	data, err := dearmorShare(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env shareEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatal(err)
+	}
+	edit(&env)
+	if data, err = json.Marshal(env); err != nil {
+		t.Fatal(err)
+	}
+	return armorShare(data)
+}
+
+func TestShareOpen(t *testing.T) {
+	alice, bob, carol := testIdentity(t, "alice"), testIdentity(t, "bob"), testIdentity(t, "carol")
+	entry := *NewPassword("github", "Secret#Pass1", "work")
+	text, err := SealShare(alice, bob.Public(), entry, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := OpenShare(bob, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePassword(got.Entry, entry) || got.Sender != alice.Public() || got.SenderName != "alice" {
+		t.Fatalf("received %+v", got)
+	}
+	// Текст можно переслать с другими отступами
+	if _, err := OpenShare(bob, "  "+strings.ReplaceAll(text, "\n", "\r\n  ")); err != nil {
+		t.Fatalf("reformatted share: %v", err)
+	}
+	if _, err := OpenShare(carol, text); !errors.Is(err, ErrShareRecipient) {
+		t.Fatalf("other recipient: got %v, want ErrShareRecipient", err)
+	}
+}
+
+func TestShareTampered(t *testing.T) {
+	alice, bob, carol := testIdentity(t, "alice"), testIdentity(t, "bob"), testIdentity(t, "carol")
+	text, err := SealShare(alice, bob.Public(), *NewPassword("github", "Secret#Pass1", ""), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, edit := range map[string]func(env *shareEnvelope){
+		"sender name":    func(env *shareEnvelope) { env.SenderName = "admin" },
+		"sender":         func(env *shareEnvelope) { env.Sender = carol.Public() },
+		"expiry removed": func(env *shareEnvelope) { env.ExpiresAt = time.Time{} },
+		"data":           func(env *shareEnvelope) { env.Data[len(env.Data)-1] ^= 1 },
+		"wrapped key":    func(env *shareEnvelope) { env.WrappedKey[len(env.WrappedKey)-1] ^= 1 },
+		"no signature":   func(env *shareEnvelope) { env.Signature = nil },
+	} {
+		if _, err := OpenShare(bob, tamperShare(t, text, edit)); !errors.Is(err, ErrShareInvalid) {
+			t.Errorf("%s: got %v, want ErrShareInvalid", name, err)
+		}
+	}
+
+	// Подписанный заново чужим ключом конверт выдаёт другого отправителя
+	forged := tamperShare(t, text, func(env *shareEnvelope) {
+		env.Sender, env.Signature = carol.Public(), nil
+		digest, _ := json.Marshal(env)
+		env.Signature = ed25519.Sign(carol.signing, digest)
+	})
+	if got, err := OpenShare(bob, forged); err == nil && got.Sender == alice.Public() {
+		t.Error("share re-signed by another key is attributed to the original sender")
+	}
+
+	for name, text := range map[string]string{
+		"no armor":   "hello",
+		"no end":     shareArmorBegin + "\nAAAA\n",
+		"bad base64": shareArmorBegin + "\n!!!\n" + shareArmorEnd,
+		"bad json":   armorShare([]byte("{")),
+	} {
+		if _, err := OpenShare(bob, text); !errors.Is(err, ErrShareInvalid) {
+			t.Errorf("%s: got %v, want ErrShareInvalid", name, err)
+		}
+	}
+}
+
+func TestShareExpired(t *testing.T) {
+	alice, bob := testIdentity(t, "alice"), testIdentity(t, "bob")
+	text, err := SealShare(alice, bob.Public(), *NewPassword("github", "Secret#Pass1", ""), time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := OpenShare(bob, text); !errors.Is(err, ErrShareExpired) {
+		t.Fatalf("got %v, want ErrShareExpired", err)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Ключи SSH хранятся записями вида ssh-key: закрытый ключ без пароля в формате OpenSSH
+// лежит в Value (его защищает шифрование хранилища), комментарий ключа - имя записи.
+//
+// Агент (команда ssh-agent) отдаёт эти ключи через сокет SSH_AUTH_SOCK. Ключи
+// загружаются из хранилища при разблокировке, после чего файл хранилища освобождается.
+// ssh-add -x удаляет ключи из памяти агента, ssh-add -X с мастер-паролем загружает заново
+const (
+	sshKeyCategory = "ssh"
+	sshRSABits     = 3072
+)
+
+// Алгоритм работы функции:
+//
+// 1. Сгенерировать ключ выбранного типа (ed25519, ecdsa P-256 или rsa)
+// 2. Упаковать закрытый ключ в PEM формата OpenSSH
+// 3. Вернуть PEM и открытый ключ в формате authorized_keys
+
+func GenerateSSHKey(keyType, comment string) (string, string, error) {
+	// 1
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, sshRSABits)
+	default:
+		return "", "", fmt.Errorf("unknown key type %q (ed25519, ecdsa, rsa)", keyType)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// 2
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return "", "", err
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return "", "", err
+	}
+
+	// 3
+	return string(pem.EncodeToMemory(block)), authorizedKey(pub, comment), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Разобрать закрытый ключ; зашифрованный ключ расшифровать паролем от passphrase
+// 2. Сохранить его без пароля в формате OpenSSH: ключ защищает хранилище
+
+func ImportSSHKey(data []byte, comment string, passphrase func() ([]byte, error)) (string, string, error) {
+	// 1
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		var pass []byte
+		if pass, err = passphrase(); err != nil {
+			return "", "", err
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, pass)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrSSHKeyInvalid, err)
+	}
+
+	// 2
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrSSHKeyInvalid, err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrSSHKeyInvalid, err)
+	}
+	return string(pem.EncodeToMemory(block)), authorizedKey(signer.PublicKey(), comment), nil
+}
+
+// Сохранение ключа новой записью категории ssh. Ключ не проверяется на надёжность
+// как пароль, поэтому запись добавляется через ImportPasswords
+func (pm *PasswordManager) AddSSHKey(name, privateKey string) error {
+	now := time.Now()
+	p := newImportedPassword(name, privateKey, sshKeyCategory, now, now)
+	p.Kind = KindSSHKey
+
+	report, err := pm.ImportPasswords([]Password{p}, ConflictSkip, false)
+	if err != nil {
+		return err
+	}
+	if len(report.Skipped) > 0 {
+		return fmt.Errorf("%w: %s", ErrPassExists, name)
+	}
+	return nil
+}
+
+func sshSigner(p Password) (ssh.Signer, error) {
+	if p.Kind != KindSSHKey {
+		return nil, fmt.Errorf("%w: %s", ErrNotSSHKey, p.Name)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(p.Value))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrSSHKeyInvalid, p.Name, err)
+	}
+	return signer, nil
+}
+
+// Открытый ключ записи в формате authorized_keys
+func sshPublicKey(p Password) (string, error) {
+	signer, err := sshSigner(p)
+	if err != nil {
+		return "", err
+	}
+	return authorizedKey(signer.PublicKey(), p.Name), nil
+}
+
+func authorizedKey(pub ssh.PublicKey, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+// Агент SSH с ключами из хранилища. Пока агент заблокирован, список ключей пуст
+type vaultAgent struct {
+	mu sync.Mutex
+	// Вопросы о подтверждении задаются по одному, но без a.mu: пока пользователь
+	// отвечает, другие клиенты получают список ключей, а ssh-add -x блокирует агент
+	prompt sync.Mutex
+	reg    *VaultRegistry
+	vault  string
+	keys   []agentKey
+	locked bool
+	// Подтверждение каждой подписи; nil - без подтверждения
+	confirm func(name, fingerprint string) bool
+}
+
+type agentKey struct {
+	name   string
+	signer ssh.Signer
+}
+
+func newVaultAgent(reg *VaultRegistry, vault string) *vaultAgent {
+	return &vaultAgent{reg: reg, vault: vault, locked: true}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Прочитать из хранилища все записи ssh-key
+// 2. Разобрать ключи; повреждённый ключ пропускается с сообщением
+// 3. Заменить ключи агента и снять блокировку
+
+func (a *vaultAgent) load(pm *PasswordManager) {
+	// 1
+	entries := pm.ListPasswords()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	// 2
+	var keys []agentKey
+	for _, p := range entries {
+		if p.Kind != KindSSHKey {
+			continue
+		}
+		signer, err := sshSigner(p)
+		if err != nil {
+			showError(err.Error())
+			continue
+		}
+		keys = append(keys, agentKey{name: p.Name, signer: signer})
+	}
+
+	// 3
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = keys
+	a.locked = false
+}
+
+func (a *vaultAgent) List() ([]*agent.Key, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	list := make([]*agent.Key, 0, len(a.keys))
+	for _, k := range a.keys {
+		pub := k.signer.PublicKey()
+		list = append(list, &agent.Key{Format: pub.Type(), Blob: pub.Marshal(), Comment: k.name})
+	}
+	return list, nil
+}
+
+func (a *vaultAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти ключ среди загруженных
+// 2. Если включено подтверждение - спросить пользователя, не держа блокировку агента;
+//    если за время вопроса агент заблокировали - не подписывать
+// 3. Подписать; для RSA учесть запрошенный алгоритм (rsa-sha2-256/512)
+
+func (a *vaultAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	// 1
+	found, err := a.findKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2
+	if a.confirm != nil {
+		a.prompt.Lock()
+		allowed := a.confirm(found.name, ssh.FingerprintSHA256(key))
+		a.prompt.Unlock()
+		if !allowed {
+			return nil, ErrAgentDenied
+		}
+		if found, err = a.findKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3
+	algorithm := ""
+	switch {
+	case flags&agent.SignatureFlagRsaSha256 != 0:
+		algorithm = ssh.KeyAlgoRSASHA256
+	case flags&agent.SignatureFlagRsaSha512 != 0:
+		algorithm = ssh.KeyAlgoRSASHA512
+	}
+	if algSigner, ok := found.signer.(ssh.AlgorithmSigner); ok && algorithm != "" {
+		return algSigner.SignWithAlgorithm(rand.Reader, data, algorithm)
+	}
+	return found.signer.Sign(rand.Reader, data)
+}
+
+func (a *vaultAgent) findKey(key ssh.PublicKey) (agentKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return agentKey{}, ErrAgentLocked
+	}
+	blob := key.Marshal()
+	for _, k := range a.keys {
+		if bytes.Equal(k.signer.PublicKey().Marshal(), blob) {
+			return k, nil
+		}
+	}
+	return agentKey{}, fmt.Errorf("%w: %s", ErrPassNotFound, ssh.FingerprintSHA256(key))
+}
+
+func (a *vaultAgent) Signers() ([]ssh.Signer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	signers := make([]ssh.Signer, len(a.keys))
+	for i, k := range a.keys {
+		signers[i] = k.signer
+	}
+	return signers, nil
+}
+
+// ssh-add -x: убрать ключи из памяти. Пароль блокировки не нужен - для разблокировки
+// всё равно требуется мастер-пароль хранилища
+func (a *vaultAgent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return ErrAgentLocked
+	}
+	a.keys = nil
+	a.locked = true
+	showInfo("Agent locked")
+	return nil
+}
+
+// ssh-add -X: открыть хранилище с мастер-паролем и снова загрузить ключи
+func (a *vaultAgent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	locked := a.locked
+	a.mu.Unlock()
+	if !locked {
+		return fmt.Errorf("agent is not locked")
+	}
+
+	sess, err := openVaultSession(a.reg, a.vault)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	if err := sess.Open(string(passphrase)); err != nil {
+		return err
+	}
+
+	a.load(sess.PM)
+	showInfo("Agent unlocked")
+	return nil
+}
+
+// Ключи добавляются в хранилище командами ssh-key, а не через ssh-add
+func (a *vaultAgent) Add(key agent.AddedKey) error   { return ErrAgentReadOnly }
+func (a *vaultAgent) Remove(key ssh.PublicKey) error { return ErrAgentReadOnly }
+func (a *vaultAgent) RemoveAll() error               { return ErrAgentReadOnly }
+func (a *vaultAgent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+// Подтверждение подписи в терминале агента: запросы обрабатываются по одному
+func ttyConfirm(tty *os.File) func(name, fingerprint string) bool {
+	reader := bufio.NewReader(tty)
+	return func(name, fingerprint string) bool {
+		fmt.Fprintf(tty, "Allow signing with key %q (%s)? [y/N]: ", name, fingerprint)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// Путь сокета по умолчанию: $XDG_RUNTIME_DIR/passwordmanager/agent.sock
+// или /tmp/passwordmanager-UID/agent.sock
+func defaultAgentSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dir = filepath.Join(dir, "passwordmanager")
+	} else {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("passwordmanager-%d", os.Getuid()))
+	}
+	return filepath.Join(dir, "agent.sock")
+}
+
+// Алгоритм работы функции:
+//
+// 1. Создать каталог сокета, доступный только владельцу. Уже существующий каталог
+//    (например, заранее созданный другим пользователем в /tmp) должен принадлежать
+//    текущему пользователю и быть закрыт для остальных - иначе сокет могут подменить
+// 2. Если на сокете уже отвечает агент - не занимать его; иначе удалить старый файл
+// 3. Начать слушать сокет с правами 0600
+
+func listenAgent(path string) (net.Listener, error) {
+	// 1
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return nil, err
+	}
+
+	// 2
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("an agent is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// 3
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Каталог - не символическая ссылка, принадлежит текущему пользователю и закрыт для остальных
+func checkPrivateDir(dir string) error {
+	st, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if uid, ok := fileOwner(st); ok && uid != os.Getuid() {
+		return fmt.Errorf("%s is owned by another user (uid %d), refusing to use it", dir, uid)
+	}
+	if st.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is accessible by other users (mode %04o), run 'chmod 700 %s'", dir, st.Mode().Perm(), dir)
+	}
+	return nil
+}
+
+// Обслуживать подключения, пока сокет не закроют
+func serveAgent(ln net.Listener, a agent.Agent) error {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			agent.ServeAgent(a, conn)
+		}()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testAgent(t *testing.T) (*vaultAgent, ssh.PublicKey) {
+	t.Helper()
+	private, _, err := GenerateSSHKey("ed25519", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := sshSigner(Password{Name: "laptop", Kind: KindSSHKey, Value: private})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newVaultAgent(nil, "")
+	a.keys, a.locked = []agentKey{{name: "laptop", signer: signer}}, false
+	return a, signer.PublicKey()
+}
+
+func TestAgentSign(t *testing.T) {
+	a, pub := testAgent(t)
+	sig, err := a.Sign(pub, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Verify([]byte("data"), sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Пока вопрос о подтверждении ждёт ответа, агент отвечает на List и блокируется;
+// подпись после блокировки отклоняется
+func TestAgentConfirmDoesNotBlock(t *testing.T) {
+	a, pub := testAgent(t)
+	asked, answer := make(chan struct{}), make(chan bool)
+	a.confirm = func(name, fingerprint string) bool {
+		close(asked)
+		return <-answer
+	}
+
+	result := make(chan error)
+	go func() {
+		_, err := a.Sign(pub, []byte("data"))
+		result <- err
+	}()
+	<-asked
+
+	done := make(chan error)
+	go func() {
+		if _, err := a.List(); err != nil {
+			done <- err
+			return
+		}
+		done <- a.Lock(nil)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("List and Lock blocked by a pending confirmation")
+	}
+
+	answer <- true
+	if err := <-result; !errors.Is(err, ErrAgentLocked) {
+		t.Fatalf("sign after lock: got %v, want ErrAgentLocked", err)
+	}
+}
+
+func TestListenAgentRejectsSharedDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "agent")
+	if err := os.Mkdir(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenAgent(filepath.Join(dir, "agent.sock")); err == nil {
+		t.Fatal("listening in a world-writable directory")
+	}
+
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenAgent(filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+}
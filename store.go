@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Хранилище зашифрованных данных менеджера.
+// Менеджер не знает, где лежат данные: файл, каталог или память
+type VaultStore interface {
+	// Загрузка и расшифровка записей. Если хранилища ещё нет - ошибка os.ErrNotExist
+	Load(key []byte) (map[string]Password, error)
+	// Шифрование и сохранение всех записей
+	Save(key []byte, passwords map[string]Password) error
+	// Эксклюзивная блокировка на время работы. Возвращает функцию снятия блокировки
+	Lock() (func() error, error)
+	// Сведения о хранилище без расшифровки
+	Stat() (VaultInfo, error)
+}
+
+type VaultInfo struct {
+	// Адрес хранилища в виде URI (file://, dir://, mem://, team://)
+	URI string
+	// Создано ли хранилище
+	Exists bool
+	// Размер данных в байтах
+	Size int64
+	// Время последнего изменения
+	ModTime time.Time
+}
+
+// Схемы URI хранилищ
+const (
+	storeSchemeFile   = "file"
+	storeSchemeDir    = "dir"
+	storeSchemeMemory = "mem"
+	storeSchemeTeam   = "team"
+)
+
+// Алгоритм работы функции:
+//
+// 1. Строка без схемы - путь к файлу, как раньше
+// 2. По схеме выбрать реализацию: file:// (в git-репозитории - с историей), dir://, mem://, team://
+// 3. Вернуть ошибку для неизвестной схемы
+
+func OpenVaultStore(uri string) (VaultStore, error) {
+	// 1
+	scheme, path, ok := strings.Cut(uri, "://")
+	if !ok {
+		return openFileStore(uri), nil
+	}
+
+	// 2
+	switch scheme {
+	case storeSchemeFile:
+		return openFileStore(path), nil
+	case storeSchemeDir:
+		return newDirStore(path), nil
+	case storeSchemeMemory:
+		return newMemoryStore(), nil
+	case storeSchemeTeam:
+		return newTeamStore(path), nil
+	}
+
+	// 3
+	return nil, fmt.Errorf("unknown vault scheme %q in %s", scheme, uri)
+}
+
+// Файл внутри git-репозитория получает историю версий и синхронизацию
+func openFileStore(path string) VaultStore {
+	fs := newFileStore(path)
+	if gs, ok := newGitStore(fs); ok {
+		return gs
+	}
+	return fs
+}
+
+// Хранилище в памяти - для тестов и временной работы, ничего не пишет на диск
+type memoryStore struct {
+	mu        sync.Mutex
+	passwords map[string]Password
+	locked    bool
+	modTime   time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Load(key []byte) (map[string]Password, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.passwords == nil {
+		return nil, os.ErrNotExist
+	}
+	return copyPasswords(s.passwords), nil
+}
+
+func (s *memoryStore) Save(key []byte, passwords map[string]Password) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.passwords = copyPasswords(passwords)
+	s.modTime = time.Now()
+	return nil
+}
+
+func (s *memoryStore) Lock() (func() error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked {
+		return nil, ErrVaultLocked
+	}
+	s.locked = true
+
+	return func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.locked = false
+		return nil
+	}, nil
+}
+
+func (s *memoryStore) Stat() (VaultInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return VaultInfo{URI: storeSchemeMemory + "://", Exists: s.passwords != nil, ModTime: s.modTime}, nil
+}
+
+func copyPasswords(src map[string]Password) map[string]Password {
+	dst := make(map[string]Password, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// Хранилище "файл на запись": каждая запись зашифрована в отдельном файле каталога.
+// Имя файла - HMAC ID записи, поэтому по листингу каталога названия сервисов не видны,
+// а изменение одной записи меняет только один файл
+type dirStore struct {
+	dir string
+}
+
+const dirStoreExt = ".entry"
+
+func newDirStore(dir string) *dirStore {
+	return &dirStore{dir: dir}
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти все файлы записей в каталоге
+// 2. Расшифровать каждый и собрать map по ID записи (у записей без ID ключ - имя)
+
+func (s *dirStore) Load(key []byte) (map[string]Password, error) {
+	// 1
+	if _, err := os.Stat(s.dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+dirStoreExt))
+	if err != nil {
+		return nil, err
+	}
+
+	// 2
+	passwords := make(map[string]Password, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := decryptData(key, data)
+		if err != nil {
+			return nil, err
+		}
+		var p Password
+		if err := json.Unmarshal(plain, &p); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+		// Старые записи без ID - по имени, из него migrateEntryIDs получит ID
+		key := p.ID
+		if key == "" {
+			key = p.Name
+		}
+		passwords[key] = p
+	}
+
+	return migrateEntryIDs(passwords), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Создать каталог при необходимости
+// 2. Зашифровать и записать каждую запись в свой файл
+// 3. Удалить файлы записей, которых больше нет
+
+func (s *dirStore) Save(key []byte, passwords map[string]Password) error {
+	// 1
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	// 2
+	keep := make(map[string]bool, len(passwords))
+	for id, p := range passwords {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		encrypted, err := encryptData(key, data)
+		if err != nil {
+			return err
+		}
+		path := s.entryPath(key, id)
+		if err := writeFileAtomic(path, encrypted, 0600); err != nil {
+			return err
+		}
+		keep[path] = true
+	}
+
+	// 3
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+dirStoreExt))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !keep[f] {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *dirStore) entryPath(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(mac.Sum(nil))[:32]+dirStoreExt)
+}
+
+func (s *dirStore) Lock() (func() error, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	return lockPath(filepath.Join(s.dir, ".lock"))
+}
+
+func (s *dirStore) Stat() (VaultInfo, error) {
+	info := VaultInfo{URI: storeSchemeDir + "://" + s.dir}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+dirStoreExt))
+	if err != nil {
+		return info, err
+	}
+	info.Exists = len(files) > 0
+	for _, f := range files {
+		st, err := os.Stat(f)
+		if err != nil {
+			return info, err
+		}
+		info.Size += st.Size()
+		if st.ModTime().After(info.ModTime) {
+			info.ModTime = st.ModTime()
+		}
+	}
+
+	return info, nil
+}
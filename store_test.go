@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// Две записи одного сервиса с разными логинами - разные аккаунты и после загрузки
+func TestDirStoreDuplicateNames(t *testing.T) {
+	s := newDirStore(filepath.Join(t.TempDir(), "vault"))
+
+	alice := NewPassword("github", "Secret#Pass1", "work")
+	alice.Username = "alice"
+	bob := NewPassword("github", "Secret#Pass2", "work")
+	bob.Username = "bob"
+	in := map[string]Password{alice.ID: *alice, bob.ID: *bob}
+
+	if err := s.Save(testKey, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Load(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("loaded %d entries, want 2", len(out))
+	}
+	for id, p := range in {
+		if got := out[id]; got.Username != p.Username || got.Value != p.Value {
+			t.Errorf("entry %s: got %+v, want %+v", id, got, p)
+		}
+	}
+
+	// Повторное сохранение не удаляет файлы записей
+	if err := s.Save(testKey, out); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(s.dir, "*"+dirStoreExt))
+	if len(files) != 2 {
+		t.Fatalf("%d entry files after second save, want 2", len(files))
+	}
+}
+
+// Запись без ID из старого хранилища получает ID от имени
+func TestDirStoreLegacyEntry(t *testing.T) {
+	s := newDirStore(t.TempDir())
+
+	data, err := json.Marshal(Password{Name: "github", Value: "Secret#Pass1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptData(testKey, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.entryPath(testKey, "github"), encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := s.Load(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := legacyEntryID("github")
+	if p, ok := out[id]; !ok || p.ID != id || p.Name != "github" {
+		t.Fatalf("legacy entry not migrated: %+v", out)
+	}
+}
+
+// Хранилище в памяти отдаёт копию: изменения после Save не попадают в хранилище
+func TestMemoryStoreRoundTrip(t *testing.T) {
+	s := newMemoryStore()
+	if _, err := s.Load(testKey); !os.IsNotExist(err) {
+		t.Fatalf("empty store: got %v, want os.ErrNotExist", err)
+	}
+
+	p := NewPassword("github", "Secret#Pass1", "")
+	in := map[string]Password{p.ID: *p}
+	if err := s.Save(testKey, in); err != nil {
+		t.Fatal(err)
+	}
+	delete(in, p.ID)
+
+	out, err := s.Load(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[p.ID].Name != "github" {
+		t.Fatalf("got %+v", out)
+	}
+}
+
+// Разблокированный менеджер с пустым хранилищем mem://
+func testManager(t *testing.T) *PasswordManager {
+	t.Helper()
+	store, err := OpenVaultStore("mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := NewPasswordManagerWithStore(store)
+	if err := pm.SetMasterPassword("masterpass1"); err != nil {
+		t.Fatal(err)
+	}
+	return pm
+}
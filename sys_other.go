@@ -0,0 +1,27 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func fileOwner(st os.FileInfo) (int, bool) {
+	return 0, false
+}
+
+func flockPath(lockFile string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// На Windows FindProcess открывает процесс и завершается ошибкой, если его нет.
+// Где проверить нельзя, процесс считается живым
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
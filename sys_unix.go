@@ -0,0 +1,52 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Владелец файла (UID); false - платформа его не сообщает
+func fileOwner(st os.FileInfo) (int, bool) {
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		return int(sys.Uid), true
+	}
+	return 0, false
+}
+
+// Открыть файл блокировки и захватить на нём flock без ожидания. Если прежний владелец
+// успел удалить файл между открытием и захватом, попытка повторяется с новым файлом
+func flockPath(lockFile string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				pid, _ := lockOwner(lockFile)
+				return nil, lockedError(lockFile, pid)
+			}
+			return nil, err
+		}
+
+		held, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(lockFile); err == nil && os.SameFile(held, current) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// Жив ли процесс: сигнал 0 только проверяет его существование
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
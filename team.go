@@ -0,0 +1,676 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Командное хранилище team://PATH - один JSON-файл, общий для нескольких участников.
+//
+// Записи шифруются случайным ключом данных (AES-256-GCM). Ключ данных зашифрован
+// отдельно для каждого участника его открытым ключом X25519 (эфемерный ECDH + HKDF),
+// поэтому общего мастер-пароля нет: каждый открывает хранилище своей личностью.
+//
+// Роли защищены подписями Ed25519: создатель подписывает сам себя, каждого следующего
+// участника подписывает добавивший его участник с ролью rw, а содержимое файла
+// подписывает последний записавший его участник. Файл, подписанный участником с
+// ролью ro или посторонним, не загружается.
+//
+// Каждое сохранение увеличивает поколение файла, оно входит в подпись. Последнее
+// увиденное поколение хранится локально, поэтому старую копию файла (например, до
+// удаления участника и смены ключа данных) подложить нельзя.
+//
+// Подпись членства не зависит от времени, поэтому удалённый участник мог бы вернуть
+// в файл свою прежнюю запись. Ключи удалённых участников перечисляются в списке
+// отзыва, который входит в подпись файла: участник из этого списка не принимается.
+// Увиденные отзывы тоже запоминаются локально, и файл, из которого отзыв пропал, не открывается
+type teamStore struct {
+	path string
+	// Личность, открывшая хранилище
+	id *Identity
+	// Последнее загруженное или записанное состояние файла
+	file    teamFile
+	dataKey []byte
+	// Записи на момент загрузки: без изменений файл не перезаписывается
+	snapshot map[string]Password
+	// Изменился состав участников или ключ данных
+	dirty bool
+}
+
+type TeamRole string
+
+const (
+	RoleReadWrite TeamRole = "rw"
+	RoleReadOnly  TeamRole = "ro"
+)
+
+type TeamMember struct {
+	Name      string   `json:"name"`
+	PublicKey string   `json:"public_key"`
+	Role      TeamRole `json:"role"`
+	// Открытый ключ участника, подписавшего это членство
+	AddedBy     string `json:"added_by"`
+	Endorsement []byte `json:"endorsement"`
+	// [эфемерный X25519 (32)] [nonce (12)] [AES-256-GCM(ключ данных)]
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// Отозванное членство: участник удалён и больше не принимается
+type TeamRevocation struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+	// Открытый ключ участника, удалившего этого
+	RevokedBy string `json:"revoked_by"`
+}
+
+type teamFile struct {
+	Version int          `json:"version"`
+	Creator string       `json:"creator"`
+	Members []TeamMember `json:"members"`
+	// Удалённые участники; список только растёт
+	Revoked []TeamRevocation `json:"revoked,omitempty"`
+	// [nonce (12)] [AES-256-GCM(JSON записей)]
+	Data []byte `json:"data"`
+	// Номер сохранения; только растёт
+	Generation uint64 `json:"generation,omitempty"`
+	Signer     string `json:"signer"`
+	Signature  []byte `json:"signature,omitempty"`
+}
+
+const (
+	teamFileVersion = 3
+	// Файлы до появления поколений (1) и списка отзыва (2); читаются,
+	// при сохранении переводятся на teamFileVersion
+	teamFileVersionLegacy    = 1
+	teamFileVersionNoRevoked = 2
+	teamGenerationsDir       = "team"
+	teamWrapInfo             = "passwordmanager team data key"
+	teamEndorseTag           = "passwordmanager team member"
+)
+
+func newTeamStore(path string) *teamStore {
+	return &teamStore{path: path}
+}
+
+func ParseTeamRole(s string) (TeamRole, error) {
+	switch TeamRole(s) {
+	case RoleReadWrite, RoleReadOnly:
+		return TeamRole(s), nil
+	}
+	return "", fmt.Errorf("unknown role %q (rw, ro)", s)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Открыть личность ключом из пароля личности
+// 2. Прочитать файл и проверить подписи участников и содержимого
+// 3. Поколение файла не может быть меньше уже увиденного, а увиденные отзывы не могут пропасть
+// 4. Найти себя среди участников и расшифровать свою копию ключа данных
+// 5. Расшифровать записи, запомнить снимок, поколение и отзывы
+
+func (s *teamStore) Load(key []byte) (map[string]Password, error) {
+	// 1
+	id, err := LoadIdentity(key)
+	if err != nil {
+		return nil, err
+	}
+	s.id = id
+
+	// 2
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var f teamFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	if err := verifyTeamFile(f); err != nil {
+		return nil, err
+	}
+
+	// 3
+	seen, err := loadTeamGeneration(s.path, f.Creator)
+	if err != nil {
+		return nil, err
+	}
+	if f.Generation < seen {
+		return nil, fmt.Errorf("%w: generation %d, already seen %d", ErrTeamRollback, f.Generation, seen)
+	}
+	revoked, err := loadTeamRevoked(s.path, f.Creator)
+	if err != nil {
+		return nil, err
+	}
+	for _, public := range revoked {
+		if !f.revoked(public) {
+			return nil, fmt.Errorf("%w: removed member %s is missing from the revocation list", ErrTeamRollback, fingerprint(public))
+		}
+	}
+
+	// 4
+	me := f.member(id.Public())
+	if me == nil {
+		return nil, fmt.Errorf("%w (%s)", ErrNotMember, fingerprint(id.Public()))
+	}
+	dataKey, err := unwrapDataKey(id, me.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5
+	plain, err := openSealed(dataKey, f.Data, []byte(f.Creator))
+	if err != nil {
+		return nil, fmt.Errorf("%w: vault data", ErrTeamSignature)
+	}
+	passwords := make(map[string]Password)
+	if err := json.Unmarshal(plain, &passwords); err != nil {
+		return nil, err
+	}
+	passwords = migrateEntryIDs(passwords)
+	if err := saveTeamState(s.path, f); err != nil {
+		return nil, err
+	}
+
+	s.file = f
+	s.dataKey = dataKey
+	s.snapshot = copyPasswords(passwords)
+	s.dirty = false
+	return passwords, nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Новое хранилище: создать ключ данных, текущая личность - создатель с ролью rw
+// 2. Если ни данные, ни участники не менялись - не перезаписывать файл. Якорь журнала
+//    аудита участника с ролью ro не записывается: менять файл он не может
+// 3. Записывать может только участник с ролью rw
+// 4. Зашифровать записи ключом данных, увеличить поколение и подписать файл
+// 5. Записать файл атомарно и запомнить новое поколение и отзывы
+
+func (s *teamStore) Save(key []byte, passwords map[string]Password) error {
+	if s.id == nil {
+		id, err := LoadIdentity(key)
+		if err != nil {
+			return err
+		}
+		s.id = id
+	}
+
+	// 1
+	if s.dataKey == nil {
+		if err := s.create(); err != nil {
+			return err
+		}
+	}
+
+	// 2
+	if !s.dirty && len(diffEntries(s.snapshot, passwords)) == 0 &&
+		(sameEntries(s.snapshot, passwords) || s.Role() != RoleReadWrite) {
+		return nil
+	}
+
+	// 3
+	if s.Role() != RoleReadWrite {
+		return ErrVaultReadOnly
+	}
+
+	// 4
+	plain, err := json.Marshal(passwords)
+	if err != nil {
+		return err
+	}
+	f := s.file
+	f.Version = teamFileVersion
+	f.Generation++
+	if f.Data, err = seal(s.dataKey, plain, []byte(f.Creator)); err != nil {
+		return err
+	}
+	f.Signer = s.id.Public()
+	f.Signature = nil
+	digest, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	f.Signature = ed25519.Sign(s.id.signing, digest)
+
+	// 5
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data, 0600); err != nil {
+		return err
+	}
+	if err := saveTeamState(s.path, f); err != nil {
+		return err
+	}
+
+	s.file = f
+	s.snapshot = copyPasswords(passwords)
+	s.dirty = false
+	return nil
+}
+
+func (s *teamStore) Lock() (func() error, error) {
+	return lockPath(s.path + ".lock")
+}
+
+func (s *teamStore) Stat() (VaultInfo, error) {
+	info, err := newFileStore(s.path).Stat()
+	info.URI = storeSchemeTeam + "://" + s.path
+	return info, err
+}
+
+// Первое сохранение: создатель подписывает собственное членство
+func (s *teamStore) create() error {
+	s.dataKey = randomBytes(MasterKeySize)
+	s.file = teamFile{Version: teamFileVersion, Creator: s.id.Public()}
+	s.dirty = true
+	return s.appendMember(s.id.Name, s.id.Public(), RoleReadWrite)
+}
+
+// Роль открывшей хранилище личности; пустая строка - не участник
+func (s *teamStore) Role() TeamRole {
+	if s.id == nil {
+		return ""
+	}
+	if m := s.file.member(s.id.Public()); m != nil {
+		return m.Role
+	}
+	return ""
+}
+
+func (s *teamStore) Members() []TeamMember {
+	return append([]TeamMember(nil), s.file.Members...)
+}
+
+func (s *teamStore) Creator() string {
+	return s.file.Creator
+}
+
+// Алгоритм работы функции:
+//
+// 1. Управлять участниками может только участник с ролью rw уже открытого хранилища
+// 2. Проверить ключ и отсутствие участника с тем же именем или ключом.
+//    Удалённого участника вернуть нельзя: его ключ остаётся в списке отзыва
+// 3. Подписать членство и зашифровать для участника текущий ключ данных
+
+func (s *teamStore) AddMember(name, public string, role TeamRole) error {
+	// 1
+	if err := s.requireWriter(); err != nil {
+		return err
+	}
+
+	// 2
+	if _, err := ParsePublicIdentity(public); err != nil {
+		return err
+	}
+	for _, m := range s.file.Members {
+		if m.Name == name || m.PublicKey == public {
+			return fmt.Errorf("%w: %s", ErrMemberExists, m.Name)
+		}
+	}
+	if s.file.revoked(public) {
+		return fmt.Errorf("%w (%s): the member needs a new identity", ErrMemberRevoked, fingerprint(public))
+	}
+
+	// 3
+	if err := s.appendMember(name, public, role); err != nil {
+		return err
+	}
+	s.dirty = true
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить права; создателя и самого себя удалить нельзя
+// 2. Убрать участника, внести его ключ в список отзыва и сменить ключ данных,
+//    чтобы старая копия ключа больше не подходила
+// 3. Переподписать участников, которых добавлял удалённый, и зашифровать
+//    новый ключ для всех оставшихся
+
+func (s *teamStore) RemoveMember(name string) error {
+	// 1
+	if err := s.requireWriter(); err != nil {
+		return err
+	}
+	i := s.file.memberIndex(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrMemberNotFound, name)
+	}
+	removed := s.file.Members[i]
+	switch removed.PublicKey {
+	case s.file.Creator:
+		return fmt.Errorf("the creator of the vault cannot be removed")
+	case s.id.Public():
+		return fmt.Errorf("cannot remove yourself, ask another rw member")
+	}
+
+	// 2
+	dataKey := randomBytes(MasterKeySize)
+	members := append(s.file.Members[:i:i], s.file.Members[i+1:]...)
+	revocation := TeamRevocation{Name: removed.Name, PublicKey: removed.PublicKey, RevokedBy: s.id.Public()}
+
+	// 3
+	var err error
+	for j := range members {
+		m := &members[j]
+		if m.AddedBy == removed.PublicKey {
+			m.AddedBy = s.id.Public()
+			m.Endorsement = ed25519.Sign(s.id.signing, endorsementMessage(s.file.Creator, *m))
+		}
+		if m.WrappedKey, err = wrapDataKey(dataKey, m.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	s.file.Members = members
+	s.file.Revoked = append(s.file.Revoked, revocation)
+	s.dataKey = dataKey
+	s.dirty = true
+	return nil
+}
+
+func (s *teamStore) requireWriter() error {
+	if s.id == nil || s.dataKey == nil {
+		return ErrPassManagerNotInit
+	}
+	if s.Role() != RoleReadWrite {
+		return ErrVaultReadOnly
+	}
+	return nil
+}
+
+func (s *teamStore) appendMember(name, public string, role TeamRole) error {
+	wrapped, err := wrapDataKey(s.dataKey, public)
+	if err != nil {
+		return err
+	}
+
+	m := TeamMember{Name: name, PublicKey: public, Role: role, AddedBy: s.id.Public(), WrappedKey: wrapped}
+	m.Endorsement = ed25519.Sign(s.id.signing, endorsementMessage(s.file.Creator, m))
+	s.file.Members = append(s.file.Members, m)
+	return nil
+}
+
+func (f *teamFile) member(public string) *TeamMember {
+	for i := range f.Members {
+		if f.Members[i].PublicKey == public {
+			return &f.Members[i]
+		}
+	}
+	return nil
+}
+
+func (f *teamFile) revoked(public string) bool {
+	for _, r := range f.Revoked {
+		if r.PublicKey == public {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *teamFile) memberIndex(name string) int {
+	for i, m := range f.Members {
+		if m.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Подписываемое содержимое членства. Ключ создателя привязывает подпись к хранилищу
+func endorsementMessage(creator string, m TeamMember) []byte {
+	return []byte(strings.Join([]string{teamEndorseTag, creator, m.Name, m.PublicKey, string(m.Role)}, "\n"))
+}
+
+// Алгоритм работы функции:
+//
+// 1. Создатель должен быть участником с ролью rw и подписать себя сам
+// 2. Остальные участники принимаются, если их подписал уже проверенный участник с ролью rw
+//    и их ключа нет в списке отзыва
+// 3. Содержимое файла (вместе со списком отзыва) должен подписать проверенный участник с ролью rw
+
+func verifyTeamFile(f teamFile) error {
+	switch {
+	case f.Version == teamFileVersionLegacy && f.Generation != 0,
+		f.Version < teamFileVersion && len(f.Revoked) > 0,
+		f.Version != teamFileVersion && f.Version != teamFileVersionNoRevoked && f.Version != teamFileVersionLegacy:
+		return fmt.Errorf("unsupported team vault version %d", f.Version)
+	}
+
+	// 1
+	roles := make(map[string]TeamRole, len(f.Members))
+	creator := f.member(f.Creator)
+	if creator == nil || creator.Role != RoleReadWrite || creator.AddedBy != f.Creator ||
+		!verifySignature(f.Creator, endorsementMessage(f.Creator, *creator), creator.Endorsement) {
+		return fmt.Errorf("%w: creator", ErrTeamSignature)
+	}
+	roles[f.Creator] = RoleReadWrite
+
+	// 2
+	for _, m := range f.Members {
+		if f.revoked(m.PublicKey) {
+			return fmt.Errorf("%w: member %s was removed from the vault", ErrTeamSignature, m.Name)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, m := range f.Members {
+			if _, ok := roles[m.PublicKey]; ok || roles[m.AddedBy] != RoleReadWrite {
+				continue
+			}
+			if !verifySignature(m.AddedBy, endorsementMessage(f.Creator, m), m.Endorsement) {
+				return fmt.Errorf("%w: member %s", ErrTeamSignature, m.Name)
+			}
+			roles[m.PublicKey] = m.Role
+			changed = true
+		}
+	}
+	for _, m := range f.Members {
+		if _, ok := roles[m.PublicKey]; !ok {
+			return fmt.Errorf("%w: member %s is not endorsed by a rw member", ErrTeamSignature, m.Name)
+		}
+	}
+
+	// 3
+	if roles[f.Signer] != RoleReadWrite {
+		return fmt.Errorf("%w: last change was not made by a rw member", ErrTeamSignature)
+	}
+	signature := f.Signature
+	f.Signature = nil
+	digest, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if !verifySignature(f.Signer, digest, signature) {
+		return fmt.Errorf("%w: vault data", ErrTeamSignature)
+	}
+
+	return nil
+}
+
+// Файл с локальным состоянием командного хранилища: последним увиденным поколением
+// (.generation) или увиденными отзывами (.revoked). Ключ - путь к файлу хранилища и его
+// создатель, поэтому хранилища с одним именем в разных каталогах не путаются
+func teamStatePath(path, creator, ext string) (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path + "\n" + creator))
+	return filepath.Join(dir, teamGenerationsDir, hex.EncodeToString(sum[:16])+ext), nil
+}
+
+func readTeamState(path, creator, ext string) (string, error) {
+	file, err := teamStatePath(path, creator, ext)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+func writeTeamState(path, creator, ext, data string) error {
+	file, err := teamStatePath(path, creator, ext)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, []byte(data), 0600)
+}
+
+func loadTeamGeneration(path, creator string) (uint64, error) {
+	data, err := readTeamState(path, creator, ".generation")
+	if err != nil || data == "" {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(data), 10, 64)
+}
+
+// Открытые ключи отозванных участников, которые уже встречались в этом хранилище
+func loadTeamRevoked(path, creator string) ([]string, error) {
+	data, err := readTeamState(path, creator, ".revoked")
+	return strings.Fields(data), err
+}
+
+// Запомнить поколение и отзывы проверенного файла. Поколение только растёт,
+// отзывы только добавляются
+func saveTeamState(path string, f teamFile) error {
+	seen, err := loadTeamGeneration(path, f.Creator)
+	if err != nil {
+		return err
+	}
+	if f.Generation > seen {
+		if err := writeTeamState(path, f.Creator, ".generation", strconv.FormatUint(f.Generation, 10)+"\n"); err != nil {
+			return err
+		}
+	}
+
+	revoked, err := loadTeamRevoked(path, f.Creator)
+	if err != nil {
+		return err
+	}
+	if len(f.Revoked) == len(revoked) {
+		return nil
+	}
+	var b strings.Builder
+	for _, r := range f.Revoked {
+		b.WriteString(r.PublicKey + "\n")
+	}
+	return writeTeamState(path, f.Creator, ".revoked", b.String())
+}
+
+func verifySignature(public string, message, signature []byte) bool {
+	pub, err := ParsePublicIdentity(public)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub.signing, message, signature)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сгенерировать эфемерную пару X25519 и общий секрет с ключом получателя
+// 2. Вывести ключ шифрования через HKDF от секрета и обоих открытых ключей
+// 3. Зашифровать ключ данных, привязав его к ключу получателя
+
+func wrapDataKey(dataKey []byte, recipient string) ([]byte, error) {
+	pub, err := ParsePublicIdentity(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(pub.exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2
+	kek, err := wrapKey(shared, eph.PublicKey().Bytes(), pub.exchange.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// 3
+	sealed, err := seal(kek, dataKey, []byte(recipient))
+	if err != nil {
+		return nil, err
+	}
+	return append(eph.PublicKey().Bytes(), sealed...), nil
+}
+
+func unwrapDataKey(id *Identity, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 32 {
+		return nil, fmt.Errorf("%w: wrapped key", ErrTeamSignature)
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(wrapped[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := id.exchange.ECDH(ephPub)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := wrapKey(shared, wrapped[:32], id.exchange.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := openSealed(kek, wrapped[32:], []byte(id.Public()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrapped key", ErrTeamSignature)
+	}
+	return dataKey, nil
+}
+
+func wrapKey(shared, ephPub, recipientPub []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, shared, append(append([]byte{}, ephPub...), recipientPub...), teamWrapInfo, MasterKeySize)
+}
+
+// [nonce] [AES-256-GCM шифротекст]
+func seal(key, plain, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := randomBytes(gcm.NonceSize())
+	return gcm.Seal(nonce, nonce, plain, additional), nil
+}
+
+func openSealed(key, data, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additional)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Каталоги настроек и данных приложения во временном каталоге теста
+func testHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	return home
+}
+
+func TestTeamStoreRollback(t *testing.T) {
+	home := testHome(t)
+	if _, err := CreateIdentity("alice", testKey); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(home, "ops.team")
+
+	s := newTeamStore(path)
+	p := NewPassword("github", "Secret#Pass1", "")
+	passwords := map[string]Password{p.ID: *p}
+	if err := s.Save(testKey, passwords); err != nil {
+		t.Fatal(err)
+	}
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewPassword("gitlab", "Secret#Pass2", "")
+	passwords[q.ID] = *q
+	if err := s.Save(testKey, passwords); err != nil {
+		t.Fatal(err)
+	}
+	if s.file.Generation != 2 {
+		t.Fatalf("generation %d after two saves, want 2", s.file.Generation)
+	}
+
+	// Старая копия файла с верной подписью не открывается
+	if err := os.WriteFile(path, old, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTeamStore(path).Load(testKey); !errors.Is(err, ErrTeamRollback) {
+		t.Fatalf("old file: got %v, want ErrTeamRollback", err)
+	}
+
+	// Поколение входит в подпись: поднять его вручную нельзя
+	if err := os.WriteFile(path, []byte(string(old[:len(old)-1])+`,"generation":5}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTeamStore(path).Load(testKey); !errors.Is(err, ErrTeamSignature) {
+		t.Fatalf("edited generation: got %v, want ErrTeamSignature", err)
+	}
+}
+
+// Подписать файл командного хранилища от имени личности, как это сделал бы её владелец
+func forgeTeamFile(t *testing.T, path string, f teamFile, id *Identity) {
+	t.Helper()
+	f.Generation++
+	f.Signer, f.Signature = id.Public(), nil
+	digest, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Signature = ed25519.Sign(id.signing, digest)
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Удалённый участник не может вернуть в файл свою старую запись о членстве
+func TestTeamRemovedMemberCannotReturn(t *testing.T) {
+	testHome(t)
+	mallory, err := CreateIdentity("mallory", testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := testHome(t)
+	if _, err := CreateIdentity("alice", testKey); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(home, "ops.team")
+
+	s := newTeamStore(path)
+	p := NewPassword("github", "Secret#Pass1", "")
+	passwords := map[string]Password{p.ID: *p}
+	if err := s.Save(testKey, passwords); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddMember("mallory", mallory.Public(), RoleReadWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(testKey, passwords); err != nil {
+		t.Fatal(err)
+	}
+	old := *s.file.member(mallory.Public())
+
+	if err := s.RemoveMember("mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(testKey, passwords); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddMember("mallory", mallory.Public(), RoleReadWrite); !errors.Is(err, ErrMemberRevoked) {
+		t.Fatalf("re-adding a removed member: got %v, want ErrMemberRevoked", err)
+	}
+
+	// Старая запись с верной подписью, файл подписан удалённым участником
+	f := s.file
+	f.Members = append(slices.Clone(f.Members), old)
+	forgeTeamFile(t, path, f, mallory)
+	if _, err := newTeamStore(path).Load(testKey); !errors.Is(err, ErrTeamSignature) {
+		t.Fatalf("returned member: got %v, want ErrTeamSignature", err)
+	}
+
+	// Без списка отзыва файл выглядит целым, но отзыв уже запомнен локально
+	f.Revoked = nil
+	forgeTeamFile(t, path, f, mallory)
+	if _, err := newTeamStore(path).Load(testKey); !errors.Is(err, ErrTeamRollback) {
+		t.Fatalf("dropped revocation: got %v, want ErrTeamRollback", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Токены доступа к REST API (команда serve). В файле хранятся только SHA-256 токенов,
+// сам токен показывается один раз при создании
+type TokenStore struct {
+	Tokens []APIToken `json:"tokens"`
+
+	path string
+	// Файл, из которого загружены токены: сервер перечитывает его, когда файл меняется
+	mu     sync.Mutex
+	loaded os.FileInfo
+}
+
+type APIToken struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	// Только чтение: запись, изменение и удаление запрещены
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Доступные категории; пустой список - все записи
+	Categories []string  `json:"categories,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	tokensFileName = "tokens.json"
+	tokenPrefix    = "pmt_"
+	tokenSize      = 24
+)
+
+func LoadTokenStore() (*TokenStore, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	ts := &TokenStore{path: filepath.Join(dir, tokensFileName)}
+	if err := ts.load(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (s *TokenStore) load() error {
+	st, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.Tokens, s.loaded = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var file TokenStore
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.Tokens, s.loaded = file.Tokens, st
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Сравнить файл токенов с загруженным: файл заменяется атомарно, поэтому
+//    любое сохранение меняет сам файл, а не только время изменения
+// 2. Если файл другой или удалён - перечитать список токенов
+
+func (s *TokenStore) reload() error {
+	// 1
+	st, err := os.Stat(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if st == nil && s.loaded == nil {
+		return nil
+	}
+	if st != nil && s.loaded != nil && os.SameFile(st, s.loaded) &&
+		st.ModTime().Equal(s.loaded.ModTime()) && st.Size() == s.loaded.Size() {
+		return nil
+	}
+
+	// 2
+	return s.load()
+}
+
+func (s *TokenStore) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, 0600)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить, что имя свободно
+// 2. Сгенерировать случайный токен
+// 3. Сохранить в списке только его хеш и вернуть сам токен
+
+func (s *TokenStore) Create(name string, readOnly bool, categories []string) (string, error) {
+	// 1
+	if name == "" {
+		return "", fmt.Errorf("token name cannot be empty")
+	}
+	if s.find(name) >= 0 {
+		return "", fmt.Errorf("%w: %s", ErrTokenExists, name)
+	}
+
+	// 2
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(randomBytes(tokenSize))
+
+	// 3
+	s.Tokens = append(s.Tokens, APIToken{
+		Name:       name,
+		Hash:       hashToken(secret),
+		ReadOnly:   readOnly,
+		Categories: categories,
+		CreatedAt:  time.Now(),
+	})
+	return secret, nil
+}
+
+func (s *TokenStore) Revoke(name string) error {
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, name)
+	}
+	s.Tokens = slices.Delete(s.Tokens, i, i+1)
+	return nil
+}
+
+// Поиск токена по его значению. Хеши сравниваются за постоянное время.
+// Перед проверкой перечитывается изменившийся файл токенов, так что отозванный
+// токен перестаёт работать без перезапуска сервера; если файл не читается, доступ запрещён
+func (s *TokenStore) Authenticate(secret string) (APIToken, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return APIToken{}, false
+	}
+
+	hash := []byte(hashToken(secret))
+	for _, t := range s.Tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			return t, true
+		}
+	}
+	return APIToken{}, false
+}
+
+func (s *TokenStore) find(name string) int {
+	for i, t := range s.Tokens {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Доступна ли токену запись из категории; категория токена открывает и вложенные папки
+func (t APIToken) allows(category string) bool {
+	return len(t.Categories) == 0 || slices.ContainsFunc(t.Categories, func(c string) bool {
+		return NormalizeFolder(c) != "" && inFolder(category, c)
+	})
+}
+
+// Описание области действия для списка токенов
+func (t APIToken) scope() string {
+	access := "read-write"
+	if t.ReadOnly {
+		access = "read-only"
+	}
+	if len(t.Categories) == 0 {
+		return access + ", all categories"
+	}
+	return fmt.Sprintf("%s, categories: %v", access, t.Categories)
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
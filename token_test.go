@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// Запущенный сервер видит токены, созданные и отозванные другим процессом
+func TestTokenStoreReload(t *testing.T) {
+	testHome(t)
+	server, err := LoadTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli, _ := LoadTokenStore()
+	secret, err := cli.Create("deploy", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.Authenticate(secret); !ok {
+		t.Fatal("new token rejected")
+	}
+
+	cli, _ = LoadTokenStore()
+	if err := cli.Revoke("deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.Authenticate(secret); ok {
+		t.Fatal("revoked token accepted")
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Управляющие последовательности терминала для полноэкранного режима
+const (
+	tuiAltScreenOn  = "\033[?1049h"
+	tuiAltScreenOff = "\033[?1049l"
+	tuiCursorHide   = "\033[?25l"
+	tuiCursorShow   = "\033[?25h"
+	tuiClearLine    = "\033[K"
+	tuiReverse      = "\033[7m"
+	tuiBold         = "\033[1m"
+)
+
+// Клавиши, распознаваемые в полноэкранном режиме
+type tuiKey int
+
+const (
+	keyRune tuiKey = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyCtrlC
+	keyUnknown
+)
+
+type tuiEvent struct {
+	key tuiKey
+	r   rune
+}
+
+// Состояние полноэкранного интерфейса
+type tui struct {
+	pm *PasswordManager
+	fd int
+	// Отфильтрованный список записей
+	entries []Password
+	// Индекс выбранной записи и первая видимая строка списка
+	cursor int
+	offset int
+	// Строка фильтра и признак того, что ввод идёт в поле фильтра
+	filter    string
+	filtering bool
+	// Показывать ли значение пароля в панели деталей
+	reveal bool
+	// ID последней показанной записи: показ записывается в журнал аудита один раз
+	revealed string
+	// Сообщение в строке состояния
+	status string
+	width  int
+	height int
+	// Прочитанные, но ещё не обработанные байты ввода
+	pending []byte
+	// Таймер очистки буфера обмена после копирования
+	clipboardTimer *time.Timer
+}
+
+// Алгоритм работы
+//
+// 1. Перевести терминал в raw-режим и включить альтернативный экран
+// 2. Загрузить список записей
+// 3. В цикле отрисовывать экран и обрабатывать нажатия клавиш
+// 4. При выходе восстановить терминал
+
+func RunTUI(pm *PasswordManager) error {
+	fd := int(os.Stdin.Fd())
+
+	// 1
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	fmt.Print(tuiAltScreenOn, tuiCursorHide)
+
+	// 4
+	defer func() {
+		fmt.Print(colorReset, tuiCursorShow, tuiAltScreenOff)
+		term.Restore(fd, oldState)
+	}()
+
+	// 2
+	t := &tui{pm: pm, fd: fd, status: "Press ? for help"}
+	if err := t.refresh(); err != nil {
+		return err
+	}
+
+	// 3
+	for {
+		t.render()
+
+		ev, err := t.readKey()
+		if err != nil {
+			return err
+		}
+
+		quit, err := t.handle(ev)
+		if err != nil {
+			t.status = fmt.Sprintf("Error: %v", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Алгоритм работы
+//
+// 1. Пустой фильтр - все записи по алфавиту
+// 2. Иначе - результаты поиска в порядке оценки
+// 3. Удержать курсор в пределах списка
+
+func (t *tui) refresh() error {
+	// 1
+	if t.filter == "" {
+		t.entries = t.pm.ListPasswords()
+		sortEntries(t.entries)
+	} else {
+		// 2
+		mode, query := ParseSearchQuery(t.filter)
+		results, err := t.pm.Search(query, mode)
+		if err != nil {
+			// Незаконченное регулярное выражение при наборе - не ошибка
+			t.entries = nil
+			return nil
+		}
+		t.entries = make([]Password, 0, len(results))
+		for _, r := range results {
+			t.entries = append(t.entries, r.Password)
+		}
+	}
+
+	// 3
+	if t.cursor >= len(t.entries) {
+		t.cursor = len(t.entries) - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+
+	return nil
+}
+
+// Имя записи в списке; у нескольких аккаунтов с одним именем (в списке они рядом) - ещё логин
+func (t *tui) entryTitle(idx int) string {
+	p := t.entries[idx]
+	same := func(i int) bool { return i >= 0 && i < len(t.entries) && t.entries[i].Name == p.Name }
+	if p.Username != "" && (same(idx-1) || same(idx+1)) {
+		return fmt.Sprintf("%s (%s)", p.Name, p.Username)
+	}
+	return p.Name
+}
+
+func (t *tui) selected() (Password, bool) {
+	if len(t.entries) == 0 {
+		return Password{}, false
+	}
+	return t.entries[t.cursor], true
+}
+
+// Чтение одного нажатия. Escape-последовательности стрелок приходят одним блоком,
+// а непрочитанный остаток (например, при вставке текста) сохраняется в pending
+func (t *tui) readKey() (tuiEvent, error) {
+	if len(t.pending) == 0 {
+		buf := make([]byte, 64)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return tuiEvent{}, err
+		}
+		t.pending = buf[:n]
+	}
+
+	ev, size := parseKey(t.pending)
+	t.pending = t.pending[size:]
+
+	return ev, nil
+}
+
+// Разбор первой клавиши из буфера. Возвращает событие и число использованных байт
+func parseKey(b []byte) (tuiEvent, int) {
+	if len(b) == 0 {
+		return tuiEvent{key: keyUnknown}, 0
+	}
+
+	sequences := []struct {
+		seq string
+		key tuiKey
+	}{
+		{"\033[A", keyUp}, {"\033OA", keyUp},
+		{"\033[B", keyDown}, {"\033OB", keyDown},
+		{"\033[5~", keyPageUp}, {"\033[6~", keyPageDown},
+		{"\033[H", keyHome}, {"\033[1~", keyHome}, {"\033OH", keyHome},
+		{"\033[F", keyEnd}, {"\033[4~", keyEnd}, {"\033OF", keyEnd},
+	}
+	for _, s := range sequences {
+		if strings.HasPrefix(string(b), s.seq) {
+			return tuiEvent{key: s.key}, len(s.seq)
+		}
+	}
+
+	switch b[0] {
+	case '\r', '\n':
+		return tuiEvent{key: keyEnter}, 1
+	case 0x1b:
+		if len(b) == 1 {
+			return tuiEvent{key: keyEscape}, 1
+		}
+		// Неизвестная последовательность - отбрасываем целиком
+		return tuiEvent{key: keyUnknown}, len(b)
+	case 0x7f, 0x08:
+		return tuiEvent{key: keyBackspace}, 1
+	case 0x03:
+		return tuiEvent{key: keyCtrlC}, 1
+	}
+
+	r, size := utf8.DecodeRune(b)
+	if r == utf8.RuneError || r < 0x20 {
+		return tuiEvent{key: keyUnknown}, size
+	}
+	return tuiEvent{key: keyRune, r: r}, size
+}
+
+// Алгоритм работы
+//
+// 1. В режиме фильтра символы дописываются в строку фильтра и список обновляется сразу
+// 2. В обычном режиме клавиши управляют курсором и действиями над записью
+// 3. Вернуть признак выхода
+
+func (t *tui) handle(ev tuiEvent) (bool, error) {
+	if ev.key == keyCtrlC {
+		return true, nil
+	}
+
+	// 1
+	if t.filtering {
+		switch ev.key {
+		case keyEnter, keyEscape:
+			t.filtering = false
+		case keyBackspace:
+			if r := []rune(t.filter); len(r) > 0 {
+				t.filter = string(r[:len(r)-1])
+			}
+		case keyRune:
+			t.filter += string(ev.r)
+			t.cursor = 0
+		case keyUp:
+			t.move(-1)
+		case keyDown:
+			t.move(1)
+		}
+		return false, t.refresh()
+	}
+
+	// 2
+	page := t.listHeight()
+	switch ev.key {
+	case keyUp:
+		t.move(-1)
+	case keyDown:
+		t.move(1)
+	case keyPageUp:
+		t.move(-page)
+	case keyPageDown:
+		t.move(page)
+	case keyHome:
+		t.move(-len(t.entries))
+	case keyEnd:
+		t.move(len(t.entries))
+	case keyEscape:
+		if t.filter != "" {
+			t.filter = ""
+			return false, t.refresh()
+		}
+	case keyRune:
+		switch ev.r {
+		case 'q':
+			// 3
+			return true, nil
+		case 'k':
+			t.move(-1)
+		case 'j':
+			t.move(1)
+		case 'g':
+			t.move(-len(t.entries))
+		case 'G':
+			t.move(len(t.entries))
+		case '/':
+			t.filtering = true
+		case 'v':
+			t.reveal, t.revealed = !t.reveal, ""
+		case 'c':
+			return false, t.copySelected()
+		case 'e':
+			return false, t.editSelected()
+		case 'd':
+			return false, t.deleteSelected()
+		case '?':
+			t.status = "↑/↓ j/k move  / filter  v reveal  c copy  e edit  d delete  q quit"
+		}
+	}
+
+	return false, nil
+}
+
+func (t *tui) move(delta int) {
+	t.cursor += delta
+	if t.cursor >= len(t.entries) {
+		t.cursor = len(t.entries) - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+}
+
+// Копирование через OSC 52: терминал сам кладёт текст в буфер обмена, без cgo и внешних утилит
+func (t *tui) copySelected() error {
+	p, ok := t.selected()
+	if !ok {
+		return nil
+	}
+	if err := t.pm.RecordAudit(auditEntry(AuditGet, p, "copied")); err != nil {
+		return err
+	}
+
+	fmt.Printf("\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(p.Value)))
+	t.status = fmt.Sprintf("Password for %s copied to clipboard", p.Name)
+
+	// Пустые данные OSC 52 очищают буфер обмена. Повторное копирование перезапускает таймер
+	if timeout := time.Duration(appConfig.Timeouts.Clipboard); timeout > 0 {
+		if t.clipboardTimer != nil {
+			t.clipboardTimer.Stop()
+		}
+		t.clipboardTimer = time.AfterFunc(timeout, func() {
+			fmt.Print("\033]52;c;\a")
+		})
+		t.status += fmt.Sprintf(", clears in %s", timeout)
+	}
+
+	return nil
+}
+
+// Алгоритм работы
+//
+// 1. Запросить новый пароль в строке состояния со скрытым вводом
+// 2. Пустой ввод - сгенерировать пароль
+// 3. Обновить запись и список
+
+func (t *tui) editSelected() error {
+	p, ok := t.selected()
+	if !ok {
+		return nil
+	}
+	if !p.isLogin() {
+		t.status = fmt.Sprintf("%s is a %s entry, edit it from the menu", p.Name, p.EntryKind())
+		return nil
+	}
+
+	// 1
+	value, ok, err := t.prompt(fmt.Sprintf("New password for %s (Enter = generate): ", p.Name), true)
+	if err != nil || !ok {
+		return err
+	}
+
+	// 2
+	if value == "" {
+		value, err = t.pm.GeneratePassword(appConfig.Generator.Length)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 3
+	if err := t.pm.UpdatePassword(p.ID, value); err != nil {
+		return err
+	}
+	t.status = fmt.Sprintf("Password for %s updated", p.Name)
+
+	return t.refresh()
+}
+
+func (t *tui) deleteSelected() error {
+	p, ok := t.selected()
+	if !ok {
+		return nil
+	}
+
+	if !t.confirm(fmt.Sprintf("Delete %s? This cannot be undone", p.Name)) {
+		t.status = "Delete cancelled"
+		return nil
+	}
+
+	if err := t.pm.DeletePassword(p.ID); err != nil {
+		return err
+	}
+	t.status = fmt.Sprintf("%s deleted", p.Name)
+
+	return t.refresh()
+}
+
+// Алгоритм работы
+//
+// 1. Нарисовать диалог подтверждения поверх экрана
+// 2. Дождаться y (да) или n/Esc (нет)
+
+func (t *tui) confirm(question string) bool {
+	// 1
+	t.render()
+	lines := []string{"", "  " + question + "  ", "", "  [y] Yes    [n] No  ", ""}
+	t.drawBox(lines)
+
+	// 2
+	for {
+		ev, err := t.readKey()
+		if err != nil {
+			return false
+		}
+		switch {
+		case ev.key == keyRune && (ev.r == 'y' || ev.r == 'Y'):
+			return true
+		case ev.key == keyRune && (ev.r == 'n' || ev.r == 'N'), ev.key == keyEscape, ev.key == keyCtrlC:
+			return false
+		}
+	}
+}
+
+// Алгоритм работы
+//
+// 1. Показать приглашение в строке состояния
+// 2. Собирать символы до Enter, Esc отменяет ввод
+// 3. При скрытом вводе выводить звёздочки
+
+func (t *tui) prompt(label string, hidden bool) (string, bool, error) {
+	input := []rune{}
+	for {
+		// 1, 3
+		shown := string(input)
+		if hidden {
+			shown = strings.Repeat("*", len(input))
+		}
+		fmt.Printf("\033[%d;1H%s%s%s%s%s", t.height, tuiReverse, label, shown, tuiClearLine, colorReset)
+
+		// 2
+		ev, err := t.readKey()
+		if err != nil {
+			return "", false, err
+		}
+		switch ev.key {
+		case keyEnter:
+			return string(input), true, nil
+		case keyEscape, keyCtrlC:
+			t.status = "Cancelled"
+			return "", false, nil
+		case keyBackspace:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		case keyRune:
+			input = append(input, ev.r)
+		}
+	}
+}
+
+func (t *tui) listHeight() int {
+	// Строка фильтра, заголовок, разделитель и строка состояния
+	h := t.height - 4
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// Алгоритм работы
+//
+// 1. Узнать размер терминала
+// 2. Нарисовать строку фильтра
+// 3. Нарисовать список записей слева с прокруткой до курсора
+// 4. Нарисовать детали выбранной записи справа
+// 5. Нарисовать строку состояния
+
+func (t *tui) render() {
+	// 1
+	w, h, err := term.GetSize(t.fd)
+	if err != nil || w == 0 || h == 0 {
+		w, h = 80, 24
+	}
+	t.width, t.height = w, h
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+
+	// 2
+	filterLine := fmt.Sprintf(" Filter: %s", t.filter)
+	if t.filtering {
+		filterLine += "_"
+	}
+	b.WriteString(tuiBold + truncate(filterLine, w) + colorReset + tuiClearLine + "\r\n")
+
+	listWidth := w * 2 / 5
+	if listWidth < 20 {
+		listWidth = w
+	}
+	header := fmt.Sprintf(" %-*s│ Details (%d entries)", listWidth-1, "Entries", len(t.entries))
+	b.WriteString(truncate(header, w) + tuiClearLine + "\r\n")
+	b.WriteString(strings.Repeat("─", w) + "\r\n")
+
+	// 3
+	rows := t.listHeight()
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+rows {
+		t.offset = t.cursor - rows + 1
+	}
+
+	details := t.detailLines()
+	for i := 0; i < rows; i++ {
+		idx := t.offset + i
+		left := ""
+		if idx < len(t.entries) {
+			left = " " + t.entryTitle(idx)
+		}
+		left = pad(truncate(left, listWidth-1), listWidth-1)
+		if idx == t.cursor && idx < len(t.entries) {
+			left = tuiReverse + left + colorReset
+		}
+
+		// 4
+		right := ""
+		if i < len(details) {
+			right = details[i]
+		}
+		b.WriteString(left + "│ " + truncate(right, w-listWidth-2) + tuiClearLine + "\r\n")
+	}
+
+	// 5
+	b.WriteString(tuiReverse + pad(truncate(" "+t.status, w), w) + colorReset)
+
+	fmt.Print(b.String())
+}
+
+func (t *tui) detailLines() []string {
+	p, ok := t.selected()
+	if !ok {
+		return []string{"No entries"}
+	}
+
+	hidden := strings.Repeat("•", 8) + "  (v to reveal)"
+	if t.reveal && t.revealed != p.ID {
+		if err := t.pm.RecordAudit(auditEntry(AuditGet, p, "revealed")); err != nil {
+			t.reveal, t.status = false, err.Error()
+		} else {
+			t.revealed = p.ID
+		}
+	}
+	schema, err := FindKind(p.Kind)
+	if err != nil {
+		schema = KindSchema{Title: p.Kind}
+	}
+
+	// Поля по схеме типа: основное значение и секретные поля скрыты до нажатия v
+	lines := []string{
+		"Service:       " + p.Name,
+		"Type:          " + schema.Title,
+		"Category:      " + p.Category,
+	}
+	for _, f := range schema.Fields {
+		value := p.Field(f.Key)
+		if value == "" {
+			continue
+		}
+		if (f.Key == fieldValue || f.Secret) && !t.reveal {
+			value = hidden
+		}
+		label := pad(truncate(f.Label+":", 14), 15)
+		for i, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+			if i > 0 {
+				label = strings.Repeat(" ", 15)
+			}
+			lines = append(lines, label+line)
+		}
+	}
+
+	if len(p.Attachments) > 0 {
+		lines = append(lines, "Attachments:   "+attachmentNames(p))
+	}
+
+	return append(lines,
+		"Created:       "+p.CreatedAt.Format("2006-01-02 15:04:05"),
+		"Last Modified: "+p.LastModified.Format("2006-01-02 15:04:05"),
+	)
+}
+
+// Рамка по центру экрана для диалогов
+func (t *tui) drawBox(lines []string) {
+	width := 0
+	for _, l := range lines {
+		if n := len([]rune(l)); n > width {
+			width = n
+		}
+	}
+
+	top := (t.height-len(lines))/2 - 1
+	left := (t.width-width)/2 - 1
+	if top < 1 {
+		top = 1
+	}
+	if left < 1 {
+		left = 1
+	}
+
+	fmt.Printf("\033[%d;%dH┌%s┐", top, left, strings.Repeat("─", width))
+	for i, l := range lines {
+		fmt.Printf("\033[%d;%dH│%s│", top+1+i, left, pad(l, width))
+	}
+	fmt.Printf("\033[%d;%dH└%s┘", top+1+len(lines), left, strings.Repeat("─", width))
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 0 {
+		return ""
+	}
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
+
+func pad(s string, width int) string {
+	n := len([]rune(s))
+	if n >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-n)
+}
@@ -3,17 +3,19 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 )
 
 const (
-	colorRed     = "\033[31m"
-	colorGreen   = "\033[32m"
-	colorYellow  = "\033[33m"
 	colorReset   = "\033[0m"
 	clearDisplay = "\033[H\033[2J"
 )
 
+// Куда выводятся сообщения. В режимах, где stdout занят протоколом
+// (git-credential, native messaging), сообщения уходят в stderr
+var messageOutput io.Writer = os.Stdout
+
 // Очистка экрана
 
 func clearScreen() {
@@ -23,19 +25,19 @@ func clearScreen() {
 // Вывод сообщения об успехе
 
 func showSuccess(message string) {
-	fmt.Printf("%s✓ Success: %s%s\n", colorGreen, message, colorReset)
+	fmt.Fprintln(messageOutput, appConfig.Colors.paint(appConfig.Colors.Success, "✓ Success: "+message))
 }
 
 // Вывод сообщения об ошибке
 
 func showError(message string) {
-	fmt.Printf("%s✗ Error: %s%s\n", colorRed, message, colorReset)
+	fmt.Fprintln(messageOutput, appConfig.Colors.paint(appConfig.Colors.Error, "✗ Error: "+message))
 }
 
 // Вывод информационного сообщения
 
 func showInfo(message string) {
-	fmt.Printf("%s→ Info: %s%s\n", colorYellow, message, colorReset)
+	fmt.Fprintln(messageOutput, appConfig.Colors.paint(appConfig.Colors.Info, "→ Info: "+message))
 }
 
 // Ожидание нажатия Enter
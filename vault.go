@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Реестр именованных хранилищ. Хранится в каталоге настроек пользователя
+// ($XDG_CONFIG_HOME/passwordmanager/vaults.json), поэтому не зависит от текущего каталога
+type VaultRegistry struct {
+	// Хранилище, открываемое без --vault
+	Default string       `json:"default"`
+	Vaults  []VaultEntry `json:"vaults"`
+
+	path string
+}
+
+type VaultEntry struct {
+	Name      string    `json:"name"`
+	URI       string    `json:"uri"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	appDirName       = "passwordmanager"
+	registryFileName = "vaults.json"
+	defaultVaultName = "personal"
+	legacyVaultFile  = "ne_password.dat"
+	vaultFileExt     = ".dat"
+)
+
+var vaultNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Каталог настроек приложения ($XDG_CONFIG_HOME/passwordmanager)
+func appConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+// Каталог данных приложения ($XDG_DATA_HOME/passwordmanager, по умолчанию ~/.local/share/passwordmanager)
+func appDataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appDirName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", appDirName), nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти файл реестра в каталоге настроек
+// 2. Если файла нет - вернуть пустой реестр
+// 3. Прочитать JSON
+
+func LoadVaultRegistry() (*VaultRegistry, error) {
+	// 1
+	dir, err := appConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	reg := &VaultRegistry{path: filepath.Join(dir, registryFileName)}
+
+	// 2
+	data, err := os.ReadFile(reg.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 3
+	if err := json.Unmarshal(data, reg); err != nil {
+		return nil, fmt.Errorf("%s: %w", reg.path, err)
+	}
+
+	return reg, nil
+}
+
+func (r *VaultRegistry) Save() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, data, 0600)
+}
+
+func (r *VaultRegistry) Find(name string) (VaultEntry, bool) {
+	for _, v := range r.Vaults {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return VaultEntry{}, false
+}
+
+// Алгоритм работы функции:
+//
+// 1. Проверить имя и отсутствие дубликата
+// 2. Без явного URI - файл <name>.dat в каталоге данных
+// 3. Первое хранилище становится хранилищем по умолчанию
+
+func (r *VaultRegistry) Add(name, uri string) (VaultEntry, error) {
+	// 1
+	if !vaultNameRe.MatchString(name) {
+		return VaultEntry{}, fmt.Errorf("invalid vault name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if _, ok := r.Find(name); ok {
+		return VaultEntry{}, ErrVaultExists
+	}
+
+	// 2
+	if uri == "" {
+		dir, err := appDataDir()
+		if err != nil {
+			return VaultEntry{}, err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return VaultEntry{}, err
+		}
+		uri = filepath.Join(dir, name+vaultFileExt)
+	}
+
+	entry := VaultEntry{Name: name, URI: uri, CreatedAt: time.Now()}
+	r.Vaults = append(r.Vaults, entry)
+	sort.Slice(r.Vaults, func(i, j int) bool {
+		return r.Vaults[i].Name < r.Vaults[j].Name
+	})
+
+	// 3
+	if r.Default == "" {
+		r.Default = name
+	}
+
+	return entry, nil
+}
+
+// Убирает хранилище из реестра. Сами данные не удаляются
+func (r *VaultRegistry) Remove(name string) (VaultEntry, error) {
+	for i, v := range r.Vaults {
+		if v.Name != name {
+			continue
+		}
+		r.Vaults = append(r.Vaults[:i], r.Vaults[i+1:]...)
+		if r.Default == name {
+			r.Default = ""
+			if len(r.Vaults) > 0 {
+				r.Default = r.Vaults[0].Name
+			}
+		}
+		return v, nil
+	}
+
+	return VaultEntry{}, ErrVaultNotFound
+}
+
+func (r *VaultRegistry) SetDefault(name string) error {
+	if _, ok := r.Find(name); !ok {
+		return ErrVaultNotFound
+	}
+	r.Default = name
+	return nil
+}
+
+// Алгоритм работы функции:
+//
+// 1. Пустая ссылка - хранилище по умолчанию (при первом запуске реестр заполняется)
+// 2. URI или путь к файлу используются как есть
+// 3. Иначе это имя хранилища из реестра
+
+func (r *VaultRegistry) Resolve(ref string) (VaultEntry, error) {
+	// 1
+	if ref == "" {
+		if err := r.ensureDefault(); err != nil {
+			return VaultEntry{}, err
+		}
+		ref = r.Default
+	}
+
+	// 2
+	if strings.Contains(ref, "://") || strings.ContainsRune(ref, filepath.Separator) || strings.HasSuffix(ref, vaultFileExt) {
+		return VaultEntry{Name: ref, URI: ref}, nil
+	}
+
+	// 3
+	if v, ok := r.Find(ref); ok {
+		return v, nil
+	}
+	return VaultEntry{}, fmt.Errorf("%w: %s", ErrVaultNotFound, ref)
+}
+
+// Алгоритм работы функции:
+//
+// 1. Реестр не пуст - ничего не делать
+// 2. Если в текущем каталоге есть файл старой версии - зарегистрировать его под именем personal
+// 3. Иначе создать запись personal в каталоге данных
+// 4. Сохранить реестр
+
+func (r *VaultRegistry) ensureDefault() error {
+	// 1
+	if len(r.Vaults) > 0 {
+		if r.Default == "" {
+			r.Default = r.Vaults[0].Name
+		}
+		return nil
+	}
+
+	// 2
+	uri := ""
+	if _, err := os.Stat(legacyVaultFile); err == nil {
+		abs, err := filepath.Abs(legacyVaultFile)
+		if err != nil {
+			return err
+		}
+		uri = abs
+	}
+
+	// 3
+	if _, err := r.Add(defaultVaultName, uri); err != nil {
+		return err
+	}
+
+	// 4
+	return r.Save()
+}
+
+// Открытое хранилище: блокировка держится, пока сессия не закрыта
+type vaultSession struct {
+	Name   string
+	Store  VaultStore
+	PM     *PasswordManager
+	unlock func() error
+	// Журнал аудита; nil, если он выключен (audit.enabled=false)
+	audit *AuditLog
+}
+
+// Алгоритм работы функции:
+//
+// 1. Найти хранилище по имени или URI
+// 2. Открыть и заблокировать его
+// 3. Открыть журнал аудита хранилища, чтобы записать в него и неудачную разблокировку
+// 4. Создать менеджер поверх хранилища
+
+func openVaultSession(reg *VaultRegistry, ref string) (*vaultSession, error) {
+	// 1
+	entry, err := reg.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2
+	store, err := OpenVaultStore(entry.URI)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := store.Lock()
+	if err != nil {
+		return nil, err
+	}
+
+	// 3
+	var audit *AuditLog
+	if appConfig.Audit.Enabled {
+		if audit, err = OpenAuditLog(entry.Name); err != nil {
+			unlock()
+			return nil, err
+		}
+	}
+
+	// 4
+	return &vaultSession{
+		Name:   entry.Name,
+		Store:  store,
+		PM:     NewPasswordManagerWithStore(store),
+		unlock: unlock,
+		audit:  audit,
+	}, nil
+}
+
+// Установить мастер-пароль и загрузить данные. Новое хранилище начинается пустым.
+// Данные, расшифрованные неверным ключом, не разбираются как JSON - это неверный пароль.
+// Неверный пароль записывается в журнал аудита, после разблокировки журнал подключается к менеджеру
+func (s *vaultSession) Open(masterPassword string) error {
+	if err := s.PM.SetMasterPassword(masterPassword); err != nil {
+		return err
+	}
+	err := s.PM.LoadFromFile()
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		err = ErrMasterPassword
+	}
+	switch {
+	case errors.Is(err, ErrMasterPassword), errors.Is(err, ErrIdentityPassphrase):
+		if s.audit != nil {
+			// Ошибку записи не показываем: пользователю важнее ошибка пароля
+			s.audit.Append(AuditEvent{Op: AuditUnlockFailed, Detail: err.Error()})
+		}
+		return err
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	if s.audit != nil {
+		return s.PM.attachAudit(s.audit)
+	}
+	return nil
+}
+
+func (s *vaultSession) Close() error {
+	if s.unlock == nil {
+		return nil
+	}
+	err := s.unlock()
+	s.unlock = nil
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Добавление, выбор хранилища по умолчанию и удаление сохраняются в файле реестра
+func TestVaultRegistry(t *testing.T) {
+	home := testHome(t)
+	t.Chdir(t.TempDir())
+
+	reg, err := LoadVaultRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	personal, err := reg.Add("personal", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "data", appDirName, "personal"+vaultFileExt); personal.URI != want {
+		t.Errorf("personal URI %q, want %q", personal.URI, want)
+	}
+	if _, err := reg.Add("work", "git+ssh://example.com/work.dat"); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Default != "personal" {
+		t.Errorf("default %q, want the first vault", reg.Default)
+	}
+	if _, err := reg.Add("work", ""); !errors.Is(err, ErrVaultExists) {
+		t.Errorf("duplicate: got %v, want ErrVaultExists", err)
+	}
+	if _, err := reg.Add("../work", ""); err == nil {
+		t.Error("invalid name accepted")
+	}
+
+	if err := reg.SetDefault("missing"); !errors.Is(err, ErrVaultNotFound) {
+		t.Errorf("default missing: got %v, want ErrVaultNotFound", err)
+	}
+	if err := reg.SetDefault("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err = LoadVaultRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, want := range map[string]string{
+		"":              "git+ssh://example.com/work.dat",
+		"personal":      personal.URI,
+		"mem://":        "mem://",
+		"backup.dat":    "backup.dat",
+		"/tmp/copy.dat": "/tmp/copy.dat",
+	} {
+		v, err := reg.Resolve(ref)
+		if err != nil {
+			t.Fatalf("resolve %q: %v", ref, err)
+		}
+		if v.URI != want {
+			t.Errorf("resolve %q: %q, want %q", ref, v.URI, want)
+		}
+	}
+	if _, err := reg.Resolve("missing"); !errors.Is(err, ErrVaultNotFound) {
+		t.Errorf("resolve missing: got %v, want ErrVaultNotFound", err)
+	}
+
+	if _, err := reg.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Default != "personal" {
+		t.Errorf("default after removing it: %q, want personal", reg.Default)
+	}
+	if _, err := reg.Remove("work"); !errors.Is(err, ErrVaultNotFound) {
+		t.Errorf("remove twice: got %v, want ErrVaultNotFound", err)
+	}
+	if _, err := reg.Remove("personal"); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Default != "" {
+		t.Errorf("default of empty registry %q", reg.Default)
+	}
+}
+
+// Пустой реестр при первом запуске получает хранилище personal
+func TestVaultRegistryFirstRun(t *testing.T) {
+	testHome(t)
+	t.Chdir(t.TempDir())
+
+	reg, err := LoadVaultRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := reg.Resolve("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != defaultVaultName || reg.Default != defaultVaultName {
+		t.Errorf("first run: vault %q, default %q", v.Name, reg.Default)
+	}
+
+	reg, err = LoadVaultRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.Find(defaultVaultName); !ok {
+		t.Error("first run registry was not saved")
+	}
+}